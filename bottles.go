@@ -0,0 +1,194 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// how long the parsed Bottles library is reused before re-reading bottle.yml files
+const bottlesReloadInterval = time.Minute
+
+// bottlesProgram is a program added to a bottle in Bottles.
+type bottlesProgram struct {
+	Name   string
+	Path   string // host path to the exe, normalized like normalizeHeroicPath
+	Bottle string // the bottle's prefix directory
+}
+
+var (
+	bottlesPrograms []bottlesProgram
+	bottlesLoadedAt time.Time
+)
+
+// Bottles bottle directories for the native and Flatpak installs
+func bottlesDirs() []string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return nil
+	}
+	return []string{
+		filepath.Join(home, ".local", "share", "bottles", "bottles"),
+		filepath.Join(home, ".var", "app", "com.usebottles.bottles", "data", "bottles", "bottles"),
+	}
+}
+
+// read the programs of every bottle under dir. bottles with a custom path
+// keep their bottle.yml elsewhere and aren't found.
+func loadBottlesLibrary(dir string) []bottlesProgram {
+	configs, _ := filepath.Glob(filepath.Join(dir, "*", "bottle.yml"))
+	var programs []bottlesProgram
+	for _, path := range configs {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		bottle := filepath.Dir(path)
+		for _, program := range parseBottlePrograms(string(data)) {
+			program.Bottle = bottle
+			programs = append(programs, program)
+		}
+	}
+	return programs
+}
+
+// pull External_Programs out of a bottle.yml. this reads only the subset of
+// YAML Bottles writes for that block (nested maps of scalars), not YAML in
+// general.
+func parseBottlePrograms(data string) []bottlesProgram {
+	var programs []bottlesProgram
+	var folder, executable string
+	finish := func() {
+		if len(programs) == 0 {
+			return
+		}
+		program := &programs[len(programs)-1]
+		if program.Path == "" && folder != "" && executable != "" {
+			program.Path = filepath.Join(folder, executable)
+		}
+		program.Path = normalizeHeroicPath(program.Path)
+	}
+
+	inPrograms := false
+	programIndent, fieldIndent := -1, -1
+	for _, line := range strings.Split(data, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		indent := len(line) - len(strings.TrimLeft(line, " "))
+		key, value, _ := strings.Cut(trimmed, ":")
+		value = unquoteYAML(strings.TrimSpace(value))
+		switch {
+		case indent == 0:
+			inPrograms = key == "External_Programs"
+		case !inPrograms:
+		case programIndent == -1 || indent <= programIndent:
+			finish()
+			programs = append(programs, bottlesProgram{})
+			folder, executable = "", ""
+			programIndent, fieldIndent = indent, -1
+		case fieldIndent == -1 || indent == fieldIndent:
+			fieldIndent = indent
+			program := &programs[len(programs)-1]
+			switch key {
+			case "name":
+				program.Name = value
+			case "path":
+				program.Path = value
+			case "folder":
+				folder = value
+			case "executable":
+				executable = value
+			}
+		}
+	}
+	finish()
+
+	valid := programs[:0]
+	for _, program := range programs {
+		if program.Name != "" && program.Path != "" {
+			valid = append(valid, program)
+		}
+	}
+	return valid
+}
+
+// strip YAML single or double quotes from a scalar
+func unquoteYAML(value string) string {
+	switch {
+	case len(value) >= 2 && value[0] == '\'' && value[len(value)-1] == '\'':
+		return strings.ReplaceAll(value[1:len(value)-1], "''", "'")
+	case len(value) >= 2 && value[0] == '"' && value[len(value)-1] == '"':
+		if unquoted, err := strconv.Unquote(value); err == nil {
+			return unquoted
+		}
+		return value[1 : len(value)-1]
+	}
+	return value
+}
+
+// host path for a wine path in prefix: C: is the prefix's drive_c and Z: is
+// the host root. host paths are returned normalized.
+func bottlesHostPath(prefix string, path string) string {
+	path = strings.Trim(path, "\"'")
+	if len(path) >= 2 && path[1] == ':' && (path[0] == 'C' || path[0] == 'c') {
+		return normalizeHeroicPath(filepath.Join(prefix, "drive_c") + "/" + strings.ReplaceAll(path[2:], "\\", "/"))
+	}
+	return normalizeHeroicPath(path)
+}
+
+// the program a wine process in prefix is running, given its cmdline args.
+// an arg matches a program of the same bottle by its full path (compared
+// case-insensitively, like wine does).
+func matchBottlesProgram(programs []bottlesProgram, prefix string, args []string) (bottlesProgram, bool) {
+	prefix = filepath.Clean(prefix)
+	for _, arg := range args {
+		if arg == "" {
+			continue
+		}
+		path := bottlesHostPath(prefix, arg)
+		for _, program := range programs {
+			if filepath.Clean(program.Bottle) != prefix {
+				continue
+			}
+			if strings.EqualFold(path, program.Path) {
+				return program, true
+			}
+		}
+	}
+	return bottlesProgram{}, false
+}
+
+// name and path of the Bottles program a process runs, or "" if it isn't
+// one. the process must be in a bottle's prefix (WINEPREFIX). the library is
+// re-read at most once per bottlesReloadInterval, and without one no
+// process's environment is read.
+func bottlesGameName(pidStr string) (string, string) {
+	if time.Since(bottlesLoadedAt) > bottlesReloadInterval {
+		bottlesPrograms = nil
+		for _, dir := range bottlesDirs() {
+			bottlesPrograms = append(bottlesPrograms, loadBottlesLibrary(dir)...)
+		}
+		bottlesLoadedAt = time.Now()
+	}
+	if len(bottlesPrograms) == 0 {
+		return "", ""
+	}
+	prefix := readEnviron(pidStr)["WINEPREFIX"]
+	if prefix == "" {
+		return "", ""
+	}
+	data, err := os.ReadFile(filepath.Join("/proc", pidStr, "cmdline"))
+	if err != nil {
+		return "", ""
+	}
+	args := strings.Split(strings.TrimRight(string(data), "\x00"), "\x00")
+	program, ok := matchBottlesProgram(bottlesPrograms, prefix, args)
+	if !ok {
+		return "", ""
+	}
+	return program.Name, program.Path
+}
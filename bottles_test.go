@@ -0,0 +1,78 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+const testBottleYAML = `Arch: win64
+Custom_Path: false
+External_Programs:
+  1b2f0c8e-5f2a-4c9e-9d7e-0a1b2c3d4e5f:
+    arguments: ''
+    executable: Launcher.exe
+    folder: /home/user/.local/share/bottles/bottles/Games/drive_c/Program Files/Some Game
+    id: 1b2f0c8e-5f2a-4c9e-9d7e-0a1b2c3d4e5f
+    name: Some Game
+    path: /home/user/.local/share/bottles/bottles/Games/drive_c/Program Files/Some Game/Launcher.exe
+    script: ''
+  7c8d9e0f-1a2b-3c4d-5e6f-708192a3b4c5:
+    executable: 'other''s.exe'
+    folder: "/mnt/games/Other Game"
+    name: "Other Game"
+Name: Games
+Path: Games
+Runner: soda-7.0-9
+`
+
+func TestParseBottlePrograms(t *testing.T) {
+	programs := parseBottlePrograms(testBottleYAML)
+	if len(programs) != 2 {
+		t.Fatalf("parsed %d programs, want 2: %+v", len(programs), programs)
+	}
+	if programs[0].Name != "Some Game" || programs[0].Path != "/home/user/.local/share/bottles/bottles/Games/drive_c/Program Files/Some Game/Launcher.exe" {
+		t.Errorf("program 0 = %+v", programs[0])
+	}
+	// path built from folder and executable when missing
+	if programs[1].Name != "Other Game" || programs[1].Path != "/mnt/games/Other Game/other's.exe" {
+		t.Errorf("program 1 = %+v", programs[1])
+	}
+
+	if got := parseBottlePrograms("External_Programs: {}\nName: Empty\n"); len(got) != 0 {
+		t.Errorf("empty External_Programs parsed as %+v", got)
+	}
+}
+
+func TestMatchBottlesProgram(t *testing.T) {
+	dir := t.TempDir()
+	bottle := filepath.Join(dir, "Games")
+	writeTestFile(t, filepath.Join(bottle, "bottle.yml"), `External_Programs:
+  abc:
+    name: Some Game
+    path: `+bottle+`/drive_c/Program Files/Some Game/Launcher.exe
+`)
+	programs := loadBottlesLibrary(dir)
+	if len(programs) != 1 || programs[0].Bottle != bottle {
+		t.Fatalf("loadBottlesLibrary = %+v, want one program in %s", programs, bottle)
+	}
+
+	tests := []struct {
+		name   string
+		prefix string
+		args   []string
+		want   bool
+	}{
+		{"wine C: path", bottle, []string{`C:\Program Files\Some Game\Launcher.exe`}, true},
+		{"host path", bottle, []string{"wine", bottle + "/drive_c/Program Files/Some Game/Launcher.exe"}, true},
+		{"different case", bottle + "/", []string{`C:\PROGRAM FILES\Some Game\LAUNCHER.EXE`}, true},
+		{"same exe name elsewhere in the bottle", bottle, []string{`C:\Games\Launcher.exe`}, false},
+		{"other bottle", filepath.Join(dir, "Other"), []string{`C:\Program Files\Some Game\Launcher.exe`}, false},
+		{"other exe", bottle, []string{`C:\windows\system32\explorer.exe`}, false},
+	}
+	for _, tt := range tests {
+		program, ok := matchBottlesProgram(programs, tt.prefix, tt.args)
+		if ok != tt.want || (ok && program.Name != "Some Game") {
+			t.Errorf("%s: matchBottlesProgram = %+v, %v, want %v", tt.name, program, ok, tt.want)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// CloudTitlePattern maps a browser window title to a streamed game. the
+// first capture group of Pattern is the game name.
+type CloudTitlePattern struct {
+	Pattern  string `json:"pattern"`
+	Platform string `json:"platform"`
+}
+
+type cloudPattern struct {
+	re       *regexp.Regexp
+	platform string
+}
+
+var (
+	// look for cloud gaming sessions in window titles when no local game runs
+	cloudGaming   = false
+	cloudPatterns = builtinCloudPatterns()
+	// logged once so a missing xdotool doesn't spam every tick
+	windowTitlesFailed = false
+)
+
+// built-in patterns; cloud_title_patterns entries are tried first
+func builtinCloudPatterns() []cloudPattern {
+	return []cloudPattern{
+		{regexp.MustCompile(`^(.+?) on GeForce NOW`), "GeForce NOW"},
+		{regexp.MustCompile(`^(?:Play )?(.+?) \| Xbox Cloud Gaming`), "Xbox Cloud"},
+	}
+}
+
+// compile user title patterns ahead of the built-ins, skipping invalid ones
+func loadCloudPatterns(patterns []CloudTitlePattern) {
+	var custom []cloudPattern
+	for _, p := range patterns {
+		re, err := regexp.Compile(p.Pattern)
+		if err != nil {
+			slog.Warn("Ignoring invalid cloud title pattern", "pattern", p.Pattern, "err", err)
+			continue
+		}
+		if re.NumSubexp() < 1 {
+			slog.Warn("Ignoring cloud title pattern without a capture group for the game name", "pattern", p.Pattern)
+			continue
+		}
+		custom = append(custom, cloudPattern{re: re, platform: p.Platform})
+	}
+	cloudPatterns = append(custom, cloudPatterns...)
+}
+
+// titles of all X11 (and XWayland) windows, via xdotool. native Wayland
+// windows aren't visible to it.
+func windowTitles() ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, "xdotool", "search", "--onlyvisible", "--name", ".", "getwindowname", "%@").Output()
+	if err != nil {
+		return nil, err
+	}
+	return strings.Split(strings.TrimSpace(string(out)), "\n"), nil
+}
+
+// first window title matching a cloud pattern, as game name and platform
+func matchCloudTitle(titles []string) (string, string) {
+	for _, p := range cloudPatterns {
+		for _, title := range titles {
+			if m := p.re.FindStringSubmatch(title); m != nil {
+				if name := strings.TrimSpace(m[1]); name != "" {
+					return name, p.platform
+				}
+			}
+		}
+	}
+	return "", ""
+}
+
+// detect a game streamed in a browser tab. the activity is tied to the
+// bridge's PID since the browser process outlives the session.
+func detectCloudGame() DetectedGame {
+	titles, err := windowTitles()
+	if err != nil {
+		if !windowTitlesFailed {
+			slog.Warn("Can't read window titles for cloud gaming detection. Is xdotool installed?", "err", err)
+			windowTitlesFailed = true
+		}
+		return DetectedGame{}
+	}
+	windowTitlesFailed = false
+	name, platform := matchCloudTitle(titles)
+	if name == "" || isIgnoredGame(name) {
+		return DetectedGame{}
+	}
+	return DetectedGame{Name: name, Pid: os.Getpid(), Platform: platform, Method: "cloud"}
+}
@@ -0,0 +1,33 @@
+package main
+
+import "testing"
+
+func TestMatchCloudTitle(t *testing.T) {
+	prev := cloudPatterns
+	defer func() { cloudPatterns = prev }()
+	loadCloudPatterns([]CloudTitlePattern{
+		{Pattern: `^(.+) - Boosteroid`, Platform: "Boosteroid"},
+		{Pattern: `no capture group`, Platform: "Broken"},
+		{Pattern: `(unclosed`, Platform: "Broken"},
+	})
+	if len(cloudPatterns) != len(prev)+1 {
+		t.Fatalf("loaded %d patterns, want %d (invalid ones skipped)", len(cloudPatterns), len(prev)+1)
+	}
+
+	tests := []struct {
+		titles       []string
+		wantName     string
+		wantPlatform string
+	}{
+		{[]string{"Inbox - Mozilla Firefox", "Cyberpunk 2077 on GeForce NOW - Google Chrome"}, "Cyberpunk 2077", "GeForce NOW"},
+		{[]string{"Play Halo Infinite | Xbox Cloud Gaming (Beta) on Xbox.com — Mozilla Firefox"}, "Halo Infinite", "Xbox Cloud"},
+		{[]string{"Fortnite - Boosteroid - Chromium"}, "Fortnite", "Boosteroid"},
+		{[]string{"GeForce NOW - Google Chrome", "Terminal"}, "", ""},
+	}
+	for _, tt := range tests {
+		name, platform := matchCloudTitle(tt.titles)
+		if name != tt.wantName || platform != tt.wantPlatform {
+			t.Errorf("matchCloudTitle(%q) = %q, %q, want %q, %q", tt.titles, name, platform, tt.wantName, tt.wantPlatform)
+		}
+	}
+}
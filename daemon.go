@@ -0,0 +1,109 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// set in the environment of the re-executed -daemon child, so it runs the
+// scanner instead of forking again
+const daemonChildEnv = "DRB_DAEMON_CHILD"
+
+// true in the detached child started by -daemon
+func isDaemonChild() bool {
+	return os.Getenv(daemonChildEnv) == "1"
+}
+
+// default -log-file and -pid-file locations: the log next to the state file,
+// the pid file in XDG_RUNTIME_DIR when there is one
+func defaultDaemonFiles(paths Paths) (logFile string, pidFile string) {
+	dir := filepath.Dir(paths.State)
+	logFile = filepath.Join(dir, "discord-rpc-bridge.log")
+	pidFile = filepath.Join(dir, "discord-rpc-bridge.pid")
+	if runDir := os.Getenv("XDG_RUNTIME_DIR"); runDir != "" {
+		pidFile = filepath.Join(runDir, "discord-rpc-bridge.pid")
+	}
+	return logFile, pidFile
+}
+
+// the command line with -daemon removed, for the child
+func daemonArgs(args []string) []string {
+	out := make([]string, 0, len(args))
+	for _, arg := range args {
+		name, _, _ := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		if strings.HasPrefix(arg, "-") && name == "daemon" {
+			continue
+		}
+		out = append(out, arg)
+	}
+	return out
+}
+
+// re-exec this binary with args in a new session (setsid), detached from the
+// terminal, with stdin from /dev/null and stdout/stderr appended to logFile.
+// returns the child's pid.
+func startDaemon(args []string, logFile string) (int, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return 0, err
+	}
+	if err := os.MkdirAll(filepath.Dir(logFile), 0755); err != nil {
+		return 0, err
+	}
+	logOut, err := os.OpenFile(logFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return 0, err
+	}
+	defer logOut.Close()
+	devNull, err := os.Open(os.DevNull)
+	if err != nil {
+		return 0, err
+	}
+	defer devNull.Close()
+
+	cmd := exec.Command(exe, args...)
+	cmd.Env = append(os.Environ(), daemonChildEnv+"=1")
+	cmd.Stdin = devNull
+	cmd.Stdout = logOut
+	cmd.Stderr = logOut
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+	if err := cmd.Start(); err != nil {
+		return 0, err
+	}
+	pid := cmd.Process.Pid
+	return pid, cmd.Process.Release()
+}
+
+// error if pidFile names a process that's still running. a missing file or
+// one left behind by a dead process is fine.
+func checkPidFile(pidFile string) error {
+	data, err := os.ReadFile(pidFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil || pid <= 0 {
+		return nil
+	}
+	if err := syscall.Kill(pid, 0); err == nil || errors.Is(err, syscall.EPERM) {
+		return fmt.Errorf("already running as pid %d (%s)", pid, pidFile)
+	}
+	return nil
+}
+
+// record this process's pid in pidFile
+func writePidFile(pidFile string) error {
+	if err := os.MkdirAll(filepath.Dir(pidFile), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(pidFile, []byte(strconv.Itoa(os.Getpid())+"\n"), 0644)
+}
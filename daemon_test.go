@@ -0,0 +1,59 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"testing"
+)
+
+func TestDaemonArgs(t *testing.T) {
+	args := []string{"-daemon", "-log-level", "debug", "--daemon=true", "-socket", "/tmp/discord-ipc-0", "-daemonize"}
+	want := []string{"-log-level", "debug", "-socket", "/tmp/discord-ipc-0", "-daemonize"}
+	if got := daemonArgs(args); !slices.Equal(got, want) {
+		t.Errorf("daemonArgs = %v, want %v", got, want)
+	}
+}
+
+func TestPidFile(t *testing.T) {
+	pidFile := filepath.Join(t.TempDir(), "run", "bridge.pid")
+	if err := checkPidFile(pidFile); err != nil {
+		t.Errorf("checkPidFile with no file: %v", err)
+	}
+
+	if err := writePidFile(pidFile); err != nil {
+		t.Fatalf("writePidFile: %v", err)
+	}
+	data, _ := os.ReadFile(pidFile)
+	if string(data) != strconv.Itoa(os.Getpid())+"\n" {
+		t.Errorf("pid file = %q, want this process's pid", data)
+	}
+	if err := checkPidFile(pidFile); err == nil {
+		t.Error("checkPidFile passed with the recorded process still running")
+	}
+
+	// a pid file left behind by a process that's gone
+	writeTestFile(t, pidFile, "999999999\n")
+	if err := checkPidFile(pidFile); err != nil {
+		t.Errorf("checkPidFile with a stale pid: %v", err)
+	}
+	writeTestFile(t, pidFile, "garbage")
+	if err := checkPidFile(pidFile); err != nil {
+		t.Errorf("checkPidFile with an unreadable pid: %v", err)
+	}
+}
+
+func TestDefaultDaemonFiles(t *testing.T) {
+	paths := Paths{State: "/home/tester/.cache/discord-rpc-bridge/state.json"}
+	t.Setenv("XDG_RUNTIME_DIR", "/run/user/1000")
+	logFile, pidFile := defaultDaemonFiles(paths)
+	if logFile != "/home/tester/.cache/discord-rpc-bridge/discord-rpc-bridge.log" || pidFile != "/run/user/1000/discord-rpc-bridge.pid" {
+		t.Errorf("defaultDaemonFiles = %s, %s", logFile, pidFile)
+	}
+
+	t.Setenv("XDG_RUNTIME_DIR", "")
+	if _, pidFile := defaultDaemonFiles(paths); pidFile != "/home/tester/.cache/discord-rpc-bridge/discord-rpc-bridge.pid" {
+		t.Errorf("pid file without XDG_RUNTIME_DIR = %s, want it next to the state file", pidFile)
+	}
+}
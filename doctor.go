@@ -0,0 +1,148 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"time"
+)
+
+// doctorCheck is one line of the -doctor checklist.
+type doctorCheck struct {
+	Name     string
+	OK       bool
+	Critical bool // a failure means the bridge can't work at all
+	Detail   string
+}
+
+// run the -doctor checks in order. the game list is loaded (and downloaded
+// if needed) the same way as at startup, so later checks can resolve games.
+func runDoctor(paths Paths, installed []SteamApp) []doctorCheck {
+	var checks []doctorCheck
+	check := func(name string, critical bool, ok bool, format string, args ...any) {
+		checks = append(checks, doctorCheck{Name: name, OK: ok, Critical: critical, Detail: fmt.Sprintf(format, args...)})
+	}
+
+	if entries, err := os.ReadDir("/proc"); err != nil {
+		check("/proc readable", true, false, "%v", err)
+	} else if _, err := os.ReadFile("/proc/self/cmdline"); err != nil {
+		check("/proc readable", true, false, "%v", err)
+	} else {
+		check("/proc readable", true, true, "%d entries", len(entries))
+	}
+
+	if name, err := osReleaseName("/etc/os-release"); err != nil {
+		check("os-release", false, false, "%v (the OS shows as %s)", err, readOSRelease())
+	} else {
+		check("os-release", false, true, "%s", name)
+	}
+
+	switch info, err := os.Stat(paths.Cache); {
+	case disableCache:
+		check("game list cache", false, true, "disabled; the list is downloaded every start")
+	case err != nil:
+		check("game list cache", false, false, "%v (it's downloaded on start)", err)
+	case time.Since(info.ModTime()) > gameCacheTTL:
+		check("game list cache", false, false, "stale: updated %s ago, refreshed after %s", time.Since(info.ModTime()).Round(time.Minute), gameCacheTTL)
+	default:
+		check("game list cache", false, true, "%s, %d bytes, updated %s ago", paths.Cache, info.Size(), time.Since(info.ModTime()).Round(time.Minute))
+	}
+
+	gameListLoaded := false
+	if err := loadGameData(paths.Cache); err != nil {
+		check("game list", true, false, "%v", err)
+	} else {
+		gameListLoaded = true
+		check("game list", true, true, "%d games", len(nameToID))
+	}
+
+	socketPath, err := locateDiscordSocket()
+	if err != nil {
+		check("Discord socket", true, false, "%v. Is Discord running?", err)
+	} else {
+		check("Discord socket", true, true, "%s", socketPath)
+	}
+
+	clientID, matched := doctorClientID(installed)
+	switch {
+	case socketPath == "":
+		check("handshake", true, false, "skipped, no socket")
+	case clientID == "":
+		check("handshake", true, false, "skipped, no client ID to test with")
+	default:
+		if conn, err := connectIPC(socketPath, clientID); err != nil {
+			check("handshake", true, false, "client ID %s: %v", clientID, err)
+		} else {
+			conn.Close()
+			check("handshake", true, true, "client ID %s", clientID)
+		}
+	}
+
+	switch {
+	case len(installed) == 0:
+		check("installed games", false, false, "no installed Steam games found")
+	case !gameListLoaded:
+		check("installed games", false, false, "skipped, no game list")
+	default:
+		check("installed games", false, matched > 0, "%d of %d installed Steam games resolve to a Discord app (see -audit)", matched, len(installed))
+	}
+	return checks
+}
+
+// client ID to test the handshake with: the first installed game that
+// resolves, then default_client_id, then any app in the game list.
+// also returns how many installed games resolve.
+func doctorClientID(installed []SteamApp) (string, int) {
+	clientID := ""
+	matched := 0
+	for _, app := range installed {
+		if status, id := auditStatus(app); status == "matched" || status == "manual" {
+			matched++
+			if clientID == "" {
+				clientID = id
+			}
+		}
+	}
+	if clientID == "" {
+		clientID = defaultClientID
+	}
+	if clientID == "" && len(nameToID) > 0 {
+		ids := make([]string, 0, len(nameToID))
+		for _, id := range nameToID {
+			ids = append(ids, id)
+		}
+		sort.Strings(ids)
+		clientID = ids[0]
+	}
+	return clientID, matched
+}
+
+// print the checklist. returns false if a critical check failed.
+func writeDoctor(w io.Writer, checks []doctorCheck) bool {
+	ok := true
+	failed := 0
+	for _, c := range checks {
+		mark := "PASS"
+		switch {
+		case c.OK:
+		case c.Critical:
+			mark = "FAIL"
+			ok = false
+			failed++
+		default:
+			mark = "WARN"
+			failed++
+		}
+		fmt.Fprintf(w, "[%s] %s: %s\n", mark, c.Name, c.Detail)
+	}
+	switch {
+	case !ok:
+		fmt.Fprintf(w, "\n%d of %d checks failed. The bridge can't present games until the FAIL checks pass.\n", failed, len(checks))
+	case failed > 0:
+		fmt.Fprintf(w, "\n%d of %d checks have warnings.\n", failed, len(checks))
+	default:
+		fmt.Fprintf(w, "\nAll %d checks passed.\n", len(checks))
+	}
+	return ok
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bytes"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRunDoctor(t *testing.T) {
+	ready := func(conn net.Conn) {
+		sendIPCPacket(newIpcConn(conn), opFrame, []byte(`{"evt":"READY"}`))
+	}
+	socket := serveHandshakes(t, ready)
+	defer func(prev string) { socketPathOverride = prev }(socketPathOverride)
+	socketPathOverride = socket
+
+	cache := filepath.Join(t.TempDir(), "games.json")
+	writeTestFile(t, cache, string(testGameList(minDetectableApps)))
+
+	checks := runDoctor(Paths{Cache: cache}, []SteamApp{{AppID: "1", InstallDir: "Test Game 3"}, {AppID: "2", InstallDir: "Not A Game"}})
+	byName := map[string]doctorCheck{}
+	for _, c := range checks {
+		byName[c.Name] = c
+	}
+	for _, name := range []string{"/proc readable", "game list cache", "game list", "Discord socket", "handshake", "installed games"} {
+		if c, ok := byName[name]; !ok || !c.OK {
+			t.Errorf("check %q = %+v, want it to pass", name, c)
+		}
+	}
+	if got := byName["installed games"].Detail; !strings.HasPrefix(got, "1 of 2") {
+		t.Errorf("installed games detail = %q, want 1 of 2 resolving", got)
+	}
+	if got := byName["handshake"].Detail; got != "client ID 1003" {
+		t.Errorf("handshake detail = %q, want the installed game's client ID", got)
+	}
+}
+
+func TestRunDoctorNoSocket(t *testing.T) {
+	defer func(prev string) { socketPathOverride = prev }(socketPathOverride)
+	socketPathOverride = filepath.Join(t.TempDir(), "missing")
+	cache := filepath.Join(t.TempDir(), "games.json")
+	writeTestFile(t, cache, string(testGameList(minDetectableApps)))
+
+	var out bytes.Buffer
+	if writeDoctor(&out, runDoctor(Paths{Cache: cache}, nil)) {
+		t.Errorf("doctor passed without a Discord socket:\n%s", out.String())
+	}
+	if !strings.Contains(out.String(), "[FAIL] handshake") {
+		t.Errorf("output doesn't report the failed handshake:\n%s", out.String())
+	}
+	if !strings.Contains(out.String(), "[WARN] installed games") {
+		t.Errorf("missing games should only warn:\n%s", out.String())
+	}
+}
+
+func TestWriteDoctorWarningsPass(t *testing.T) {
+	var out bytes.Buffer
+	ok := writeDoctor(&out, []doctorCheck{
+		{Name: "a", OK: true, Critical: true, Detail: "fine"},
+		{Name: "b", OK: false, Detail: "meh"},
+	})
+	if !ok {
+		t.Error("a failed non-critical check should not fail -doctor")
+	}
+	if want := "[PASS] a: fine\n[WARN] b: meh\n"; !strings.HasPrefix(out.String(), want) {
+		t.Errorf("output = %q, want it to start with %q", out.String(), want)
+	}
+}
+
+func TestOSReleaseName(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "os-release")
+	writeTestFile(t, path, "NAME=\"Fedora Linux\"\nPRETTY_NAME=\"Fedora Linux 40 (Workstation Edition)\"\n")
+	if got, err := osReleaseName(path); err != nil || got != "Fedora Linux 40 (Workstation Edition)" {
+		t.Errorf("osReleaseName = %q, %v", got, err)
+	}
+	os.WriteFile(path, []byte("ID=arch\n"), 0o644)
+	if _, err := osReleaseName(path); err == nil {
+		t.Error("os-release without a name should fail")
+	}
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// emulatorContent is what an emulator process is running
+type emulatorContent struct {
+	Emulator string // app name for client ID lookup (ex: RetroArch)
+	ROM      string // content title without extension or dump tags
+	System   string // platform label for the loaded core, empty if unknown
+}
+
+var (
+	coreSystems = builtinCoreSystems()
+	// RetroArch options that take a separate value argument
+	retroArchValueFlags = map[string]bool{
+		"-c": true, "--config": true, "--appendconfig": true,
+		"-L": true, "--libretro": true, "--subsystem": true,
+		"-s": true, "--save": true, "-S": true, "--savestate": true,
+		"-r": true, "--record": true, "--recordconfig": true, "--size": true,
+		"--connect": true, "--port": true, "--nick": true,
+		"--max-frames": true, "--max-frames-ss-path": true, "--entryslot": true,
+	}
+	// dump/region tags like "(USA)", "(Rev 1)", "[!]"
+	romTags = regexp.MustCompile(`\s*(\([^)]*\)|\[[^\]]*\])`)
+)
+
+// libretro core name -> system label. merged with core_systems from config
+func builtinCoreSystems() map[string]string {
+	return map[string]string{
+		"snes9x":            "SNES",
+		"snes9x2010":        "SNES",
+		"bsnes":             "SNES",
+		"bsnes_hd_beta":     "SNES",
+		"mesen-s":           "SNES",
+		"nestopia":          "NES",
+		"fceumm":            "NES",
+		"mesen":             "NES",
+		"quicknes":          "NES",
+		"gambatte":          "Game Boy",
+		"sameboy":           "Game Boy",
+		"gearboy":           "Game Boy",
+		"mgba":              "GBA",
+		"vba_next":          "GBA",
+		"vbam":              "GBA",
+		"gpsp":              "GBA",
+		"mupen64plus_next":  "N64",
+		"parallel_n64":      "N64",
+		"melonds":           "DS",
+		"desmume":           "DS",
+		"dolphin":           "GameCube",
+		"genesis_plus_gx":   "Genesis",
+		"picodrive":         "Genesis",
+		"blastem":           "Genesis",
+		"beetle_saturn":     "Saturn",
+		"yabause":           "Saturn",
+		"flycast":           "Dreamcast",
+		"pcsx_rearmed":      "PlayStation",
+		"swanstation":       "PlayStation",
+		"beetle_psx":        "PlayStation",
+		"beetle_psx_hw":     "PlayStation",
+		"mednafen_psx_hw":   "PlayStation",
+		"ppsspp":            "PSP",
+		"beetle_pce_fast":   "PC Engine",
+		"mednafen_pce_fast": "PC Engine",
+		"stella":            "Atari 2600",
+		"mame":              "Arcade",
+		"fbneo":             "Arcade",
+	}
+}
+
+// detect content loaded in an emulator process from its cmdline.
+// returns false if exePath isn't a supported emulator.
+func detectEmulator(pidStr string, exePath string) (emulatorContent, bool) {
+	if strings.ToLower(filepath.Base(exePath)) != "retroarch" {
+		return emulatorContent{}, false
+	}
+	data, err := os.ReadFile(filepath.Join("/proc", pidStr, "cmdline"))
+	if err != nil {
+		return emulatorContent{}, false
+	}
+	var args []string
+	for _, arg := range bytes.Split(bytes.TrimRight(data, "\x00"), []byte{0}) {
+		args = append(args, string(arg))
+	}
+	if len(args) > 0 {
+		args = args[1:] // argv[0]
+	}
+	core, content := parseRetroArchArgs(args)
+	return emulatorContent{
+		Emulator: "RetroArch",
+		ROM:      romTitle(content),
+		System:   coreSystem(core),
+	}, true
+}
+
+// pull the core (-L/--libretro) and content path out of RetroArch arguments.
+// content is the first positional argument.
+func parseRetroArchArgs(args []string) (core string, content string) {
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case strings.HasPrefix(arg, "--libretro="):
+			core = strings.TrimPrefix(arg, "--libretro=")
+		case arg == "-L" || arg == "--libretro":
+			if i+1 < len(args) {
+				core = args[i+1]
+			}
+			i++
+		case strings.HasPrefix(arg, "-L") && len(arg) > 2:
+			core = arg[2:]
+		case retroArchValueFlags[arg]:
+			i++
+		case strings.HasPrefix(arg, "-"):
+		case content == "":
+			content = arg
+		}
+	}
+	return core, content
+}
+
+// display title for a content path (ex: "/roms/Chrono Trigger (USA).sfc" -> "Chrono Trigger")
+func romTitle(path string) string {
+	if path == "" {
+		return ""
+	}
+	name := filepath.Base(path)
+	name = strings.TrimSuffix(name, filepath.Ext(name))
+	name = romTags.ReplaceAllString(name, "")
+	return strings.TrimSpace(name)
+}
+
+// system label for a core path (ex: ".../snes9x_libretro.so" -> "SNES")
+func coreSystem(core string) string {
+	if core == "" {
+		return ""
+	}
+	name := filepath.Base(core)
+	name = strings.TrimSuffix(name, filepath.Ext(name))
+	name = strings.TrimSuffix(name, "_android")
+	name = strings.TrimSuffix(name, "_libretro")
+	return coreSystems[strings.ToLower(name)]
+}
+
+// presence name for emulator content (ex: "Chrono Trigger (SNES)")
+func (c emulatorContent) displayName() string {
+	switch {
+	case c.ROM == "":
+		return ""
+	case c.System == "":
+		return c.ROM
+	}
+	return c.ROM + " (" + c.System + ")"
+}
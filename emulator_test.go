@@ -0,0 +1,41 @@
+package main
+
+import "testing"
+
+func TestParseRetroArchArgs(t *testing.T) {
+	tests := []struct {
+		args        []string
+		wantCore    string
+		wantContent string
+	}{
+		{[]string{"-L", "/usr/lib/libretro/snes9x_libretro.so", "/roms/Chrono Trigger (USA).sfc"}, "/usr/lib/libretro/snes9x_libretro.so", "/roms/Chrono Trigger (USA).sfc"},
+		{[]string{"--libretro=mgba_libretro.so", "-f", "/roms/Metroid Fusion.gba"}, "mgba_libretro.so", "/roms/Metroid Fusion.gba"},
+		{[]string{"-c", "/home/user/retroarch.cfg", "--libretro", "genesis_plus_gx_libretro.so", "sonic.md"}, "genesis_plus_gx_libretro.so", "sonic.md"},
+		{[]string{"--menu"}, "", ""},
+	}
+	for _, tt := range tests {
+		core, content := parseRetroArchArgs(tt.args)
+		if core != tt.wantCore || content != tt.wantContent {
+			t.Errorf("parseRetroArchArgs(%q) = %q, %q, want %q, %q", tt.args, core, content, tt.wantCore, tt.wantContent)
+		}
+	}
+}
+
+func TestEmulatorContentDisplay(t *testing.T) {
+	tests := []struct {
+		core    string
+		content string
+		want    string
+	}{
+		{"/usr/lib/libretro/snes9x_libretro.so", "/roms/Chrono Trigger (USA) [!].sfc", "Chrono Trigger (SNES)"},
+		{"mupen64plus_next_libretro_android.so", "Super Mario 64 (Rev 1).z64", "Super Mario 64 (N64)"},
+		{"unknowncore_libretro.so", "Homebrew.bin", "Homebrew"},
+		{"snes9x_libretro.so", "", ""},
+	}
+	for _, tt := range tests {
+		c := emulatorContent{Emulator: "RetroArch", ROM: romTitle(tt.content), System: coreSystem(tt.core)}
+		if got := c.displayName(); got != tt.want {
+			t.Errorf("displayName(%q, %q) = %q, want %q", tt.core, tt.content, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// how long a subscriber gets to accept an event before it is dropped
+const eventWriteTimeout = 500 * time.Millisecond
+
+// Event is one state change, sent to subscribers as a line of JSON.
+type Event struct {
+	Type     string    `json:"type"` // detected, reconnected, cleared, or error
+	Time     time.Time `json:"time"`
+	Game     string    `json:"game,omitempty"`
+	ClientID string    `json:"client_id,omitempty"`
+	Pid      int       `json:"pid,omitempty"`
+	Error    string    `json:"error,omitempty"`
+}
+
+// eventHub serves newline-delimited JSON events on a local Unix socket.
+// events are written straight to each subscriber with a short deadline;
+// subscribers that can't keep up are dropped rather than buffered.
+// a nil hub discards events, so callers don't need to check if it's enabled.
+type eventHub struct {
+	listener net.Listener
+	mu       sync.Mutex
+	clients  map[net.Conn]struct{}
+}
+
+// listen on path and accept subscribers in the background.
+// a stale socket file left by a previous run is replaced.
+func newEventHub(path string) (*eventHub, error) {
+	if info, err := os.Lstat(path); err == nil && info.Mode()&os.ModeSocket != 0 {
+		os.Remove(path)
+	}
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, 0o600); err != nil {
+		listener.Close()
+		return nil, err
+	}
+	h := &eventHub{listener: listener, clients: make(map[net.Conn]struct{})}
+	go h.accept()
+	return h, nil
+}
+
+func (h *eventHub) accept() {
+	for {
+		conn, err := h.listener.Accept()
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				slog.Warn("Event socket stopped accepting subscribers", "err", err)
+			}
+			return
+		}
+		h.mu.Lock()
+		h.clients[conn] = struct{}{}
+		h.mu.Unlock()
+		slog.Debug("Event subscriber connected", "subscribers", h.subscriberCount())
+	}
+}
+
+// send an event to every subscriber, dropping any that fail to take it in time
+func (h *eventHub) publish(e Event) {
+	if h == nil {
+		return
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	line, err := json.Marshal(e)
+	if err != nil {
+		return
+	}
+	line = append(line, '\n')
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for conn := range h.clients {
+		conn.SetWriteDeadline(time.Now().Add(eventWriteTimeout))
+		if _, err := conn.Write(line); err != nil {
+			slog.Debug("Dropping event subscriber", "err", err)
+			conn.Close()
+			delete(h.clients, conn)
+		}
+	}
+}
+
+func (h *eventHub) subscriberCount() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.clients)
+}
+
+// stop listening, disconnect subscribers, and remove the socket file
+func (h *eventHub) close() {
+	if h == nil {
+		return
+	}
+	h.listener.Close()
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for conn := range h.clients {
+		conn.Close()
+		delete(h.clients, conn)
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestEventHubPublish(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.sock")
+	hub, err := newEventHub(path)
+	if err != nil {
+		t.Fatalf("newEventHub: %v", err)
+	}
+	defer hub.close()
+
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		t.Fatalf("dial event socket: %v", err)
+	}
+	defer conn.Close()
+
+	// wait for the accept loop to register the subscriber
+	deadline := time.Now().Add(2 * time.Second)
+	for hub.subscriberCount() == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("subscriber never registered")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	hub.publish(Event{Type: "detected", Game: "Balatro", ClientID: "123", Pid: 42})
+
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	line, err := bufio.NewReader(conn).ReadBytes('\n')
+	if err != nil {
+		t.Fatalf("read event: %v", err)
+	}
+	var got Event
+	if err := json.Unmarshal(line, &got); err != nil {
+		t.Fatalf("decode event %q: %v", line, err)
+	}
+	if got.Type != "detected" || got.Game != "Balatro" || got.ClientID != "123" || got.Pid != 42 || got.Time.IsZero() {
+		t.Errorf("event = %+v, want detected Balatro with a timestamp", got)
+	}
+}
+
+func TestEventHubDropsClosedSubscriber(t *testing.T) {
+	client, server := net.Pipe()
+	client.Close()
+
+	hub := &eventHub{clients: map[net.Conn]struct{}{server: {}}}
+	hub.publish(Event{Type: "cleared"})
+	if n := hub.subscriberCount(); n != 0 {
+		t.Errorf("subscriberCount = %d after a failed write, want 0", n)
+	}
+
+	// a nil hub discards events
+	var disabled *eventHub
+	disabled.publish(Event{Type: "cleared"})
+}
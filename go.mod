@@ -2,4 +2,7 @@ module discord-rpc-bridge
 
 go 1.25.4
 
-require golang.org/x/text v0.33.0
+require (
+	github.com/pelletier/go-toml/v2 v2.4.3
+	golang.org/x/text v0.33.0
+)
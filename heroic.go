@@ -0,0 +1,164 @@
+package main
+
+import (
+	"encoding/json"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// how long the parsed Heroic library is reused before re-reading its config
+const heroicReloadInterval = time.Minute
+
+// heroicGame is an installed Heroic title and the folder it lives in.
+type heroicGame struct {
+	Title       string
+	InstallPath string // slash-separated, no trailing slash
+	Store       string // platform label: Epic, GOG, or Heroic for sideloaded apps
+}
+
+var (
+	heroicGames    []heroicGame
+	heroicLoadedAt time.Time
+)
+
+// Heroic config roots for the native and Flatpak installs
+func heroicConfigDirs() []string {
+	dirs := []string{}
+	if configDir, err := os.UserConfigDir(); err == nil {
+		dirs = append(dirs, filepath.Join(configDir, "heroic"))
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		dirs = append(dirs, filepath.Join(home, ".var", "app", "com.heroicgameslauncher.hgl", "config", "heroic"))
+	}
+	return dirs
+}
+
+// read installed Epic (legendary), GOG, and sideloaded titles from a Heroic
+// config root. missing or unreadable files are skipped, so a machine without
+// Heroic yields nothing.
+func loadHeroicLibrary(dir string) []heroicGame {
+	var games []heroicGame
+	add := func(title string, installPath string, store string) {
+		installPath = normalizeHeroicPath(installPath)
+		if title == "" || installPath == "" {
+			return
+		}
+		games = append(games, heroicGame{Title: title, InstallPath: installPath, Store: store})
+	}
+
+	// Epic: app name -> install record, with the title inline
+	var legendary map[string]struct {
+		Title       string `json:"title"`
+		InstallPath string `json:"install_path"`
+	}
+	if readHeroicJSON(filepath.Join(dir, "legendaryConfig", "legendary", "installed.json"), &legendary) {
+		for _, game := range legendary {
+			add(game.Title, game.InstallPath, "Epic")
+		}
+	}
+
+	// GOG: installed.json has paths only; titles come from the library cache
+	var gogInstalled struct {
+		Installed []struct {
+			AppName     string `json:"appName"`
+			InstallPath string `json:"install_path"`
+		} `json:"installed"`
+	}
+	if readHeroicJSON(filepath.Join(dir, "gog_store", "installed.json"), &gogInstalled) {
+		titles := map[string]string{}
+		for _, path := range []string{
+			filepath.Join(dir, "store_cache", "gog_library.json"),
+			filepath.Join(dir, "gog_store", "library.json"),
+		} {
+			var library heroicLibraryFile
+			if readHeroicJSON(path, &library) {
+				for _, game := range library.Games {
+					titles[game.AppName] = game.Title
+				}
+			}
+		}
+		for _, game := range gogInstalled.Installed {
+			title := titles[game.AppName]
+			if title == "" {
+				// GOG folders are named after the game
+				title = filepath.Base(game.InstallPath)
+			}
+			add(title, game.InstallPath, "GOG")
+		}
+	}
+
+	// sideloaded apps: the install folder is the executable's directory
+	var sideload heroicLibraryFile
+	if readHeroicJSON(filepath.Join(dir, "sideload_apps", "library.json"), &sideload) {
+		for _, game := range sideload.Games {
+			if game.Install.Executable != "" {
+				add(game.Title, filepath.Dir(game.Install.Executable), "Heroic")
+			}
+		}
+	}
+	return games
+}
+
+// shape shared by Heroic's GOG library cache and sideload library
+type heroicLibraryFile struct {
+	Games []struct {
+		AppName string `json:"app_name"`
+		Title   string `json:"title"`
+		Install struct {
+			Executable string `json:"executable"`
+		} `json:"install"`
+	} `json:"games"`
+}
+
+// decode a Heroic JSON file into v. returns false if it's absent or invalid.
+func readHeroicJSON(path string, v any) bool {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return false
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		slog.Debug("Skipping unreadable Heroic config", "path", path, "err", err)
+		return false
+	}
+	return true
+}
+
+// convert host and wine paths to one slash-separated form for prefix checks.
+// drops a wine drive letter (ex: "Z:\home\..." -> "/home/...").
+func normalizeHeroicPath(path string) string {
+	path = strings.Trim(path, "\"'")
+	path = strings.ReplaceAll(path, "\\", "/")
+	if len(path) >= 2 && path[1] == ':' {
+		path = path[2:]
+	}
+	path = repeatedSlashes.ReplaceAllString(path, "/")
+	return strings.TrimSuffix(path, "/")
+}
+
+// the Heroic game whose install folder contains path
+func matchHeroicPath(games []heroicGame, path string) (heroicGame, bool) {
+	path = normalizeHeroicPath(path)
+	for _, game := range games {
+		if path == game.InstallPath || strings.HasPrefix(path, game.InstallPath+"/") {
+			return game, true
+		}
+	}
+	return heroicGame{}, false
+}
+
+// title and store of the Heroic game a process path belongs to, or "".
+// the library is re-read at most once per heroicReloadInterval.
+func heroicGameName(path string) (string, string) {
+	if time.Since(heroicLoadedAt) > heroicReloadInterval {
+		heroicGames = nil
+		for _, dir := range heroicConfigDirs() {
+			heroicGames = append(heroicGames, loadHeroicLibrary(dir)...)
+		}
+		heroicLoadedAt = time.Now()
+	}
+	game, _ := matchHeroicPath(heroicGames, path)
+	return game.Title, game.Store
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeTestFile(t *testing.T, path string, data string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoadHeroicLibrary(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, "legendaryConfig", "legendary", "installed.json"), `{
+		"Fortnite": {"app_name": "Fortnite", "title": "Hades", "install_path": "/home/user/Games/Heroic/Hades"}
+	}`)
+	writeTestFile(t, filepath.Join(dir, "gog_store", "installed.json"), `{
+		"installed": [
+			{"appName": "1207658924", "install_path": "/mnt/games/GOG/Celeste"},
+			{"appName": "999", "install_path": "/mnt/games/GOG/Untitled Folder/"}
+		]
+	}`)
+	writeTestFile(t, filepath.Join(dir, "store_cache", "gog_library.json"), `{
+		"games": [{"app_name": "1207658924", "title": "Celeste"}]
+	}`)
+	writeTestFile(t, filepath.Join(dir, "sideload_apps", "library.json"), `{
+		"games": [{"app_name": "abc", "title": "Hollow Knight", "install": {"executable": "/opt/hk/hollow_knight.x86_64"}}]
+	}`)
+
+	games := loadHeroicLibrary(dir)
+	if len(games) != 4 {
+		t.Fatalf("loadHeroicLibrary returned %d games, want 4: %+v", len(games), games)
+	}
+
+	tests := []struct {
+		path  string
+		want  string
+		store string
+	}{
+		{"/home/user/Games/Heroic/Hades/Hades.exe", "Hades", "Epic"},
+		{"Z:\\home\\user\\Games\\Heroic\\Hades\\x64\\Hades.exe", "Hades", "Epic"},
+		{"/mnt/games/GOG/Celeste/Celeste.bin.x86_64", "Celeste", "GOG"},
+		{"/mnt/games/GOG/Untitled Folder/game", "Untitled Folder", "GOG"},
+		{"/opt/hk/hollow_knight.x86_64", "Hollow Knight", "Heroic"},
+		{"/home/user/Games/Heroic/HadesII/Hades2.exe", "", ""},
+		{"/usr/bin/bash", "", ""},
+	}
+	for _, tt := range tests {
+		got, _ := matchHeroicPath(games, tt.path)
+		if got.Title != tt.want || got.Store != tt.store {
+			t.Errorf("matchHeroicPath(%q) = %q (%s), want %q (%s)", tt.path, got.Title, got.Store, tt.want, tt.store)
+		}
+	}
+}
+
+func TestLoadHeroicLibraryMissing(t *testing.T) {
+	if games := loadHeroicLibrary(filepath.Join(t.TempDir(), "absent")); len(games) != 0 {
+		t.Errorf("loadHeroicLibrary on a missing dir = %+v, want none", games)
+	}
+}
@@ -4,24 +4,37 @@ import (
 	"bufio"
 	"bytes"
 	"context"
+	"crypto/hmac"
+	crand "crypto/rand"
+	"crypto/sha256"
 	"encoding/binary"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
+	"math/rand"
 	"net"
 	"net/http"
+	"net/url"
 	"os"
 	"os/signal"
+	"path"
 	"path/filepath"
 	"regexp"
 	"runtime"
+	"slices"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 	"unicode"
+	"unicode/utf8"
 
 	"golang.org/x/text/runes"
 	"golang.org/x/text/transform"
@@ -30,34 +43,308 @@ import (
 
 var version = "dev"
 
+// built-in state line. device_state_template only replaces this one, never a
+// state_template the user set
+const defaultStateTemplate = "On {os}"
+
 var (
-	discordApiUrl = "https://discord.com/api/v10/applications/detectable"
-	scanInterval  = 15 * time.Second
-	gameCacheTTL  = 7 * 24 * time.Hour
-	ignoredGames  = map[string]bool{}
+	discordApiVersion = 10
+	discordApiUrl     = "https://discord.com/api/v10/applications/detectable"
+	scanInterval      = 15 * time.Second
+	gameCacheTTL      = 7 * 24 * time.Hour
+	// always download the game list; never read or write the cache file
+	disableCache = false
+	// when to stretch the scan interval to powerSaveInterval: off, battery, or always
+	powerSave         = "off"
+	powerSaveInterval = time.Minute
+	powerSupplyDir    = "/sys/class/power_supply"
+	// normalized game name -> scan interval used while that game is detected
+	scanIntervalOverrides = map[string]time.Duration{}
+	ignoredGames          = map[string]bool{} // normalized folder names
+	allowedGames          = map[string]bool{} // normalized names; when non-empty, only these are presented
+	gamePriority          = map[string]int{}  // normalized name -> rank in game_priority, 0 first
 	// folder-name prefixes that are always Steam infrastructure, not games.
 	// covers SteamLinuxRuntime{,_soldier,_sniper,_4,...} and Proton {7,8,9,Experimental,Hotfix,...}
 	ignoredGamePrefixes = []string{"SteamLinuxRuntime", "Proton"}
-	ignoredProcesses    = map[string]bool{
-		"gamescopereaper":      true,
-		"reaper":               true,
-		"steam-launch-wrapper": true,
-		"pressure-vessel-wrap": true,
-	}
-	manualMappings    = map[string]string{}
+	ignoredProcesses    = builtinIgnoredProcesses()
+	launcherProcesses   = builtinLauncherProcesses()
+	manualMappings      = map[string]string{}
+	// user-registered Discord app used for games with no match (empty = none)
+	defaultClientID = ""
+	detailsTemplate = "{verb} {game}"
+	stateTemplate   = defaultStateTemplate
+	// state line used instead of state_template when the game runs on a
+	// device Steam reports (empty = always use state_template)
+	deviceStateTemplate = "On {device}"
+	// details line for unmatched games presented through default_client_id,
+	// which shouldn't name a game the app doesn't know (empty = details_template)
+	genericDetailsTemplate = "Playing a game"
+	largeTextTemplate      = ""                          // empty = game name
+	gameTemplates          = map[string]TemplateConfig{} // normalized game name -> template overrides
+	// strip ™/® and extra whitespace from displayed game names
+	sanitizeDisplayNames = false
+	platformImages       = map[string]string{}   // platform label -> small image asset key
+	distroImages         = builtinDistroImages() // os-release ID -> small image asset key
+	// show the distro logo as the small image when no platform image is set
+	distroSmallImage = false
+	// os-release ID then ID_LIKE entries, most specific first
+	distroIDs      []string
+	appCategories  = map[string]string{}         // normalized game name -> category
+	assetOverrides = map[string]ActivityAssets{} // normalized game name -> assets
+	activityExtras = map[string]ActivityExtras{} // normalized game name -> party/secrets
+	// set the activity instance flag for every game (activity_extras can override per game)
+	activityInstance = false
+	// send the game's display name as the activity name
+	activityName = false
+	// send the game's start time so Discord shows an elapsed timer
+	showElapsedTime = false
+	// large image sources in priority order; see largeImageFor
+	imageSources      = builtinImageSources()
+	serverExecutables = map[string]map[string]bool{} // normalized game name -> lowercased server exe basenames
+	// skip dedicated servers instead of presenting them as "server" category
+	ignoreServers         = false
+	categoryVerbs         = builtinCategoryVerbs()
+	categoryActivityTypes = builtinCategoryActivityTypes()
+	// matches from processes younger than this are ignored, to debounce
+	// installers, shader pre-compilation, and file verification briefly
+	// running from a game folder
+	minProcessAge = 5 * time.Second
+	// only scan processes owned by the invoking user unless enabled. avoids
+	// reading (and logging) other users' exe paths when run as root
+	scanAllUsers = false
+	// log a heartbeat after this long without a presence change (0 disables)
+	heartbeatInterval time.Duration
+	// explicit Discord IPC socket path, bypassing discovery when set
+	socketPathOverride = ""
+	// fall back to discovery when the explicit socket can't be dialed
+	socketFallback = true
+	// IPC handshake protocol version. Discord currently only speaks v1
+	handshakeVersion = 1
+	// how command nonces are generated; see nonceStrategies
+	nonceStrategy = "counter"
+	newNonce      = nonceStrategies[nonceStrategy]
+	// Discord client to prefer during socket discovery: auto, stable, ptb, or canary
+	discordFlavor = "auto"
+	// extra directories probed for discord-ipc-0..9 after the built-in candidates
+	socketDirs []string
+	// log every IPC frame sent and received at debug level (-trace-ipc)
+	traceIPC = false
+	// log a short hash in place of game names (log_anonymize_games). presence
+	// sent to Discord is unchanged
+	anonymizeGames = false
+	// how games with no Discord app are handled; see unmatchedPolicies
+	unmatchedPolicy = unmatchedSkip
+	// what to do with activity text over Discord's limit: truncate or drop
+	textOverflow = "truncate"
+	// consecutive ticks a different game must be seen before switching to it
+	switchDebounceTicks = 2
+	// reconnect on a game switch even when both games share a client ID, so
+	// Discord starts a fresh activity instead of updating the current one
+	reconnectOnSwitch = false
+	// consecutive handshake rejections before a client ID is blacklisted
+	// (0 disables), and for how long
+	handshakeFailureLimit = 3
+	handshakeBlacklistFor = 30 * time.Minute
+	// how long to keep presence after the game stops being detected
+	exitGracePeriod time.Duration
+	// how long a game must be continuously detected before it's presented
+	minSession time.Duration
+	// how unmatched names are retried after the exact lookup; see matchStrategies
+	matchStrategy     = "exact"
 	nameToID          = make(map[string]string)
+	tokenSetToID      = make(map[string]string)             // tokenSetKey -> client ID, for match_strategy token_set
+	exeToApp          = make(map[string][]listedExecutable) // lowercased linux exe basename -> every listed executable with it
+	nameCollisions    = make(map[string][]string)           // normalized name -> every client ID that shares it
+	detectableApps    []DetectableApp                       // full game list as last loaded
+	appsByID          = make(map[string]DetectableApp)
 	nonAlphanumeric   = regexp.MustCompile(`[^a-z0-9]`)
+	repeatedSlashes   = regexp.MustCompile(`/{2,}`)
 	httpClient        = &http.Client{Timeout: 30 * time.Second}
 	accentTransformer = transform.Chain(norm.NFD, runes.Remove(runes.In(unicode.Mn)), norm.NFC)
 )
 
+// wrapper processes that carry game paths in their cmdline but aren't games
+func builtinIgnoredProcesses() map[string]bool {
+	return map[string]bool{
+		"gamescopereaper":      true,
+		"reaper":               true,
+		"steam-launch-wrapper": true,
+		"pressure-vessel-wrap": true,
+	}
+}
+
+// Steam client and launcher helpers that run from under watched paths.
+// kept separate from ignoredProcesses so users can extend either without
+// restating the other.
+func builtinLauncherProcesses() map[string]bool {
+	return map[string]bool{
+		"steam":                true,
+		"steamwebhelper":       true,
+		"steamerrorreporter":   true,
+		"steamerrorreporter64": true,
+		"gldriverquery":        true,
+		"gldriverquery64":      true,
+		"vulkandriverquery":    true,
+		"vulkandriverquery64":  true,
+		"fossilize_replay":     true,
+	}
+}
+
+// large image priority when image_sources isn't set
+func builtinImageSources() []string {
+	return []string{imageOverride, imageSteamGridDB, imageIcon, imageDefault}
+}
+
+// category -> {verb} token. matches without a category are "game"
+func builtinCategoryVerbs() map[string]string {
+	return map[string]string{
+		"game":        "Playing",
+		"application": "Using",
+		"streaming":   "Streaming with",
+		"music":       "Listening to",
+		"video":       "Watching",
+		"server":      "Hosting",
+	}
+}
+
+// category -> Discord activity type. categories not listed are Playing
+func builtinCategoryActivityTypes() map[string]int {
+	return map[string]int{
+		"music": activityListening,
+		"video": activityWatching,
+	}
+}
+
+// rebuild every config-merged collection from its built-in entries, so a
+// (re)load reflects only the current config. without this, entries removed
+// from config would linger until restart.
+func resetConfigCollections() {
+	scanIntervalOverrides = map[string]time.Duration{}
+	ignoredGames = map[string]bool{}
+	allowedGames = map[string]bool{}
+	gamePriority = map[string]int{}
+	ignoredProcesses = builtinIgnoredProcesses()
+	launcherProcesses = builtinLauncherProcesses()
+	manualMappings = map[string]string{}
+	gameTemplates = map[string]TemplateConfig{}
+	platformImages = map[string]string{}
+	distroImages = builtinDistroImages()
+	appCategories = map[string]string{}
+	assetOverrides = map[string]ActivityAssets{}
+	activityExtras = map[string]ActivityExtras{}
+	imageSources = builtinImageSources()
+	serverExecutables = map[string]map[string]bool{}
+	categoryVerbs = builtinCategoryVerbs()
+	categoryActivityTypes = builtinCategoryActivityTypes()
+	coreSystems = builtinCoreSystems()
+	cloudPatterns = builtinCloudPatterns()
+	socketDirs = nil
+	mediaProcesses = builtinMediaProcesses()
+	mediaCategories = map[string]bool{}
+}
+
+// a func that puts a setting back to the value it had when this was called
+func defaultOf[T any](setting *T) func() {
+	value := *setting
+	return func() { *setting = value }
+}
+
+// restores for every scalar setting loadConfig sets, captured from their
+// initial values before any config is read
+var configScalarDefaults = []func(){
+	defaultOf(&anonymizeGames), defaultOf(&scanInterval), defaultOf(&powerSave), defaultOf(&powerSaveInterval),
+	defaultOf(&matchStrategy), defaultOf(&textOverflow), defaultOf(&defaultClientID), defaultOf(&unmatchedPolicy),
+	defaultOf(&discordApiVersion), defaultOf(&discordApiUrl), defaultOf(&handshakeVersion),
+	defaultOf(&nonceStrategy), defaultOf(&newNonce), defaultOf(&gameCacheTTL), defaultOf(&disableCache),
+	defaultOf(&minProcessAge), defaultOf(&exitGracePeriod), defaultOf(&minSession), defaultOf(&switchDebounceTicks),
+	defaultOf(&handshakeFailureLimit), defaultOf(&handshakeBlacklistFor), defaultOf(&reconnectOnSwitch),
+	defaultOf(&heartbeatInterval), defaultOf(&scanAllUsers), defaultOf(&socketPathOverride), defaultOf(&socketFallback),
+	defaultOf(&discordFlavor), defaultOf(&detailsTemplate), defaultOf(&stateTemplate), defaultOf(&deviceStateTemplate),
+	defaultOf(&genericDetailsTemplate), defaultOf(&largeTextTemplate), defaultOf(&mediaDetailsTemplate),
+	defaultOf(&sanitizeDisplayNames), defaultOf(&ignoreServers), defaultOf(&cloudGaming), defaultOf(&distroSmallImage),
+	defaultOf(&activityInstance), defaultOf(&activityName), defaultOf(&showElapsedTime), defaultOf(&steamGridDBKey),
+}
+
+// put every scalar setting back to its built-in value. like
+// resetConfigCollections, so a setting removed from config reverts on reload
+// instead of keeping its old value.
+func resetConfigScalars() {
+	for _, restore := range configScalarDefaults {
+		restore()
+	}
+}
+
 type Config struct {
-	ScanIntervalSeconds int               `json:"scan_interval_seconds"`
-	IgnoredGames        []string          `json:"ignored_games"`
-	IgnoredProcesses    []string          `json:"ignored_processes"`
-	DiscordApiVersion   int               `json:"discord_api_version"`
-	GameCacheTTLDays    int               `json:"game_cache_ttl_days"`
-	ManualMappings      map[string]string `json:"manual_mappings"`
+	ScanIntervalSeconds    int                       `json:"scan_interval_seconds"`
+	ScanIntervalOverrides  map[string]int            `json:"scan_interval_overrides"`
+	PowerSave              string                    `json:"power_save"`
+	PowerSaveSeconds       int                       `json:"power_save_interval_seconds"`
+	IgnoredGames           []string                  `json:"ignored_games"`
+	AllowedGames           []string                  `json:"allowed_games"`
+	GamePriority           []string                  `json:"game_priority"`
+	IgnoreFile             string                    `json:"ignore_file"`
+	AllowFile              string                    `json:"allow_file"`
+	IgnoredProcesses       []string                  `json:"ignored_processes"`
+	LauncherProcesses      []string                  `json:"launcher_processes"`
+	DiscordApiVersion      int                       `json:"discord_api_version"`
+	HandshakeVersion       int                       `json:"handshake_version"`
+	NonceStrategy          string                    `json:"nonce_strategy"`
+	GameCacheTTLDays       int                       `json:"game_cache_ttl_days"`
+	DisableCache           bool                      `json:"disable_cache"`
+	ManualMappings         map[string]string         `json:"manual_mappings"`
+	MatchStrategy          string                    `json:"match_strategy"`
+	TextOverflow           string                    `json:"text_overflow"`
+	DefaultClientID        string                    `json:"default_client_id"`
+	UnmatchedPolicy        string                    `json:"unmatched_policy"`
+	DetailsTemplate        string                    `json:"details_template"`
+	StateTemplate          string                    `json:"state_template"`
+	LargeTextTemplate      string                    `json:"large_text_template"`
+	DeviceStateTemplate    *string                   `json:"device_state_template"`
+	GenericDetailsTemplate *string                   `json:"generic_details_template"`
+	GameTemplates          map[string]TemplateConfig `json:"game_templates"`
+	SanitizeDisplayNames   bool                      `json:"sanitize_display_names"`
+	AppCategories          map[string]string         `json:"app_categories"`
+	CategoryVerbs          map[string]string         `json:"category_verbs"`
+	CategoryActivityTypes  map[string]int            `json:"category_activity_types"`
+	PlatformImages         map[string]string         `json:"platform_images"`
+	DistroSmallImage       bool                      `json:"distro_small_image"`
+	DistroImages           map[string]string         `json:"distro_images"`
+	AssetOverrides         map[string]ActivityAssets `json:"asset_overrides"`
+	SteamGridDBKey         string                    `json:"steamgriddb_key"`
+	ImageSources           []string                  `json:"image_sources"`
+	ActivityInstance       bool                      `json:"activity_instance"`
+	ActivityName           bool                      `json:"activity_name"`
+	ShowElapsedTime        bool                      `json:"show_elapsed_time"`
+	ActivityExtras         map[string]ActivityExtras `json:"activity_extras"`
+	MinProcessAgeSeconds   *int                      `json:"min_process_age_seconds"`
+	ExitGracePeriodSeconds int                       `json:"exit_grace_period_seconds"`
+	MinSessionSeconds      int                       `json:"min_session_seconds"`
+	LogAnonymizeGames      bool                      `json:"log_anonymize_games"`
+	SwitchDebounceTicks    int                       `json:"switch_debounce_ticks"`
+	ReconnectOnSwitch      bool                      `json:"reconnect_on_switch"`
+	HandshakeFailureLimit  *int                      `json:"handshake_failure_limit"`
+	HandshakeBlacklistMins int                       `json:"handshake_blacklist_minutes"`
+	ScanAllUsers           bool                      `json:"scan_all_users"`
+	HeartbeatMinutes       int                       `json:"heartbeat_minutes"`
+	SocketPath             string                    `json:"socket_path"`
+	SocketFallback         *bool                     `json:"socket_fallback"`
+	SocketDirs             []string                  `json:"socket_dirs"`
+	DiscordFlavor          string                    `json:"discord_flavor"`
+	CoreSystems            map[string]string         `json:"core_systems"`
+	ServerExecutables      map[string][]string       `json:"server_executables"`
+	IgnoreServers          bool                      `json:"ignore_servers"`
+	CloudGaming            bool                      `json:"cloud_gaming"`
+	CloudTitlePatterns     []CloudTitlePattern       `json:"cloud_title_patterns"`
+	MediaPresence          []string                  `json:"media_presence"`
+	MediaProcesses         map[string]string         `json:"media_processes"`
+	MediaDetailsTemplate   *string                   `json:"media_details_template"`
+}
+
+// per-game presence templates. empty fields use the global template.
+type TemplateConfig struct {
+	Details   string `json:"details"`
+	State     string `json:"state"`
+	LargeText string `json:"large_text"`
 }
 
 type Executable struct {
@@ -68,23 +355,120 @@ type Executable struct {
 type DetectableApp struct {
 	ID          string       `json:"id"`
 	Name        string       `json:"name"`
+	Icon        string       `json:"icon,omitempty"`
+	CoverImage  string       `json:"cover_image,omitempty"`
 	Executables []Executable `json:"executables"`
 }
 
 type ActivityAssets struct {
-	LargeImage string `json:"large_image"`
-	LargeText  string `json:"large_text"`
+	LargeImage string `json:"large_image,omitempty"`
+	LargeText  string `json:"large_text,omitempty"`
+	SmallImage string `json:"small_image,omitempty"`
+	SmallText  string `json:"small_text,omitempty"`
+}
+
+type ActivityParty struct {
+	ID   string `json:"id,omitempty"`
+	Size []int  `json:"size,omitempty"` // [current, max]
+	// partyPrivate (the default, omitted) or partyPublic
+	Privacy int `json:"privacy,omitempty"`
+}
+
+// Discord party privacy values
+const (
+	partyPrivate = 0
+	partyPublic  = 1
+)
+
+// start (and optional end) of the activity in unix milliseconds. Discord
+// shows "elapsed" from start. created_at is filled in by Discord itself.
+type ActivityTimestamps struct {
+	Start int64 `json:"start,omitempty"`
+	End   int64 `json:"end,omitempty"`
+}
+
+type ActivitySecrets struct {
+	Join     string `json:"join,omitempty"`
+	Spectate string `json:"spectate,omitempty"`
+	Match    string `json:"match,omitempty"`
 }
 
 type Activity struct {
-	Details string         `json:"details"`
-	State   string         `json:"state"`
-	Assets  ActivityAssets `json:"assets"`
+	// the bold title line. omitted unless activity_name or a per-game name
+	// is set, which leaves Discord showing the app's name
+	Name    string `json:"name,omitempty"`
+	Type    int    `json:"type,omitempty"` // see activityPlaying etc.
+	Details string `json:"details,omitempty"`
+	State   string `json:"state,omitempty"`
+	// unset sub-objects are omitted entirely; Discord can reject empty ones
+	Assets *ActivityAssets `json:"assets,omitempty"`
+	// set when show_elapsed_time is on
+	Timestamps *ActivityTimestamps `json:"timestamps,omitempty"`
+	Party      *ActivityParty      `json:"party,omitempty"`
+	Secrets    *ActivitySecrets    `json:"secrets,omitempty"`
+	// whether the activity is an instanced game session. omitted when false,
+	// which is what Discord assumes
+	Instance bool `json:"instance,omitempty"`
+	// link buttons, from a sidecar presence file. Discord won't take them
+	// together with secrets
+	Buttons []ActivityButton `json:"buttons,omitempty"`
+}
+
+type ActivityButton struct {
+	Label string `json:"label"`
+	URL   string `json:"url"`
+}
+
+// Discord activity types accepted over RPC. the type picks the profile
+// header (ex: "Listening to"). streaming (1) and custom (4) can't be set
+// by RPC clients.
+const (
+	activityPlaying   = 0
+	activityListening = 2
+	activityWatching  = 3
+	activityCompeting = 5
+)
+
+// optional per-game party/secrets. setting these makes Discord show the
+// "Ask to Join" button; the bridge doesn't broker the join itself.
+type ActivityExtras struct {
+	Name     string           `json:"name,omitempty"` // activity name, sent even without activity_name
+	Party    *ActivityParty   `json:"party"`
+	Secrets  *ActivitySecrets `json:"secrets"`
+	Instance *bool            `json:"instance,omitempty"` // overrides activity_instance
 }
 
 type ActivityArgs struct {
-	Pid      int      `json:"pid"`
-	Activity Activity `json:"activity"`
+	Pid int `json:"pid"`
+	// nil clears the activity; Discord expects "activity": null for that
+	Activity *Activity `json:"activity"`
+}
+
+// a running game found by scanProcesses
+type DetectedGame struct {
+	Name     string // folder name used for client ID lookup
+	Pid      int
+	Platform string // launcher/store the game was detected under (ex: Steam), empty if unknown
+	AppID    string // Steam appid, empty if unknown
+	Generic  bool   // unmatched game presented neutrally through default_client_id
+	ClientID string // Discord app the game is presented through, once resolved
+	ListedID string // Discord app whose listed executable the process runs, empty if detected another way
+	Method   string // how it was detected: registry, cgroup, exe, cmdline, bottles, emulator, cloud, media, forced, or state
+	Server   bool   // a dedicated server listed in server_executables
+	Device   string // "Steam Deck" or "Steam Big Picture" from Steam's environment hints, empty on the desktop
+	Category string // set for media apps, ahead of app_categories
+	Media    string // what a media app is playing, from MPRIS
+	// when the game's session started: its process start, kept across
+	// restarts within the exit grace period. zero falls back to the
+	// process start
+	SessionStart time.Time
+	// from the Steam appmanifest, zero for non-Steam games
+	LastPlayed  time.Time
+	InstallSize int64 // bytes on disk
+	// emulator content, empty for regular games
+	ROM         string
+	System      string
+	DisplayName string // shown instead of Name when set (ex: "Chrono Trigger (SNES)")
 }
 
 // IPC structs
@@ -100,137 +484,550 @@ type DiscordRpcPayload struct {
 	Args  interface{} `json:"args"`
 }
 
-// populate lookup for game client ID
+// populate lookup for game client ID.
+// when several apps normalize to the same key (ex: "Game" and "Game™"), the
+// winner is picked by preferApp so it doesn't depend on API response order.
+// the maps are built fresh and swapped in whole, so a reload drops games
+// that left the list.
 func populateMap(apps []DetectableApp) {
+	byID := make(map[string]DetectableApp, len(apps))
+	collisions := make(map[string][]string)
+	winners := make(map[string]DetectableApp, len(apps))
+	for _, app := range apps {
+		byID[app.ID] = app
+		key := normalizeGameName(app.Name)
+		prev, seen := winners[key]
+		if !seen {
+			winners[key] = app
+			continue
+		}
+		if collisions[key] == nil {
+			collisions[key] = []string{prev.ID}
+		}
+		collisions[key] = append(collisions[key], app.ID)
+		if preferApp(app, prev) {
+			winners[key] = app
+		}
+	}
+	ids := make(map[string]string, len(winners))
+	for key, app := range winners {
+		ids[key] = app.ID
+	}
+	tokenWinners := make(map[string]DetectableApp, len(winners))
+	for _, app := range winners {
+		key := tokenSetKey(app.Name)
+		if prev, seen := tokenWinners[key]; key != "" && (!seen || preferApp(app, prev)) {
+			tokenWinners[key] = app
+		}
+	}
+	tokenIDs := make(map[string]string, len(tokenWinners))
+	for key, app := range tokenWinners {
+		tokenIDs[key] = app.ID
+	}
+	detectableApps, appsByID, nameToID, tokenSetToID, nameCollisions = apps, byID, ids, tokenIDs, collisions
+	exeToApp = indexExecutables(apps)
+
+	keys := make([]string, 0, len(nameCollisions))
+	for key := range nameCollisions {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		slog.Debug("Normalized name collision", "name", loggedGame(key), "ids", nameCollisions[key], "winner", nameToID[key])
+	}
+	slog.Info("Indexed known games", "count", len(nameToID), "apps", appCount(), "with_assets", appsWithAssets(), "name_collisions", len(nameCollisions))
+}
+
+// a linux executable from the game list
+type listedExecutable struct {
+	Path string // lowercased, without the leading "/" or launcher ">" marker (ex: "hades/hades.x86_64")
+	App  DetectableApp
+}
+
+// true if a process running exePath runs this executable. the listed
+// directories (ex: "hades/" in "hades/Hades.x86_64") are what tell apps
+// apart, so they must end the exe path; a bare name matches by basename.
+func (e listedExecutable) matches(exePath string) bool {
+	exePath = strings.ToLower(exePath)
+	if !strings.Contains(e.Path, "/") {
+		return path.Base(exePath) == e.Path
+	}
+	return strings.HasSuffix(exePath, "/"+e.Path)
+}
+
+// index the game list's linux executables by basename
+func indexExecutables(apps []DetectableApp) map[string][]listedExecutable {
+	index := make(map[string][]listedExecutable)
 	for _, app := range apps {
-		nameToID[normalizeGameName(app.Name)] = app.ID
+		for _, exe := range app.Executables {
+			if exe.OS != "linux" {
+				continue
+			}
+			listed := strings.TrimLeft(path.Clean(strings.ToLower(strings.TrimPrefix(exe.Name, ">"))), "/")
+			base := path.Base(listed)
+			if listed == "" || base == "." || base == "/" {
+				continue
+			}
+			if slices.ContainsFunc(index[base], func(e listedExecutable) bool { return e.Path == listed && e.App.ID == app.ID }) {
+				continue
+			}
+			index[base] = append(index[base], listedExecutable{Path: listed, App: app})
+		}
+	}
+	return index
+}
+
+// the app whose linux executable a process runs. the longest listed path
+// that matches wins; two apps tied on it (ex: both list a bare
+// "game.x86_64") can't be told apart, so neither is. media players are left
+// to media presence.
+func appForExecutable(exePath string) (DetectableApp, bool) {
+	base := strings.ToLower(filepath.Base(exePath))
+	if _, media := mediaProcesses[base]; media {
+		return DetectableApp{}, false
+	}
+	var best listedExecutable
+	ambiguous := false
+	for _, exe := range exeToApp[base] {
+		switch {
+		case !exe.matches(exePath), len(exe.Path) < len(best.Path):
+		case len(exe.Path) > len(best.Path):
+			best, ambiguous = exe, false
+		case exe.App.ID != best.App.ID:
+			ambiguous = true
+		}
+	}
+	if best.Path == "" || ambiguous {
+		return DetectableApp{}, false
+	}
+	return best.App, true
+}
+
+// number of apps in the loaded game list
+func appCount() int {
+	return len(detectableApps)
+}
+
+// number of loaded apps that have an icon or cover image on Discord
+func appsWithAssets() int {
+	count := 0
+	for _, app := range detectableApps {
+		if app.Icon != "" || app.CoverImage != "" {
+			count++
+		}
+	}
+	return count
+}
+
+// look up a loaded app by its Discord client ID
+func appByID(id string) (DetectableApp, bool) {
+	app, ok := appsByID[id]
+	return app, ok
+}
+
+// look up the app a game name resolves to, after collision handling
+func appByName(name string) (DetectableApp, bool) {
+	id, ok := nameToID[normalizeGameName(name)]
+	if !ok {
+		return DetectableApp{}, false
+	}
+	return appByID(id)
+}
+
+// returns true if a should win over b for the same normalized name.
+// prefers the longer original name (usually the more specific/official title),
+// then the older app (shorter, then lexically smaller snowflake ID).
+// manual_mappings is the escape hatch when this picks the wrong one.
+func preferApp(a DetectableApp, b DetectableApp) bool {
+	if len(a.Name) != len(b.Name) {
+		return len(a.Name) > len(b.Name)
 	}
-	log.Printf("Indexed %d known games.", len(nameToID))
+	if len(a.ID) != len(b.ID) {
+		return len(a.ID) < len(b.ID)
+	}
+	return a.ID < b.ID
+}
+
+// fewest apps a game list may have to be trusted. Discord's list has tens of
+// thousands; anything this small is an error response or a truncated file.
+const minDetectableApps = 100
+
+// where and how the game list is loaded. copied from the settings before a
+// background load starts, so a SIGHUP reloading the config mid-fetch can't
+// change them under it.
+type gameListSource struct {
+	CacheFile string
+	URL       string
+	TTL       time.Duration
+	NoCache   bool
+}
+
+// the game list source for the current settings
+func currentGameListSource(cacheFile string) gameListSource {
+	return gameListSource{CacheFile: cacheFile, URL: discordApiUrl, TTL: gameCacheTTL, NoCache: disableCache}
 }
 
 // load game JSON from cache or build cache from Discord API call
 func loadGameData(cacheFile string) error {
+	apps, err := loadGameApps(currentGameListSource(cacheFile))
+	if err != nil {
+		return err
+	}
+	populateMap(apps)
+	return nil
+}
+
+// the game list from cache, refreshing the cache from the Discord API when
+// it's missing, stale, or too small. doesn't touch the lookup maps, so it's
+// safe to call off the scan loop's goroutine.
+func loadGameApps(src gameListSource) ([]DetectableApp, error) {
+	if src.NoCache {
+		apps, _, err := fetchGameList(src.URL, io.Discard)
+		if err != nil {
+			return nil, fmt.Errorf("fetch game list (cache disabled): %w", err)
+		}
+		return apps, nil
+	}
+
 	shouldUpdate := false
-	info, err := os.Stat(cacheFile)
+	info, err := os.Stat(src.CacheFile)
 
 	if os.IsNotExist(err) {
 		shouldUpdate = true // file not exist
 	} else if err == nil {
 		// file exists, check if stale
-		if time.Since(info.ModTime()) > gameCacheTTL {
-			log.Println("Game list cache expired. Refreshing...")
+		if time.Since(info.ModTime()) > src.TTL {
+			slog.Info("Game list cache expired. Refreshing...")
 			shouldUpdate = true
 		}
 	}
 
 	if shouldUpdate {
-		if err := refreshGameCache(cacheFile); err != nil {
-			log.Printf("Cache refresh failed: %v. Using existing cache if present.", err)
+		if _, err := refreshGameCache(src); err != nil {
+			slog.Warn("Cache refresh failed. Using existing cache if present.", "err", err)
 		}
 	}
 
 	// load from disk
-	file, err := os.ReadFile(cacheFile)
+	apps, err := readGameCache(src.CacheFile)
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	// an empty or tiny cache (ex: from an old failed fetch) would silently
+	// match nothing, so replace it instead of trusting it
+	if len(apps) < minDetectableApps && !shouldUpdate {
+		slog.Warn("Game list cache is suspiciously small. Refreshing...", "apps", len(apps), "min", minDetectableApps)
+		if fresh, err := refreshGameCache(src); err == nil {
+			apps = fresh
+		} else {
+			slog.Warn("Cache refresh failed.", "err", err)
+		}
 	}
+	if len(apps) < minDetectableApps {
+		return nil, fmt.Errorf("game list %s has only %d apps (want at least %d); delete it or run with -refresh-cache", src.CacheFile, len(apps), minDetectableApps)
+	}
+	return apps, nil
+}
 
+// decode the cached game list
+func readGameCache(cacheFile string) ([]DetectableApp, error) {
+	file, err := os.ReadFile(cacheFile)
+	if err != nil {
+		return nil, err
+	}
 	var apps []DetectableApp
 	if err := json.Unmarshal(file, &apps); err != nil {
-		return err
+		return nil, err
 	}
-
-	populateMap(apps)
-	return nil
+	return apps, nil
 }
 
-// download a fresh game list from Discord and write it to cacheFile.
-// validates HTTP status and a non-empty list before overwriting any
+// download a fresh game list from Discord and write it to the cache file.
+// validates HTTP status and a plausibly complete list before overwriting any
 // existing cache, to avoid poisoning it with an error response body.
-func refreshGameCache(cacheFile string) error {
-	log.Println("Downloading game list from Discord...")
-	resp, err := httpClient.Get(discordApiUrl)
+func refreshGameCache(src gameListSource) ([]DetectableApp, error) {
+	// tee the body into a temp file next to the cache while decoding, so the
+	// payload is never held in memory twice. the temp file only replaces the
+	// cache once the list checks out.
+	tmp, err := os.CreateTemp(filepath.Dir(src.CacheFile), ".games-*.json")
 	if err != nil {
-		return err
+		return nil, fmt.Errorf("create cache: %w", err)
+	}
+	defer os.Remove(tmp.Name()) // no-op after the rename
+	defer tmp.Close()
+
+	apps, size, err := fetchGameList(src.URL, tmp)
+	if err != nil {
+		return nil, err
+	}
+	if err := tmp.Close(); err != nil {
+		return nil, fmt.Errorf("write cache: %w", err)
+	}
+	info, err := os.Stat(tmp.Name())
+	if err != nil {
+		return nil, fmt.Errorf("write cache: %w", err)
+	}
+	if info.Size() != size {
+		return nil, fmt.Errorf("wrote %d of %d response bytes to cache", info.Size(), size)
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return nil, fmt.Errorf("write cache: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), src.CacheFile); err != nil {
+		return nil, fmt.Errorf("write cache: %w", err)
+	}
+	slog.Info("Cache updated successfully", "apps", len(apps), "bytes", size)
+	return apps, nil
+}
+
+// download and decode the game list at url, copying the raw response body to
+// w. returns the apps and the response size.
+func fetchGameList(url string, w io.Writer) ([]DetectableApp, int64, error) {
+	slog.Info("Downloading game list from Discord...", "url", url)
+	// don't set Accept-Encoding here: the default transport only requests
+	// gzip and transparently decompresses it when the header is left unset
+	resp, err := httpClient.Get(url)
+	if err != nil {
+		return nil, 0, err
 	}
 	defer resp.Body.Close()
+	slog.Debug("Game list response", "status", resp.StatusCode, "gzip", resp.Uncompressed)
 
 	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("unexpected status %d from %s", resp.StatusCode, discordApiUrl)
+		return nil, 0, fmt.Errorf("unexpected status %d from %s", resp.StatusCode, url)
 	}
 
+	body := &countingReader{r: resp.Body}
+	tee := io.TeeReader(body, w)
 	var apps []DetectableApp
-	if err := json.NewDecoder(resp.Body).Decode(&apps); err != nil {
-		return fmt.Errorf("decode response: %w", err)
+	if err := json.NewDecoder(tee).Decode(&apps); err != nil {
+		return nil, 0, fmt.Errorf("decode response: %w", err)
 	}
-	if len(apps) == 0 {
-		return fmt.Errorf("response contained zero apps; refusing to overwrite cache")
+	if len(apps) < minDetectableApps {
+		return nil, 0, fmt.Errorf("response contained only %d apps (want at least %d)", len(apps), minDetectableApps)
 	}
-
-	data, err := json.Marshal(apps)
-	if err != nil {
-		return fmt.Errorf("re-marshal apps: %w", err)
+	// the decoder reads ahead in chunks and stops at the end of the value;
+	// copy whatever it didn't consume so w gets the whole response
+	if _, err := io.Copy(io.Discard, tee); err != nil {
+		return nil, 0, fmt.Errorf("write cache: %w", err)
 	}
-	if err := os.WriteFile(cacheFile, data, 0644); err != nil {
-		return fmt.Errorf("write cache: %w", err)
+	return apps, body.n, nil
+}
+
+// countingReader counts the bytes read through it
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// get path to Discord IPC socket. an explicit socket_path/-socket is used
+// as-is without probing; discovery only runs when none is set.
+func locateDiscordSocket() (string, error) {
+	if socketPathOverride != "" {
+		return socketPathOverride, nil
 	}
-	log.Printf("Cache updated successfully (%d apps).", len(apps))
-	return nil
+	return findDiscordSocket()
 }
 
-// get path to Discord IPC socket
+// probe the known Discord IPC socket locations
 func findDiscordSocket() (string, error) {
-	uid := os.Getuid()
-	candidates := []string{
-		fmt.Sprintf("/run/user/%d/discord-ipc-0", uid),
-		fmt.Sprintf("/run/user/%d/app/com.discordapp.Discord/discord-ipc-0", uid), // flatpak default
-		fmt.Sprintf("/run/user/%d/snap.discord/discord-ipc-0", uid),
+	for _, path := range socketCandidates(os.Getuid(), discordFlavor) {
+		if socketExists(path) {
+			return path, nil
+		}
+	}
+	return "", ErrSocketNotFound
+}
+
+// a possible Discord IPC socket location and the client flavor that uses it.
+// an empty flavor means any client (stable, PTB, and Canary all use the
+// same native path, so it can't tell them apart).
+type socketCandidate struct {
+	Path   string
+	Flavor string
+}
+
+// Discord IPC socket paths to probe, in order. in auto mode every location
+// is tried; with a specific flavor, that flavor's sandboxed locations come
+// first, the shared ones after, and other flavors' are skipped.
+func socketCandidates(uid int, flavor string) []string {
+	runDir := fmt.Sprintf("/run/user/%d", uid)
+	candidates := []socketCandidate{
+		{runDir + "/discord-ipc-0", ""},
+		{runDir + "/app/com.discordapp.Discord/discord-ipc-0", "stable"}, // flatpak default
+		{runDir + "/app/com.discordapp.DiscordCanary/discord-ipc-0", "canary"},
+		{runDir + "/app/com.discordapp.DiscordPTB/discord-ipc-0", "ptb"},
+		{runDir + "/snap.discord/discord-ipc-0", "stable"},
+		{runDir + "/snap.discord-canary/discord-ipc-0", "canary"},
 		// maybe there's more depending on distro and/or install method?
+		// older clients and setups without XDG_RUNTIME_DIR fall back to temp dirs
+		{filepath.Join(os.TempDir(), "discord-ipc-0"), ""},
+		{"/tmp/discord-ipc-0", ""},
+		{"@discord-ipc-0", ""}, // abstract namespace (some hardened/sandboxed installs)
 	}
-	for _, path := range candidates {
-		if _, err := os.Stat(path); err == nil {
-			return path, nil
+	// socket_dirs: custom installs (Nix, AppImage, portable) can use any slot
+	for _, dir := range socketDirs {
+		for i := 0; i <= 9; i++ {
+			candidates = append(candidates, socketCandidate{filepath.Join(dir, fmt.Sprintf("discord-ipc-%d", i)), ""})
+		}
+	}
+
+	var preferred, shared []string
+	seen := map[string]bool{}
+	for _, c := range candidates {
+		if seen[c.Path] {
+			continue
+		}
+		seen[c.Path] = true
+		switch {
+		case flavor == "auto" || c.Flavor == flavor:
+			preferred = append(preferred, c.Path)
+		case c.Flavor == "":
+			shared = append(shared, c.Path)
+		}
+	}
+	return append(preferred, shared...)
+}
+
+// returns true if something is listening at a socket candidate.
+// abstract-namespace sockets ("@name", which net.Dial maps to the
+// NUL-prefixed form on Linux) have no filesystem entry, so they're probed
+// with a dial instead of a stat.
+func socketExists(path string) bool {
+	if strings.HasPrefix(path, "@") {
+		conn, err := net.DialTimeout("unix", path, time.Second)
+		if err != nil {
+			return false
+		}
+		conn.Close()
+		return true
+	}
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// split a socket address into a dial network and address. "unix://path"
+// and "tcp://host:port" pick the network explicitly; anything without a
+// scheme is a Unix socket path (or "@name" abstract socket).
+func parseSocketAddress(addr string) (network string, address string, err error) {
+	scheme, rest, ok := strings.Cut(addr, "://")
+	if !ok {
+		return "unix", addr, nil
+	}
+	switch scheme {
+	case "unix":
+		if rest == "" {
+			return "", "", fmt.Errorf("socket address %q has no path", addr)
+		}
+		return "unix", rest, nil
+	case "tcp":
+		if _, _, err := net.SplitHostPort(rest); err != nil {
+			return "", "", fmt.Errorf("socket address %q: %w", addr, err)
 		}
+		return "tcp", rest, nil
 	}
-	return "", fmt.Errorf("discord socket not found")
+	return "", "", fmt.Errorf("socket address %q has unsupported scheme %q (use unix:// or tcp://)", addr, scheme)
 }
 
-// parse and log the Discord IPC response
-func readIpcResponse(conn net.Conn) {
+// read one frame from the Discord IPC socket
+func readIpcResponse(conn net.Conn) (opcode int32, payload []byte, err error) {
 	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
 	defer conn.SetReadDeadline(time.Time{}) // clear deadline after read
 
 	// read header (8 bytes)
 	header := make([]byte, 8)
-	_, err := io.ReadFull(conn, header)
-	if err != nil {
-		log.Printf("ERROR: Failed to read header: %v", err)
-		return
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return 0, nil, fmt.Errorf("read header: %w", err)
 	}
 
-	// parse length (last 4 bytes of header)
+	// parse opcode (first 4 bytes) and length (last 4 bytes of header)
+	opcode = int32(binary.LittleEndian.Uint32(header[0:4]))
 	dataLen := binary.LittleEndian.Uint32(header[4:8])
 
 	// cap allocation to avoid OOM on a malformed/garbage header.
 	// Discord IPC frames are well under 1 MB in practice.
 	const maxPayload = 1 << 20
 	if dataLen > maxPayload {
-		log.Printf("ERROR: IPC payload length %d exceeds %d-byte cap, dropping", dataLen, maxPayload)
-		return
+		return opcode, nil, fmt.Errorf("payload length %d exceeds %d-byte cap", dataLen, maxPayload)
 	}
 
 	// read the payload
-	payload := make([]byte, dataLen)
-	_, err = io.ReadFull(conn, payload)
-	if err != nil {
-		log.Printf("ERROR: Failed to read payload: %v", err)
+	payload = make([]byte, dataLen)
+	if _, err := io.ReadFull(conn, payload); err != nil {
+		return opcode, nil, fmt.Errorf("read payload: %w", err)
+	}
+	traceFrame("recv", header, payload)
+	return opcode, payload, nil
+}
+
+// log a raw frame for -trace-ipc: the header as hex and the payload
+// indented, or as-is if it isn't JSON
+func traceFrame(direction string, header []byte, payload []byte) {
+	if !traceIPC {
 		return
 	}
-	log.Printf("Discord response: %s", string(payload))
+	body := string(payload)
+	var indented bytes.Buffer
+	if json.Indent(&indented, payload, "", "  ") == nil {
+		body = indented.String()
+	}
+	slog.Debug("IPC frame", "dir", direction, "opcode", binary.LittleEndian.Uint32(header[0:4]), "header", hex.EncodeToString(header), "payload", loggedPayload(body))
+}
+
+// nonce generators by nonce_strategy name. nonces must be unique per
+// connection, since Discord echoes them to correlate replies.
+var nonceStrategies = map[string]func() string{
+	"counter": counterNonce,
+	"uuid":    uuidNonce,
+}
+
+var nonceCounter atomic.Uint64
+
+// increasing per-process counter
+func counterNonce() string {
+	return strconv.FormatUint(nonceCounter.Add(1), 10)
+}
+
+// random version 4 UUID
+func uuidNonce() string {
+	var b [16]byte
+	crand.Read(b[:])
+	b[6] = b[6]&0x0f | 0x40 // version 4
+	b[8] = b[8]&0x3f | 0x80 // RFC 4122 variant
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
+
+// IPC frame opcodes
+const (
+	opHandshake = 0
+	opFrame     = 1
+	opClose     = 2
+	opPing      = 3
+	opPong      = 4
+)
+
+// IpcConn is a Discord IPC connection with serialized frame writes, so
+// concurrent senders can't interleave one frame's bytes with another's
+type IpcConn struct {
+	net.Conn
+	writeMu sync.Mutex
+	// where sent frames are recorded (-record-frames), if anywhere
+	recorder *frameRecorder
+}
+
+func newIpcConn(conn net.Conn) *IpcConn {
+	return &IpcConn{Conn: conn}
 }
 
 // send IPC packet to Discord IPC socket
-func sendIPCPacket(conn net.Conn, opcode int, payload []byte) error {
+func sendIPCPacket(conn *IpcConn, opcode int, payload []byte) error {
 	buf := new(bytes.Buffer)
 
 	// opcode (4 bytes - little endian)
@@ -245,8 +1042,33 @@ func sendIPCPacket(conn net.Conn, opcode int, payload []byte) error {
 
 	// send payload
 	buf.Write(payload)
-	_, err := conn.Write(buf.Bytes())
-	return err
+	traceFrame("send", buf.Bytes()[:8], payload)
+	conn.writeMu.Lock()
+	defer conn.writeMu.Unlock()
+	if err := writeFull(conn, buf.Bytes()); err != nil {
+		return fmt.Errorf("%w: %w", ErrConnectionLost, err)
+	}
+	if conn.recorder != nil {
+		conn.recorder.record(opcode, payload)
+	}
+	return nil
+}
+
+// write all of data, continuing after short writes so a frame is never
+// left half-sent. a write that makes no progress without an error is
+// reported as io.ErrShortWrite rather than retried forever.
+func writeFull(w io.Writer, data []byte) error {
+	for len(data) > 0 {
+		n, err := w.Write(data)
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return io.ErrShortWrite
+		}
+		data = data[n:]
+	}
+	return nil
 }
 
 // fixup the raw Steam folder name to match Discord's JSON entries
@@ -258,371 +1080,2838 @@ func normalizeGameName(input string) string {
 	return nonAlphanumeric.ReplaceAllString(strings.ToLower(s), "")
 }
 
-// returns true if the Steam folder name is in the ignore list or matches a known infrastructure prefix
+// valid match_strategy values. "exact" compares normalized names only;
+// "token_set" also compares the set of words, so word order, camel-cased
+// folder names, and filler like "the" or "edition" don't matter.
+var matchStrategies = map[string]bool{"exact": true, "token_set": true}
+
+// words ignored by token_set matching
+var minorWords = map[string]bool{
+	"a": true, "an": true, "the": true, "of": true, "and": true,
+	"edition": true, "goty": true,
+}
+
+// runs of words ignored by token_set matching, ex: "Game of the Year" is
+// spelled out where "GOTY" would be a minor word. removed before minorWords,
+// so "game" and "year" alone still count.
+var minorPhrases = [][]string{{"game", "of", "the", "year"}}
+
+// sorted, deduplicated lowercase words of a game name, joined by spaces.
+// words split at punctuation, spaces, lower-to-upper case changes, and
+// letter/digit changes (ex: "HalfLife2" and "Half-Life 2" are both
+// "2 half life").
+func tokenSetKey(name string) string {
+	s, _, _ := transform.String(accentTransformer, name)
+	var words []string
+	var word []rune
+	flush := func() {
+		if len(word) > 0 {
+			words = append(words, strings.ToLower(string(word)))
+			word = word[:0]
+		}
+	}
+	var prev rune
+	for _, r := range s {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			flush()
+			continue
+		}
+		if len(word) > 0 && (unicode.IsLower(prev) && unicode.IsUpper(r) || unicode.IsDigit(prev) != unicode.IsDigit(r)) {
+			flush()
+		}
+		word = append(word, r)
+		prev = r
+	}
+	flush()
+	for _, phrase := range minorPhrases {
+		for i := 0; i+len(phrase) <= len(words); {
+			if slices.Equal(words[i:i+len(phrase)], phrase) {
+				words = slices.Delete(words, i, i+len(phrase))
+			} else {
+				i++
+			}
+		}
+	}
+	words = slices.DeleteFunc(words, func(w string) bool { return minorWords[w] })
+	sort.Strings(words)
+	return strings.Join(slices.Compact(words), " ")
+}
+
+// returns true if the Steam folder name is in the ignore list or matches a known infrastructure prefix.
+// when an allowlist is set, it decides alone: listed games are never ignored and everything else is.
+// matching uses normalizeGameName on both sides, so case, spaces, and punctuation don't matter.
 func isIgnoredGame(name string) bool {
-	if ignoredGames[name] {
+	key := normalizeGameName(name)
+	if len(allowedGames) > 0 {
+		return !allowedGames[key]
+	}
+	if ignoredGames[key] {
 		return true
 	}
 	for _, prefix := range ignoredGamePrefixes {
-		if strings.HasPrefix(name, prefix) {
+		if strings.HasPrefix(key, normalizeGameName(prefix)) {
 			return true
 		}
 	}
 	return false
 }
 
-// find Discord client ID of provided game
-func resolveClientID(name string) string {
-	if id, ok := manualMappings[name]; ok {
-		return id
-	}
-	norm := normalizeGameName(name)
-	if id, ok := nameToID[norm]; ok {
-		return id
-	}
-	return "000000000000000000" // default, but will not work (handshake fail)
+// returns true if the process exe basename is a wrapper or launcher to skip
+func isIgnoredProcess(base string) bool {
+	return ignoredProcesses[base] || launcherProcesses[base]
 }
 
-// connect to Discord IPC socket as clientID
-func connectIPC(path string, clientID string) (net.Conn, error) {
-	conn, err := net.Dial("unix", path)
-	if err != nil {
-		return nil, err
-	}
+// client ID returned for unmatched games that aren't presented through
+// default_client_id. the handshake would fail, so it's never connected with.
+const unknownClientID = "000000000000000000"
 
-	// start handshake as generic client
-	handshake := IpcHandshake{V: 1, ClientID: clientID}
-	payload, _ := json.Marshal(handshake)
+// false for a client ID no handshake can succeed with: unknownClientID, or
+// the empty ID an empty manual_mappings entry resolves to
+func presentableClientID(id string) bool {
+	return id != "" && id != unknownClientID
+}
 
-	// opcode 0 = handshake
-	if err := sendIPCPacket(conn, 0, payload); err != nil {
-		conn.Close()
-		return nil, err
-	}
+// unmatched_policy values: what happens to a game with no Discord app
+const (
+	unmatchedSkip    = "skip"    // not presented
+	unmatchedDefault = "default" // default_client_id, with neutral "Playing a game" details
+	unmatchedGeneric = "generic" // genericClientID, with the game's name in the templates
+)
 
-	// read response
-	log.Println("Sent handshake. Waiting for reply...")
-	readIpcResponse(conn)
+// the bridge's own shared Discord app, which unmatched games are presented
+// through under unmatched_policy generic. it names no game, so the game's
+// name comes from the templates.
+const genericClientID = "1466185989785325638"
 
-	return conn, nil
+var unmatchedPolicies = map[string]bool{unmatchedSkip: true, unmatchedDefault: true, unmatchedGeneric: true}
+
+// true if a game matched this way is presented neutrally, without naming a
+// game the app doesn't know
+func presentsGeneric(match matchKind) bool {
+	return match == matchDefault && unmatchedPolicy == unmatchedDefault
 }
 
-// given path with steamapps/common, extract the steam game folder name.
-// works for both native and flatpak steam installations
-func extractSteamGameName(fullPath string) string {
-	fullPath = strings.ReplaceAll(fullPath, "\\", "/")
+// how resolveClientID found a client ID
+type matchKind string
 
-	const key = "steamapps/common"
-	idx := strings.Index(fullPath, key)
-	if idx == -1 {
-		return ""
-	}
+const (
+	matchManual   matchKind = "manual"     // manual_mappings entry
+	matchExact    matchKind = "exact"      // normalized name in the detectable list
+	matchListed   matchKind = "executable" // the app whose executable the game runs (DetectedGame.ListedID)
+	matchTokenSet matchKind = "token_set"  // same words as a detectable name (match_strategy token_set)
+	matchDefault  matchKind = "default"    // no match, using default_client_id (unmatched_policy default)
+	matchGeneric  matchKind = "generic"    // no match, using genericClientID (unmatched_policy generic)
+	matchNone     matchKind = "none"       // no match, using unknownClientID (unmatched_policy skip)
+)
 
-	// strip everything before game name
-	name := fullPath[idx+len(key):]
-	name = strings.TrimPrefix(name, "/")
+// true if the name didn't match a Discord app
+func (m matchKind) fallback() bool {
+	return m == matchDefault || m == matchGeneric || m == matchNone
+}
 
-	// extract first directory component
-	parts := strings.SplitN(name, "/", 2)
-	if len(parts) > 0 {
-		return parts[0]
+// find the Discord client ID of a detected game. one detected by its listed
+// executable already names its app, which a lookup by name could resolve to
+// another app sharing the name. a manual_mappings entry still wins.
+func resolveGameClientID(game DetectedGame) (string, matchKind) {
+	if _, manual := manualMappings[game.Name]; !manual && game.ListedID != "" {
+		return game.ListedID, matchListed
 	}
-	return ""
+	return resolveClientID(game.Name)
 }
 
-// try to find the game name from the process's cmdline args (for proton games)
-func scanCmdline(pidStr string) string {
-	// /proc/<pid>/cmdline args separated by null bytes (\0)
-	data, err := os.ReadFile(filepath.Join("/proc", pidStr, "cmdline"))
+// find Discord client ID of provided game, and how it was matched
+func resolveClientID(name string) (string, matchKind) {
+	if id, ok := manualMappings[name]; ok {
+		return id, matchManual
+	}
+	norm := normalizeGameName(name)
+	if id, ok := nameToID[norm]; ok {
+		return id, matchExact
+	}
+	if matchStrategy == "token_set" {
+		if id, ok := tokenSetToID[tokenSetKey(name)]; ok {
+			return id, matchTokenSet
+		}
+	}
+	switch {
+	case unmatchedPolicy == unmatchedDefault && defaultClientID != "":
+		return defaultClientID, matchDefault
+	case unmatchedPolicy == unmatchedGeneric:
+		return genericClientID, matchGeneric
+	}
+	return unknownClientID, matchNone
+}
+
+// reconnect backoff bounds and the +/- fraction of random jitter applied to each delay
+const (
+	reconnectBaseDelay = 5 * time.Second
+	reconnectMaxDelay  = 2 * time.Minute
+	reconnectJitter    = 0.2
+)
+
+// delay before the next connection attempt after attempt consecutive
+// failures (0-based): exponential from reconnectBaseDelay, capped at
+// reconnectMaxDelay, and jittered so clients restarted together don't retry
+// in lockstep. math/rand is seeded randomly per process.
+func reconnectDelay(attempt int) time.Duration {
+	delay := reconnectMaxDelay
+	if attempt < 16 {
+		delay = min(reconnectBaseDelay<<attempt, reconnectMaxDelay)
+	}
+	jitter := (rand.Float64()*2 - 1) * reconnectJitter
+	return time.Duration(float64(delay) * (1 + jitter))
+}
+
+// IPC failures callers can branch on with errors.Is
+var (
+	// no Discord IPC socket at any probed location
+	ErrSocketNotFound = errors.New("discord socket not found")
+	// Discord answered the handshake with a close frame, usually an
+	// unknown client ID. the wrapped error carries Discord's reason.
+	ErrHandshakeRejected = errors.New("discord rejected handshake")
+	// the connection failed or closed under us; reconnecting may help
+	ErrConnectionLost = errors.New("discord connection lost")
+)
+
+// a connection Discord accepted and then closed before replying to the
+// handshake. Discord does this while it's still starting up.
+var errHandshakeEOF = fmt.Errorf("%w during handshake", ErrConnectionLost)
+
+var (
+	handshakeAttempts   = 3
+	handshakeRetryDelay = 500 * time.Millisecond
+)
+
+// connect to Discord IPC socket as clientID. path may also be a unix:// or
+// tcp:// address, for a socket forwarded from another machine.
+// a connection closed mid-handshake is retried a few times right away, since
+// the next attempt almost always succeeds; a close frame is a rejection and
+// isn't retried.
+func connectIPC(path string, clientID string) (*IpcConn, error) {
+	network, address, err := parseSocketAddress(path)
 	if err != nil {
-		return ""
+		return nil, err
+	}
+	for attempt := 1; ; attempt++ {
+		conn, err := handshakeIPC(network, address, clientID)
+		if !errors.Is(err, errHandshakeEOF) || attempt >= handshakeAttempts {
+			return conn, err
+		}
+		slog.Info("Discord closed the connection during the handshake. Retrying...", "attempt", attempt, "retry_in", handshakeRetryDelay)
+		time.Sleep(handshakeRetryDelay)
+	}
+}
+
+// dial and send one handshake
+func handshakeIPC(network string, address string, clientID string) (*IpcConn, error) {
+	raw, err := net.Dial(network, address)
+	if err != nil {
+		return nil, err
+	}
+	conn := newIpcConn(raw)
+	conn.recorder = recordFrames
+
+	// start handshake as generic client
+	handshake := IpcHandshake{V: handshakeVersion, ClientID: clientID}
+	payload, _ := json.Marshal(handshake)
+
+	if err := sendIPCPacket(conn, opHandshake, payload); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	// read response
+	slog.Info("Sent handshake. Waiting for reply...", "client_id", loggedID(clientID), "version", handshakeVersion)
+	opcode, reply, err := readIpcResponse(conn)
+	switch {
+	case errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF):
+		conn.Close()
+		return nil, fmt.Errorf("%w: %v", errHandshakeEOF, err)
+	case err != nil:
+		conn.Close()
+		return nil, fmt.Errorf("%w: %w", ErrConnectionLost, err)
+	case opcode == opClose:
+		conn.Close()
+		return nil, fmt.Errorf("%w: %s", ErrHandshakeRejected, reply)
+	default:
+		slog.Debug("Discord response", "opcode", opcode, "payload", loggedPayload(reply))
 	}
 
-	args := bytes.Split(data, []byte{0})
+	return conn, nil
+}
+
+// given path with steamapps/common, extract the steam game folder name.
+// works for both native and flatpak steam installations, and for wine paths
+// from proton where the key may be buried mid-token in a larger argument
+// (ex: --exe=Z:\home\user\...\steamapps\common\Game\game.exe)
+func extractSteamGameName(fullPath string) string {
+	// normalize separators: backslashes on wine paths, forward slashes on host paths.
+	// collapse runs so escaped (\\) or doubled separators don't yield empty components.
+	fullPath = strings.ReplaceAll(fullPath, "\\", "/")
+	fullPath = repeatedSlashes.ReplaceAllString(fullPath, "/")
 
-	// also check ignoredProcesses against argv[0] basename — handles the case
-	// where /proc/<pid>/exe readlink failed in scanProcesses and the wrapper
-	// process's cmdline still carries the wrapped game's path.
-	if len(args) > 0 && len(args[0]) > 0 {
-		if ignoredProcesses[filepath.Base(string(args[0]))] {
+	// older libraries use "SteamApps", so search case-insensitively.
+	// the first occurrence wins: it's the library the game is installed in.
+	const key = "steamapps/common"
+	for offset := 0; ; {
+		idx := indexFold(fullPath[offset:], key)
+		if idx == -1 {
 			return ""
 		}
+		offset += idx + len(key)
+		rest := fullPath[offset:]
+		// the key must end at a path boundary (not "steamapps/commonfoo")
+		if rest != "" && !strings.ContainsRune("/\"'", rune(rest[0])) {
+			continue
+		}
+
+		// extract first directory component after the key. a path that
+		// ends at the common folder itself has no game.
+		name, _, _ := strings.Cut(strings.TrimPrefix(rest, "/"), "/")
+		// drop quoting left over when the path was embedded in a larger token
+		return strings.Trim(name, "\"'")
+	}
+}
+
+// ASCII case-insensitive strings.Index. avoids strings.ToLower, which can
+// change byte offsets when the path contains non-ASCII characters.
+func indexFold(s string, substr string) int {
+	for i := 0; i+len(substr) <= len(s); i++ {
+		if strings.EqualFold(s[i:i+len(substr)], substr) {
+			return i
+		}
+	}
+	return -1
+}
+
+// derive a launcher/store label from the path a game was detected under
+func platformFromPath(path string) string {
+	path = strings.ToLower(strings.ReplaceAll(path, "\\", "/"))
+	switch {
+	case strings.Contains(path, "steamapps/"):
+		return "Steam"
+	case strings.Contains(path, "/heroic/"):
+		return "Heroic"
+	case strings.Contains(path, "/lutris/"):
+		return "Lutris"
+	}
+	return ""
+}
+
+// game name and platform for a process path: Steam library folders first,
+// then installed Heroic titles, labeled by the store they came from
+func gameFromPath(path string) (string, string) {
+	if name := extractSteamGameName(path); name != "" {
+		return name, platformFromPath(path)
+	}
+	if title, store := heroicGameName(path); title != "" {
+		return title, store
+	}
+	return "", ""
+}
+
+// try to find the game name from the process's cmdline args (for proton games).
+// returns the game name and platform, and the argument it was found in.
+func scanCmdline(pidStr string) (string, string, string) {
+	f, err := os.Open(filepath.Join("/proc", pidStr, "cmdline"))
+	if err != nil {
+		return "", "", ""
+	}
+	defer f.Close()
+	return gameFromCmdline(f)
+}
+
+// most of a cmdline read. launchers with enormous argument lists would
+// otherwise be read in full every tick, and match unrelated paths deep in it
+const maxCmdlineBytes = 64 << 10
+
+// game named by a /proc/<pid>/cmdline, args separated by null bytes (\0).
+// args are read one at a time, stopping at the first that names a game or
+// at maxCmdlineBytes, where an arg cut off by the cap is dropped.
+func gameFromCmdline(r io.Reader) (string, string, string) {
+	reader := bufio.NewReader(io.LimitReader(r, maxCmdlineBytes))
+	read := 0
+	for first := true; ; first = false {
+		arg, err := reader.ReadBytes(0)
+		read += len(arg)
+		if err != nil && read >= maxCmdlineBytes {
+			return "", "", ""
+		}
+		arg = bytes.TrimSuffix(arg, []byte{0})
+
+		// also check ignoredProcesses against argv[0] basename — handles the case
+		// where /proc/<pid>/exe readlink failed in scanProcesses and the wrapper
+		// process's cmdline still carries the wrapped game's path.
+		if first && len(arg) > 0 && isIgnoredProcess(filepath.Base(string(arg))) {
+			return "", "", ""
+		}
+
+		if len(arg) > 0 {
+			path := string(arg)
+			if name, platform := gameFromPath(path); name != "" && !isIgnoredGame(name) {
+				return name, platform, path
+			}
+		}
+		if err != nil {
+			return "", "", ""
+		}
+	}
+}
+
+// run the detectors in priority order: Steam's own record of the running
+// game, then /proc, then (if enabled) cloud gaming window titles. with a
+// game_priority, /proc is scanned even when Steam reports a game, and the
+// higher ranked of the two wins.
+func detectGame() DetectedGame {
+	steamGame := detectSteamRunningGame()
+	if steamGame.Name != "" && len(gamePriority) == 0 {
+		return steamGame
+	}
+	if game := scanProcesses(); game.Name != "" {
+		if steamGame.Name != "" && !outranks(game, steamGame) {
+			return steamGame
+		}
+		return game
+	}
+	if steamGame.Name != "" {
+		return steamGame
+	}
+	if cloudGaming {
+		if game := detectCloudGame(); game.Name != "" {
+			return game
+		}
+	}
+	return detectMediaApp()
+}
+
+// scan active processes of current user for active games. the first match
+// wins, unless a game_priority is set: then every process is checked and
+// the highest ranked match wins, the first match if none is listed.
+func scanProcesses() DetectedGame {
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		return DetectedGame{}
+	}
+	uid := os.Getuid()
+	var best DetectedGame
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+
+		// check if PID
+		pidStr := entry.Name()
+		if pidStr[0] < '0' || pidStr[0] > '9' {
+			continue
+		}
+
+		// skip other users' processes
+		if !scanAllUsers && !isOwnedBy(entry, uid) {
+			continue
+		}
+
+		game, ok := detectPid(pidStr)
+		if !ok {
+			continue
+		}
+		if len(gamePriority) == 0 {
+			return game
+		}
+		if best.Name == "" || outranks(game, best) {
+			best = game
+		}
+		if priorityRank(best.Name) == 0 {
+			break
+		}
+	}
+	return best
+}
+
+// rank of a game in game_priority, 0 first. unlisted games rank after
+// every listed one.
+func priorityRank(name string) int {
+	if rank, ok := gamePriority[normalizeGameName(name)]; ok {
+		return rank
+	}
+	return len(gamePriority)
+}
+
+// true if a comes before b in game_priority
+func outranks(a DetectedGame, b DetectedGame) bool {
+	return priorityRank(a.Name) < priorityRank(b.Name)
+}
+
+// game_priority names in rank order, for the effective config
+func priorityOrder() []string {
+	names := make([]string, len(gamePriority))
+	for name, rank := range gamePriority {
+		names[rank] = name
+	}
+	return names
+}
+
+// detect a game in a single process
+func detectPid(pidStr string) (DetectedGame, bool) {
+	// check symlink for native Steam games
+	var gameName, platform, method, gamePath, appID, listedID string
+	var content emulatorContent
+	exePath, err := os.Readlink(filepath.Join("/proc", pidStr, "exe")) // /proc/<pid>/exe
+	if err == nil {
+		// skip wrapper/launcher processes that carry game paths in their cmdline
+		if isIgnoredProcess(filepath.Base(exePath)) {
+			return DetectedGame{}, false
+		}
+		// gamescope's cmdline names the game it wraps, but the game is its
+		// child; present that process instead
+		if filepath.Base(exePath) == "gamescope" {
+			return detectGamescopeChild(pidStr)
+		}
+		if app, ok := steamAppForCgroup(pidStr); ok {
+			// Steam's scope for the game names its appid, however the
+			// exe path looks
+			gameName, platform, method, gamePath = app.InstallDir, "Steam", "cgroup", exePath
+			appID = app.AppID
+		} else if emu, ok := detectEmulator(pidStr, exePath); ok {
+			content = emu
+			gameName, platform, method = emu.Emulator, platformFromPath(exePath), "emulator"
+		} else if app, ok := appForExecutable(exePath); ok {
+			// the game list names this binary; more precise than the folder
+			gameName, platform = app.Name, platformFromPath(exePath)
+			method, gamePath, listedID = "executable", exePath, app.ID
+		} else {
+			gameName, platform = gameFromPath(exePath)
+			method, gamePath = "exe", exePath
+		}
+	}
+
+	// fallback: check command line args (for proton games)
+	if gameName == "" {
+		gameName, platform, gamePath = scanCmdline(pidStr)
+		method = "cmdline"
+	}
+
+	// wine processes in a Bottles prefix, matched against its programs
+	if gameName == "" {
+		if name, path := bottlesGameName(pidStr); name != "" {
+			gameName, platform, method, gamePath = name, "Bottles", "bottles", path
+		}
+	}
+
+	if gameName == "" || isIgnoredGame(gameName) {
+		return DetectedGame{}, false
+	}
+	server := isServerExecutable(gameName, gamePath)
+	if server && ignoreServers {
+		return DetectedGame{}, false
+	}
+	// skip transient matches; they'll be picked up on a later tick if they stick around
+	if minProcessAge > 0 {
+		if age, err := processAge(pidStr); err == nil && age < minProcessAge {
+			return DetectedGame{}, false
+		}
+	}
+	pid, _ := strconv.Atoi(pidStr)
+	env := readEnviron(pidStr)
+	if id := steamAppID(env); id != "" && appID == "" {
+		appID = id
+	}
+	return DetectedGame{
+		Name:        gameName,
+		Pid:         pid,
+		Platform:    platform,
+		Method:      method,
+		Server:      server,
+		AppID:       appID,
+		ListedID:    listedID,
+		Device:      steamDevice(env),
+		ROM:         content.ROM,
+		System:      content.System,
+		DisplayName: content.displayName(),
+	}, true
+}
+
+// detect a game among a gamescope process's descendants, nearest first
+func detectGamescopeChild(pidStr string) (DetectedGame, bool) {
+	queue := childPids(pidStr)
+	for len(queue) > 0 {
+		child := queue[0]
+		queue = queue[1:]
+		if game, ok := detectPid(child); ok {
+			return game, true
+		}
+		queue = append(queue, childPids(child)...)
 	}
+	return DetectedGame{}, false
+}
 
-	for _, arg := range args {
-		if len(arg) == 0 {
+// direct children of a process, from every thread's children list
+func childPids(pidStr string) []string {
+	tasks, _ := filepath.Glob(filepath.Join("/proc", pidStr, "task", "*", "children"))
+	var children []string
+	for _, path := range tasks {
+		data, err := os.ReadFile(path)
+		if err != nil {
 			continue
 		}
-		path := string(arg)
-		name := extractSteamGameName(path)
-
-		if name != "" && !isIgnoredGame(name) {
-			return name
+		children = append(children, strings.Fields(string(data))...)
+	}
+	return children
+}
+
+// true if path's basename is listed in server_executables for the game.
+// path is the exe or the cmdline token the game was found in, which may be a
+// wine path.
+func isServerExecutable(gameName string, path string) bool {
+	servers := serverExecutables[normalizeGameName(gameName)]
+	if len(servers) == 0 || path == "" {
+		return false
+	}
+	base := filepath.Base(strings.ReplaceAll(path, "\\", "/"))
+	return servers[strings.ToLower(strings.Trim(base, "\"'"))]
+}
+
+// environment variable that, when non-empty, replaces process detection
+const forceGameEnv = "DRB_FORCE_GAME"
+
+// game forced through DRB_FORCE_GAME, presented as if detected. uses the
+// bridge's own PID since there's no game process to tie the activity to.
+func forcedGame() (DetectedGame, bool) {
+	name := strings.TrimSpace(os.Getenv(forceGameEnv))
+	if name == "" {
+		return DetectedGame{}, false
+	}
+	return DetectedGame{Name: name, Pid: os.Getpid(), Method: "forced"}, true
+}
+
+// environment of a process, or nil if it can't be read
+func readEnviron(pidStr string) map[string]string {
+	data, err := os.ReadFile(filepath.Join("/proc", pidStr, "environ"))
+	if err != nil {
+		return nil
+	}
+	env := map[string]string{}
+	for _, kv := range bytes.Split(data, []byte{0}) {
+		if key, value, ok := strings.Cut(string(kv), "="); ok {
+			env[key] = value
+		}
+	}
+	return env
+}
+
+// read the Steam appid from a process's environment
+func readSteamAppID(pidStr string) string {
+	return steamAppID(readEnviron(pidStr))
+}
+
+// the Steam appid from the environment Steam sets for launched games.
+// SteamAppId is the real appid; SteamGameId is also set for non-Steam
+// shortcuts (as a large synthetic ID), so it's only a fallback.
+func steamAppID(env map[string]string) string {
+	for _, key := range []string{"SteamAppId", "SteamGameId"} {
+		if value := env[key]; value != "" && value != "0" {
+			return value
+		}
+	}
+	return ""
+}
+
+// the device a game was launched on, from the hints Steam sets in the
+// game's environment: "Steam Deck" on a Deck, "Steam Big Picture" in a
+// gamescope/Big Picture session elsewhere, or "" on the desktop
+func steamDevice(env map[string]string) string {
+	switch {
+	case env["SteamDeck"] == "1":
+		return "Steam Deck"
+	case env["SteamGamepadUI"] == "1":
+		return "Steam Big Picture"
+	}
+	return ""
+}
+
+// returns true if the /proc/<pid> entry belongs to uid
+func isOwnedBy(entry os.DirEntry, uid int) bool {
+	info, err := entry.Info()
+	if err != nil {
+		return false // process exited mid-scan
+	}
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	return ok && int(stat.Uid) == uid
+}
+
+// USER_HZ, the unit of /proc/<pid>/stat times. fixed at 100 on Linux
+// regardless of the kernel's internal tick rate.
+const clockTicksPerSecond = 100
+
+// how long ago the process was started, from /proc/<pid>/stat and /proc/uptime
+func processAge(pidStr string) (time.Duration, error) {
+	stat, err := os.ReadFile(filepath.Join("/proc", pidStr, "stat"))
+	if err != nil {
+		return 0, err
+	}
+	startTicks, err := parseStartTicks(stat)
+	if err != nil {
+		return 0, err
+	}
+
+	uptime, err := os.ReadFile("/proc/uptime")
+	if err != nil {
+		return 0, err
+	}
+	fields := strings.Fields(string(uptime))
+	if len(fields) == 0 {
+		return 0, fmt.Errorf("empty /proc/uptime")
+	}
+	uptimeSecs, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return 0, err
+	}
+
+	started := time.Duration(startTicks) * time.Second / clockTicksPerSecond
+	return time.Duration(uptimeSecs*float64(time.Second)) - started, nil
+}
+
+// when a process started, to the second. zero if it can't be read.
+func processStartTime(pid int) time.Time {
+	age, err := processAge(strconv.Itoa(pid))
+	if err != nil {
+		return time.Time{}
+	}
+	return time.Now().Add(-age).Truncate(time.Second)
+}
+
+// extract starttime (field 22, clock ticks since boot) from a /proc/<pid>/stat line.
+// the comm field (2) is parenthesized and may contain spaces or parens, so fields
+// are counted from the last ')'.
+func parseStartTicks(stat []byte) (uint64, error) {
+	end := bytes.LastIndexByte(stat, ')')
+	if end == -1 {
+		return 0, fmt.Errorf("malformed stat: no comm terminator")
+	}
+	fields := strings.Fields(string(stat[end+1:]))
+
+	// fields after comm start at field 3 (state)
+	const startTimeIdx = 22 - 3
+	if len(fields) <= startTimeIdx {
+		return 0, fmt.Errorf("malformed stat: %d fields after comm", len(fields))
+	}
+	return strconv.ParseUint(fields[startTimeIdx], 10, 64)
+}
+
+// read /etc/os-release to display in the Discord status
+func readOSRelease() string {
+	name, err := osReleaseName("/etc/os-release")
+	if err != nil {
+		slog.Error("Could not read /etc/os-release", "err", err)
+		return runtime.GOOS
+	}
+	return name
+}
+
+// PRETTY_NAME (or NAME) from an os-release file
+func osReleaseName(path string) (string, error) {
+	distroInfo, err := osReleaseFields(path)
+	if err != nil {
+		return "", err
+	}
+	if name, ok := distroInfo["PRETTY_NAME"]; ok {
+		return name, nil
+	} else if name, ok := distroInfo["NAME"]; ok {
+		return name, nil
+	}
+	return "", fmt.Errorf("%s has no PRETTY_NAME or NAME", path)
+}
+
+// KEY=value pairs from an os-release file, with quotes stripped
+func osReleaseFields(path string) (map[string]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	distroInfo := make(map[string]string)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := scanner.Text()
+		parts := strings.SplitN(line, "=", 2)
+
+		if len(parts) == 2 {
+			key := strings.TrimSpace(parts[0])
+			value := strings.Trim(strings.TrimSpace(parts[1]), "\"")
+			distroInfo[key] = value
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return distroInfo, nil
+}
+
+// ID then each ID_LIKE entry from an os-release file, so a derivative
+// (ex: CachyOS, ID_LIKE=arch) falls back to its parent's logo
+func osReleaseIDs(path string) []string {
+	distroInfo, err := osReleaseFields(path)
+	if err != nil {
+		return nil
+	}
+	var ids []string
+	if id := distroInfo["ID"]; id != "" {
+		ids = append(ids, id)
+	}
+	return append(ids, strings.Fields(distroInfo["ID_LIKE"])...)
+}
+
+func builtinDistroImages() map[string]string {
+	return map[string]string{
+		"arch":                "arch",
+		"debian":              "debian",
+		"ubuntu":              "ubuntu",
+		"fedora":              "fedora",
+		"nixos":               "nixos",
+		"gentoo":              "gentoo",
+		"opensuse":            "opensuse",
+		"opensuse-tumbleweed": "opensuse",
+		"opensuse-leap":       "opensuse",
+		"manjaro":             "manjaro",
+		"pop":                 "pop_os",
+		"endeavouros":         "endeavouros",
+	}
+}
+
+// small image asset key for the distro: the first of ids with a mapping,
+// else the generic "linux" key
+func distroImageFor(ids []string) string {
+	for _, id := range ids {
+		if key, ok := distroImages[strings.ToLower(id)]; ok {
+			return key
+		}
+	}
+	return "linux"
+}
+
+// trademark-style symbols stripped from displayed game names
+var trademarkSymbols = strings.NewReplacer("™", "", "®", "", "©", "", "℠", "")
+
+// strip trademark symbols and collapse whitespace (ex: "ELDEN RING™ " -> "ELDEN RING")
+func sanitizeDisplayName(name string) string {
+	return strings.Join(strings.Fields(trademarkSymbols.Replace(name)), " ")
+}
+
+// game name as shown in presence. matching always uses the raw name.
+func displayName(game DetectedGame) string {
+	name := game.Name
+	if game.DisplayName != "" {
+		name = game.DisplayName
+	}
+	if sanitizeDisplayNames {
+		return sanitizeDisplayName(name)
+	}
+	return name
+}
+
+// configured category for a game, defaulting to "game"
+func categoryOf(game DetectedGame) string {
+	if game.Server {
+		return "server"
+	}
+	if game.Category != "" {
+		return game.Category
+	}
+	if category, ok := appCategories[normalizeGameName(game.Name)]; ok {
+		return category
+	}
+	return "game"
+}
+
+// verb for the game's category (ex: "Using" for applications). unknown
+// categories fall back to the game verb.
+func verbFor(game DetectedGame) string {
+	if verb, ok := categoryVerbs[categoryOf(game)]; ok {
+		return verb
+	}
+	return categoryVerbs["game"]
+}
+
+// Discord activity type for the game's category
+func activityTypeFor(game DetectedGame) int {
+	if activityType, ok := categoryActivityTypes[categoryOf(game)]; ok {
+		return activityType
+	}
+	return activityPlaying
+}
+
+// true for activity types RPC clients may set
+func validActivityType(activityType int) bool {
+	switch activityType {
+	case activityPlaying, activityListening, activityWatching, activityCompeting:
+		return true
+	}
+	return false
+}
+
+// substitute {game}, {verb}, {os}, {platform}, {rom}, {system}, {appid}, and {device} tokens in a presence template
+func renderTemplate(tmpl string, game DetectedGame, osRelease string) string {
+	elapsed := ""
+	if strings.Contains(tmpl, "{elapsed}") {
+		if start := sessionStartFor(game); !start.IsZero() {
+			elapsed = formatElapsed(time.Since(start))
+		}
+	}
+	return strings.NewReplacer(
+		"{game}", displayName(game),
+		"{verb}", verbFor(game),
+		"{os}", osRelease,
+		"{platform}", game.Platform,
+		"{rom}", game.ROM,
+		"{system}", game.System,
+		"{appid}", game.AppID,
+		"{device}", game.Device,
+		"{media}", game.Media,
+		"{last_played}", formatLastPlayed(game.LastPlayed),
+		"{install_size}", formatSize(game.InstallSize),
+		"{elapsed}", elapsed,
+	).Replace(tmpl)
+}
+
+// start of the game's session, for {elapsed} and the elapsed timer. zero
+// if it's unknown
+func sessionStartFor(game DetectedGame) time.Time {
+	if !game.SessionStart.IsZero() {
+		return game.SessionStart
+	}
+	if game.Pid <= 0 {
+		return time.Time{}
+	}
+	return processStartTime(game.Pid)
+}
+
+// elapsed time as H:MM, hours not wrapping past a day (ex: "0:05", "26:40")
+func formatElapsed(d time.Duration) string {
+	minutes := max(int(d/time.Minute), 0)
+	return fmt.Sprintf("%d:%02d", minutes/60, minutes%60)
+}
+
+// true if any of the templates needs the Steam appmanifest
+func usesManifestTokens(templates TemplateConfig) bool {
+	for _, tmpl := range []string{templates.Details, templates.State, templates.LargeText} {
+		if strings.Contains(tmpl, "{last_played}") || strings.Contains(tmpl, "{install_size}") {
+			return true
+		}
+	}
+	return false
+}
+
+// date the game was last played, "" if it never was
+func formatLastPlayed(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format("Jan 2, 2006")
+}
+
+// bytes as "420 GB" or "3.5 GB" (binary units, as Steam shows them), "" for 0
+func formatSize(bytes int64) string {
+	if bytes <= 0 {
+		return ""
+	}
+	size := float64(bytes)
+	unit := "B"
+	for _, next := range []string{"KB", "MB", "GB", "TB"} {
+		if size < 1024 {
+			break
+		}
+		size /= 1024
+		unit = next
+	}
+	if size < 10 && unit != "B" {
+		return fmt.Sprintf("%.1f %s", size, unit)
+	}
+	return fmt.Sprintf("%.0f %s", size, unit)
+}
+
+// details, state, and large text templates for a game: per-game overrides
+// first, then the global templates
+func templatesFor(game DetectedGame) TemplateConfig {
+	templates := TemplateConfig{
+		Details:   detailsTemplate,
+		State:     stateTemplate,
+		LargeText: largeTextTemplate,
+	}
+	if game.Device != "" && deviceStateTemplate != "" && stateTemplate == defaultStateTemplate {
+		templates.State = deviceStateTemplate
+	}
+	if game.Media != "" && mediaDetailsTemplate != "" {
+		templates.Details = mediaDetailsTemplate
+	}
+	if game.Generic && genericDetailsTemplate != "" {
+		templates.Details = genericDetailsTemplate
+	}
+	override, ok := gameTemplates[normalizeGameName(game.Name)]
+	if !ok {
+		return templates
+	}
+	if override.Details != "" {
+		templates.Details = override.Details
+	}
+	if override.State != "" {
+		templates.State = override.State
+	}
+	if override.LargeText != "" {
+		templates.LargeText = override.LargeText
+	}
+	return templates
+}
+
+// party size must be [current, max] with 0 < current <= max
+func validatePartySize(size []int) error {
+	if len(size) != 2 {
+		return fmt.Errorf("party size must be [current, max], got %d values", len(size))
+	}
+	if size[0] < 1 || size[1] < 1 || size[0] > size[1] {
+		return fmt.Errorf("party size %v must satisfy 0 < current <= max", size)
+	}
+	return nil
+}
+
+// an image field is one of:
+//   - an asset key on the game's Discord app. keys are stored lowercase, so
+//     one is lowercased to match
+//   - a full https:// URL, which Discord fetches itself and proxies as
+//     mp:external/..., no upload needed. a scheme-less //host/... URL gets
+//     https: prepended
+//   - an already proxied mp: image (ex: mp:external/... copied from a client)
+//
+// returns the image in the form Discord renders, or an error for anything
+// it would silently drop: other URL schemes, URLs missing their scheme, and
+// keys with characters asset names can't have.
+func normalizeAssetImage(image string) (string, error) {
+	image = strings.TrimSpace(image)
+	switch {
+	case image == "":
+		return "", nil
+	case strings.HasPrefix(image, "mp:"):
+		if len(image) == len("mp:") {
+			return "", fmt.Errorf("image %q is an empty mp: proxy path", image)
+		}
+		return image, nil
+	case strings.HasPrefix(image, "//"):
+		image = "https:" + image
+	}
+	if strings.Contains(image, "://") {
+		u, err := url.Parse(image)
+		if err != nil {
+			return "", fmt.Errorf("invalid image URL %q: %w", image, err)
+		}
+		if u.Scheme != "https" || u.Host == "" {
+			return "", fmt.Errorf("image URL %q must be https://", image)
+		}
+		return image, nil
+	}
+	if host, _, ok := strings.Cut(image, "/"); ok && strings.Contains(host, ".") {
+		return "", fmt.Errorf("image %q looks like a URL without https://", image)
+	}
+	key := strings.ToLower(image)
+	if strings.IndexFunc(key, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '_' || r == '-' || r == '.')
+	}) >= 0 {
+		return "", fmt.Errorf("asset key %q can only have letters, digits, '_', '-', and '.'", image)
+	}
+	return key, nil
+}
+
+// bad images already warned about, so one that keeps being chosen doesn't
+// log every tick
+var warnedImages = map[string]bool{}
+
+// image normalized for an activity's field, or "" (left out) with a warning
+// if Discord wouldn't render it
+func activityImage(field string, game string, image string) string {
+	normalized, err := normalizeAssetImage(image)
+	if err != nil {
+		if !warnedImages[image] {
+			warnedImages[image] = true
+			slog.Warn("Leaving out an image Discord won't render", "field", field, "game", loggedGame(game), "err", err)
+		}
+		return ""
+	}
+	return normalized
+}
+
+// overlay the non-empty fields of override onto base
+func mergeAssets(base ActivityAssets, override ActivityAssets) ActivityAssets {
+	if override.LargeImage != "" {
+		base.LargeImage = override.LargeImage
+	}
+	if override.LargeText != "" {
+		base.LargeText = override.LargeText
+	}
+	if override.SmallImage != "" {
+		base.SmallImage = override.SmallImage
+	}
+	if override.SmallText != "" {
+		base.SmallText = override.SmallText
+	}
+	return base
+}
+
+// large image sources, tried in image_sources order
+const (
+	imageOverride    = "override"    // asset_overrides large_image
+	imageSteamGridDB = "steamgriddb" // SteamGridDB cover art, with steamgriddb_key
+	imageIcon        = "icon"        // the matched Discord app's icon from the game list
+	imageDefault     = "default"     // the "default" asset key
+)
+
+// first large image available for a game from imageSources, and the source
+// it came from. "" if every source in the chain comes up empty.
+func largeImageFor(game DetectedGame) (image string, source string) {
+	for _, source := range imageSources {
+		switch source {
+		case imageOverride:
+			image = assetOverrides[normalizeGameName(game.Name)].LargeImage
+		case imageSteamGridDB:
+			if steamGridDBKey != "" && game.AppID != "" {
+				image = steamGridDBImage(game.AppID)
+			}
+		case imageIcon:
+			image = appIconURL(game.ClientID)
+		case imageDefault:
+			image = "default"
+		}
+		if image != "" {
+			return image, source
+		}
+	}
+	return "", ""
+}
+
+// Discord CDN URL of the icon of the app with clientID, or "" if it isn't in
+// the game list or has no icon
+func appIconURL(clientID string) string {
+	app, ok := appByID(clientID)
+	if !ok || app.Icon == "" {
+		return ""
+	}
+	return fmt.Sprintf("https://cdn.discordapp.com/app-icons/%s/%s.png?size=512", app.ID, app.Icon)
+}
+
+// send the IPC packet to Discord to update your activity.
+// a zero DetectedGame clears the activity.
+func setActivity(conn *IpcConn, game DetectedGame, osRelease string) error {
+	_, err := sendActivity(conn, game, osRelease)
+	return err
+}
+
+// send SET_ACTIVITY for game without waiting for the reply. returns the
+// command's nonce, for awaitReply.
+func sendActivity(conn *IpcConn, game DetectedGame, osRelease string) (string, error) {
+	var activity *Activity
+
+	if game.Name != "" {
+		templates := templatesFor(game)
+		if usesManifestTokens(templates) {
+			game = withSteamManifest(game)
+		}
+		largeText := displayName(game)
+		if templates.LargeText != "" {
+			largeText = renderTemplate(templates.LargeText, game, osRelease)
+		}
+		activity = &Activity{
+			Type:    activityTypeFor(game),
+			Details: renderTemplate(templates.Details, game, osRelease),
+			State:   renderTemplate(templates.State, game, osRelease),
+		}
+		assets := ActivityAssets{LargeText: largeText}
+		if key, ok := platformImages[game.Platform]; ok {
+			assets.SmallImage = key
+			assets.SmallText = game.Platform
+		} else if distroSmallImage {
+			assets.SmallImage = distroImageFor(distroIDs)
+			assets.SmallText = osRelease
+		}
+		if override, ok := assetOverrides[normalizeGameName(game.Name)]; ok {
+			assets = mergeAssets(assets, override)
+		}
+		image, source := largeImageFor(game)
+		assets.LargeImage = activityImage("large_image", game.Name, image)
+		assets.SmallImage = activityImage("small_image", game.Name, assets.SmallImage)
+		slog.Debug("Chose large image", "game", loggedGame(game.Name), "source", source, "image", assets.LargeImage)
+		if hint, ok := readPresenceHint(game.Name); ok {
+			applyPresenceHint(activity, &assets, game.Name, hint)
+		}
+		activity.Details = fitActivityText("details", activity.Details)
+		activity.State = fitActivityText("state", activity.State)
+		assets.LargeText = fitActivityText("large_text", assets.LargeText)
+		assets.SmallText = fitActivityText("small_text", assets.SmallText)
+		if assets != (ActivityAssets{}) {
+			activity.Assets = &assets
+		}
+		if showElapsedTime {
+			if start := sessionStartFor(game); !start.IsZero() {
+				activity.Timestamps = &ActivityTimestamps{Start: start.UnixMilli()}
+			}
+		}
+		activity.Instance = activityInstance
+		if activityName && !game.Generic {
+			activity.Name = fitActivityText("name", displayName(game))
+		}
+		if extras, ok := activityExtras[normalizeGameName(game.Name)]; ok {
+			if extras.Name != "" {
+				activity.Name = fitActivityText("name", extras.Name)
+			}
+			activity.Party = extras.Party
+			activity.Secrets = extras.Secrets
+			if extras.Instance != nil {
+				activity.Instance = *extras.Instance
+			}
+		}
+		if len(activity.Buttons) > 0 && activity.Secrets != nil {
+			slog.Debug("Leaving out secrets in favor of the presence file's buttons", "game", loggedGame(game.Name))
+			activity.Secrets = nil
+		}
+	}
+	payload := DiscordRpcPayload{
+		Cmd:   "SET_ACTIVITY",
+		Nonce: newNonce(),
+		Args: ActivityArgs{
+			Pid:      game.Pid,
+			Activity: activity,
+		},
+	}
+	data, _ := json.Marshal(payload)
+	return payload.Nonce, sendIPCPacket(conn, opFrame, data)
+}
+
+// discordError is an ERROR reply to a command, ex: an invalid activity
+type discordError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *discordError) Error() string {
+	return fmt.Sprintf("discord error %d: %s", e.Code, e.Message)
+}
+
+// read frames until Discord's reply to the command sent with nonce, and
+// return its data. PINGs on the way are answered with a PONG; events and
+// replies to other commands are skipped. an ERROR reply is a *discordError.
+func awaitReply(conn *IpcConn, nonce string) (json.RawMessage, error) {
+	for {
+		opcode, payload, err := readIpcResponse(conn)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrConnectionLost, err)
+		}
+		switch opcode {
+		case opPing:
+			if err := sendIPCPacket(conn, opPong, payload); err != nil {
+				return nil, err
+			}
+			continue
+		case opClose:
+			return nil, fmt.Errorf("%w: closed by discord: %s", ErrConnectionLost, payload)
+		case opFrame:
+		default:
+			continue
+		}
+		var reply struct {
+			Evt   string          `json:"evt"`
+			Nonce string          `json:"nonce"`
+			Data  json.RawMessage `json:"data"`
+		}
+		if err := json.Unmarshal(payload, &reply); err != nil || reply.Nonce != nonce {
+			slog.Debug("Skipping unrelated frame", "nonce", nonce, "payload", loggedPayload(payload))
+			continue
+		}
+		if reply.Evt == "ERROR" {
+			derr := &discordError{}
+			json.Unmarshal(reply.Data, derr)
+			return nil, derr
+		}
+		return reply.Data, nil
+	}
+}
+
+// longest details, state, and image text Discord accepts, in characters.
+// an activity with a longer field is rejected as a whole.
+const maxActivityText = 128
+
+// s cut to maxActivityText with an ellipsis, or "" with text_overflow drop,
+// so one long interpolated name can't get the whole activity rejected
+func fitActivityText(field string, s string) string {
+	n := utf8.RuneCountInString(s)
+	if n <= maxActivityText {
+		return s
+	}
+	if textOverflow == "drop" {
+		slog.Debug("Dropped activity text over Discord's limit", "field", field, "length", n, "max", maxActivityText)
+		return ""
+	}
+	slog.Debug("Truncated activity text to Discord's limit", "field", field, "length", n, "max", maxActivityText)
+	return string([]rune(s)[:maxActivityText-1]) + "…"
+}
+
+// scan interval to use while game is detected. no game uses the default.
+// while saving power, intervals shorter than power_save_interval_seconds
+// are stretched to it.
+func scanIntervalFor(game string) time.Duration {
+	interval := scanInterval
+	if override, ok := scanIntervalOverrides[normalizeGameName(game)]; ok && game != "" {
+		interval = override
+	}
+	if savingPower() {
+		interval = max(interval, powerSaveInterval)
+	}
+	return interval
+}
+
+// true if power_save applies right now
+func savingPower() bool {
+	switch powerSave {
+	case "always":
+		return true
+	case "battery":
+		return onBattery()
+	}
+	return false
+}
+
+// true if any power supply reports it's discharging, ex: a laptop or Steam
+// Deck running off its battery
+func onBattery() bool {
+	statuses, _ := filepath.Glob(filepath.Join(powerSupplyDir, "*", "status"))
+	for _, path := range statuses {
+		if data, err := os.ReadFile(path); err == nil && strings.TrimSpace(string(data)) == "Discharging" {
+			return true
+		}
+	}
+	return false
+}
+
+// longest interval the scan loop may tick at, for sizing the watchdog window
+func longestScanInterval() time.Duration {
+	longest := scanInterval
+	if powerSave != "off" {
+		longest = max(longest, powerSaveInterval)
+	}
+	for _, interval := range scanIntervalOverrides {
+		longest = max(longest, interval)
+	}
+	return longest
+}
+
+// decode a config file by its extension: .toml is TOML, anything else JSON.
+// TOML goes through JSON so both fill Config by the same json tags. errors
+// name the format, and a value of the wrong type is reported the same way
+// for both.
+func parseConfig(path string, data []byte) (Config, error) {
+	var cfg Config
+	format := "JSON"
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".toml":
+		format = "TOML"
+		doc, err := parseTOML(string(data))
+		if err != nil {
+			return cfg, fmt.Errorf("%s: %w", format, err)
+		}
+		if data, err = json.Marshal(doc); err != nil {
+			return cfg, fmt.Errorf("%s: %w", format, err)
+		}
+	case ".yaml", ".yml":
+		return cfg, errors.New("YAML config isn't supported, use JSON or TOML")
+	}
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		var typeErr *json.UnmarshalTypeError
+		if errors.As(err, &typeErr) {
+			return cfg, fmt.Errorf("%s: %s is a %s, want %s", format, typeErr.Field, typeErr.Value, typeErr.Type)
+		}
+		return cfg, fmt.Errorf("%s: %w", format, err)
+	}
+	return cfg, nil
+}
+
+// load configuration from a JSON or TOML file. every setting starts from its
+// built-in value on each call; see resetConfigCollections and
+// resetConfigScalars. a file that fails to parse changes nothing, so a typo
+// saved before a SIGHUP keeps the running settings.
+func loadConfig(configFile string) {
+	file, err := os.ReadFile(configFile)
+	if err != nil {
+		slog.Info("No config file found. Using defaults.", "path", configFile)
+		resetConfigCollections()
+		resetConfigScalars()
+		return
+	}
+
+	cfg, err := parseConfig(configFile, file)
+	if err != nil {
+		slog.Error("Error parsing config file. Keeping the current settings.", "path", configFile, "err", err)
+		return
+	}
+	resetConfigCollections()
+	resetConfigScalars()
+
+	// set first so the rest of the config log honors it
+	anonymizeGames = cfg.LogAnonymizeGames
+	if anonymizeGames {
+		slog.Info("Game names in logs are anonymized.")
+	}
+
+	// set interval
+	if cfg.ScanIntervalSeconds > 0 {
+		scanInterval = time.Duration(cfg.ScanIntervalSeconds) * time.Second
+	}
+	slog.Info("Scan interval set", "interval", scanInterval)
+
+	// load per-game scan intervals (seconds), dropping non-positive values
+	for name, seconds := range cfg.ScanIntervalOverrides {
+		if seconds <= 0 {
+			slog.Warn("Ignoring non-positive scan interval override", "game", loggedGame(name), "seconds", seconds)
+			continue
+		}
+		scanIntervalOverrides[normalizeGameName(name)] = time.Duration(seconds) * time.Second
+	}
+	if len(scanIntervalOverrides) > 0 {
+		slog.Info("Loaded scan interval overrides", "count", len(scanIntervalOverrides))
+	}
+
+	// set when and how far to slow scanning down to save power
+	switch cfg.PowerSave {
+	case "":
+	case "off", "battery", "always":
+		powerSave = cfg.PowerSave
+	default:
+		slog.Warn("Unknown power_save. Using default.", "mode", cfg.PowerSave, "default", powerSave)
+	}
+	if cfg.PowerSaveSeconds > 0 {
+		powerSaveInterval = time.Duration(cfg.PowerSaveSeconds) * time.Second
+	}
+	if powerSave != "off" {
+		slog.Info("Power saving set", "mode", powerSave, "interval", powerSaveInterval)
+	}
+
+	// merge ignored games, inline and from ignore_file
+	for _, name := range append(cfg.IgnoredGames, readConfigNameList(configFile, cfg.IgnoreFile)...) {
+		ignoredGames[normalizeGameName(name)] = true
+	}
+	slog.Info("Loaded ignored game entries", "count", len(ignoredGames))
+
+	// load the allowlist, inline and from allow_file. it takes precedence over ignored_games
+	for _, name := range append(cfg.AllowedGames, readConfigNameList(configFile, cfg.AllowFile)...) {
+		allowedGames[normalizeGameName(name)] = true
+	}
+	if len(allowedGames) > 0 {
+		slog.Info("Only presenting allowed games", "count", len(allowedGames))
+	}
+
+	// load the order games win in when several are running. a name listed
+	// twice keeps its first rank.
+	for _, name := range cfg.GamePriority {
+		key := normalizeGameName(name)
+		if _, ok := gamePriority[key]; !ok {
+			gamePriority[key] = len(gamePriority)
+		}
+	}
+	if len(gamePriority) > 0 {
+		slog.Info("Loaded game priority", "count", len(gamePriority))
+	}
+
+	// merge ignored processes
+	for _, name := range cfg.IgnoredProcesses {
+		ignoredProcesses[name] = true
+	}
+	slog.Info("Loaded ignored process entries", "count", len(ignoredProcesses))
+
+	// merge launcher processes
+	for _, name := range cfg.LauncherProcesses {
+		launcherProcesses[name] = true
+	}
+	slog.Info("Loaded launcher process entries", "count", len(launcherProcesses))
+
+	// load manual game name -> Discord client ID mappings
+	for name, id := range cfg.ManualMappings {
+		manualMappings[name] = id
+	}
+	slog.Info("Loaded manual game mappings", "count", len(manualMappings))
+
+	// set how names are matched after the exact lookup fails
+	if cfg.MatchStrategy != "" {
+		if matchStrategies[cfg.MatchStrategy] {
+			matchStrategy = cfg.MatchStrategy
+		} else {
+			slog.Warn("Unknown match_strategy. Using default.", "strategy", cfg.MatchStrategy, "default", matchStrategy)
+		}
+	}
+	slog.Info("Match strategy set", "strategy", matchStrategy)
+
+	// set how over-long activity text is handled
+	switch cfg.TextOverflow {
+	case "":
+	case "truncate", "drop":
+		textOverflow = cfg.TextOverflow
+		slog.Info("Text overflow set", "policy", textOverflow)
+	default:
+		slog.Warn("Unknown text_overflow. Using default.", "policy", cfg.TextOverflow, "default", textOverflow)
+	}
+
+	// set generic Discord app for unmatched games
+	if cfg.DefaultClientID != "" {
+		defaultClientID = cfg.DefaultClientID
+		slog.Info("Default client ID set", "client_id", defaultClientID)
+	}
+
+	// choose what happens to unmatched games. unset and unknown are both skip
+	switch {
+	case cfg.UnmatchedPolicy == "":
+	case unmatchedPolicies[cfg.UnmatchedPolicy]:
+		unmatchedPolicy = cfg.UnmatchedPolicy
+	default:
+		slog.Warn("Unknown unmatched_policy. Using default.", "policy", cfg.UnmatchedPolicy, "default", unmatchedPolicy)
+	}
+	switch {
+	case unmatchedPolicy == unmatchedDefault && defaultClientID == "":
+		slog.Warn("unmatched_policy default needs a default_client_id. Skipping unmatched games.")
+		unmatchedPolicy = unmatchedSkip
+	case unmatchedPolicy == unmatchedSkip && defaultClientID != "":
+		slog.Info("default_client_id is only used with unmatched_policy default. Skipping unmatched games.")
+	}
+	slog.Info("Unmatched game policy set", "policy", unmatchedPolicy)
+
+	// set Discord API version in URL
+	if cfg.DiscordApiVersion > 0 {
+		discordApiVersion = cfg.DiscordApiVersion
+		discordApiUrl = fmt.Sprintf("https://discord.com/api/v%d/applications/detectable", cfg.DiscordApiVersion)
+	}
+	slog.Info("Using Discord API URL", "url", discordApiUrl)
+
+	// set IPC handshake version
+	switch {
+	case cfg.HandshakeVersion == 0:
+	case cfg.HandshakeVersion < 1 || cfg.HandshakeVersion > 9:
+		slog.Warn("Ignoring out-of-range handshake_version. Using default.", "version", cfg.HandshakeVersion, "default", handshakeVersion)
+	default:
+		handshakeVersion = cfg.HandshakeVersion
+	}
+	if handshakeVersion != 1 {
+		slog.Info("Handshake version set", "version", handshakeVersion)
+	}
+
+	// set how command nonces are generated
+	if cfg.NonceStrategy != "" {
+		if generate, ok := nonceStrategies[cfg.NonceStrategy]; ok {
+			nonceStrategy, newNonce = cfg.NonceStrategy, generate
+		} else {
+			slog.Warn("Unknown nonce_strategy. Using default.", "strategy", cfg.NonceStrategy, "default", nonceStrategy)
+		}
+	}
+
+	// set game data cache TTL
+	if cfg.GameCacheTTLDays > 0 {
+		gameCacheTTL = time.Duration(cfg.GameCacheTTLDays*24) * time.Hour
+	}
+	slog.Info("Game cache TTL set", "ttl", gameCacheTTL)
+
+	// opt out of the game list cache
+	disableCache = cfg.DisableCache
+	if disableCache {
+		slog.Info("Game list cache disabled. Downloading on every start.")
+	}
+
+	// set minimum process age before a match counts (0 disables)
+	if cfg.MinProcessAgeSeconds != nil && *cfg.MinProcessAgeSeconds >= 0 {
+		minProcessAge = time.Duration(*cfg.MinProcessAgeSeconds) * time.Second
+	}
+	slog.Info("Minimum process age set", "age", minProcessAge)
+
+	// set grace period before clearing presence after the game exits
+	if cfg.ExitGracePeriodSeconds > 0 {
+		exitGracePeriod = time.Duration(cfg.ExitGracePeriodSeconds) * time.Second
+	}
+	slog.Info("Exit grace period set", "period", exitGracePeriod)
+
+	// set how long a game must run before it's presented
+	if cfg.MinSessionSeconds > 0 {
+		minSession = time.Duration(cfg.MinSessionSeconds) * time.Second
+		slog.Info("Minimum session set", "duration", minSession)
+	}
+
+	// set how many ticks a new game must persist before switching to it
+	if cfg.SwitchDebounceTicks > 0 {
+		switchDebounceTicks = cfg.SwitchDebounceTicks
+	}
+	slog.Info("Switch debounce set", "ticks", switchDebounceTicks)
+
+	// blacklist client IDs Discord keeps rejecting
+	if cfg.HandshakeFailureLimit != nil && *cfg.HandshakeFailureLimit >= 0 {
+		handshakeFailureLimit = *cfg.HandshakeFailureLimit
+	}
+	if cfg.HandshakeBlacklistMins > 0 {
+		handshakeBlacklistFor = time.Duration(cfg.HandshakeBlacklistMins) * time.Minute
+	}
+	if handshakeFailureLimit > 0 {
+		slog.Info("Handshake blacklist set", "failures", handshakeFailureLimit, "duration", handshakeBlacklistFor)
+	}
+
+	// reconnect between games that share a client ID
+	reconnectOnSwitch = cfg.ReconnectOnSwitch
+	if reconnectOnSwitch {
+		slog.Info("Reconnecting on every game switch.")
+	}
+
+	// set quiet-period heartbeat interval
+	if cfg.HeartbeatMinutes > 0 {
+		heartbeatInterval = time.Duration(cfg.HeartbeatMinutes) * time.Minute
+		slog.Info("Heartbeat interval set", "interval", heartbeatInterval)
+	}
+
+	// opt in to scanning every user's processes
+	scanAllUsers = cfg.ScanAllUsers
+	if scanAllUsers {
+		slog.Info("Scanning processes of all users.")
+	}
+
+	// set explicit Discord socket path or address
+	if cfg.SocketPath != "" {
+		if _, _, err := parseSocketAddress(cfg.SocketPath); err != nil {
+			slog.Warn("Ignoring invalid socket_path", "err", err)
+		} else {
+			socketPathOverride = cfg.SocketPath
+		}
+	}
+	if cfg.SocketFallback != nil {
+		socketFallback = *cfg.SocketFallback
+	}
+
+	// set preferred Discord client flavor for socket discovery
+	switch cfg.DiscordFlavor {
+	case "":
+	case "auto", "stable", "ptb", "canary":
+		discordFlavor = cfg.DiscordFlavor
+	default:
+		slog.Warn("Unknown discord_flavor. Using auto.", "flavor", cfg.DiscordFlavor)
+	}
+	slog.Info("Discord flavor set", "flavor", discordFlavor)
+
+	// load extra socket directories to probe
+	for _, dir := range cfg.SocketDirs {
+		if dir = expandPath(dir); dir != "" {
+			socketDirs = append(socketDirs, dir)
+		}
+	}
+	if len(socketDirs) > 0 {
+		slog.Info("Loaded extra socket directories", "dirs", socketDirs)
+	}
+
+	// set presence line templates
+	if cfg.DetailsTemplate != "" {
+		detailsTemplate = cfg.DetailsTemplate
+	}
+	if cfg.StateTemplate != "" {
+		stateTemplate = cfg.StateTemplate
+	}
+	if cfg.DeviceStateTemplate != nil {
+		deviceStateTemplate = *cfg.DeviceStateTemplate
+	}
+	if cfg.GenericDetailsTemplate != nil {
+		genericDetailsTemplate = *cfg.GenericDetailsTemplate
+	}
+	slog.Info("Presence templates set", "details", detailsTemplate, "state", stateTemplate)
+
+	// set hover text template for the large image
+	if cfg.LargeTextTemplate != "" {
+		largeTextTemplate = cfg.LargeTextTemplate
+		slog.Info("Large image text template set", "template", largeTextTemplate)
+	}
+
+	// load per-game template overrides
+	for name, templates := range cfg.GameTemplates {
+		gameTemplates[normalizeGameName(name)] = templates
+	}
+	if len(gameTemplates) > 0 {
+		slog.Info("Loaded per-game templates", "count", len(gameTemplates))
+	}
+
+	// opt in to cleaning up displayed game names
+	sanitizeDisplayNames = cfg.SanitizeDisplayNames
+
+	// load per-app categories and category -> verb mappings
+	for name, category := range cfg.AppCategories {
+		appCategories[normalizeGameName(name)] = category
+	}
+	for category, verb := range cfg.CategoryVerbs {
+		categoryVerbs[category] = verb
+	}
+	for category, activityType := range cfg.CategoryActivityTypes {
+		if !validActivityType(activityType) {
+			slog.Warn("Ignoring unsupported activity type. Use 0 (playing), 2 (listening), 3 (watching), or 5 (competing).", "category", category, "type", activityType)
+			continue
+		}
+		categoryActivityTypes[category] = activityType
+	}
+	slog.Info("Loaded app categories", "count", len(appCategories), "verbs", len(categoryVerbs), "activity_types", len(categoryActivityTypes))
+
+	// load dedicated server exe basenames per game
+	for name, exes := range cfg.ServerExecutables {
+		set := map[string]bool{}
+		for _, exe := range exes {
+			set[strings.ToLower(exe)] = true
+		}
+		serverExecutables[normalizeGameName(name)] = set
+	}
+	ignoreServers = cfg.IgnoreServers
+	if len(serverExecutables) > 0 {
+		slog.Info("Loaded server executables", "games", len(serverExecutables), "ignore", ignoreServers)
+	}
+
+	// load libretro core -> system label mappings
+	for core, system := range cfg.CoreSystems {
+		coreSystems[strings.ToLower(core)] = system
+	}
+
+	// opt in to detecting cloud gaming sessions from browser window titles
+	cloudGaming = cfg.CloudGaming
+	loadCloudPatterns(cfg.CloudTitlePatterns)
+	if cloudGaming {
+		slog.Info("Cloud gaming detection enabled.", "patterns", len(cloudPatterns))
+	}
+
+	// opt in to presenting media players, per category, when no game runs
+	for exe, category := range cfg.MediaProcesses {
+		mediaProcesses[strings.ToLower(exe)] = mediaApp{Name: exe, Category: category}
+	}
+	for _, category := range cfg.MediaPresence {
+		if _, ok := categoryActivityTypes[category]; !ok {
+			slog.Warn("Ignoring media_presence category without an activity type", "category", category)
+			continue
+		}
+		mediaCategories[category] = true
+	}
+	if cfg.MediaDetailsTemplate != nil {
+		mediaDetailsTemplate = *cfg.MediaDetailsTemplate
+	}
+	if len(mediaCategories) > 0 {
+		slog.Info("Media presence enabled.", "categories", sortedKeys(mediaCategories), "processes", len(mediaProcesses))
+	}
+
+	// load platform label -> small image asset key mappings
+	for platform, key := range cfg.PlatformImages {
+		platformImages[platform] = key
+	}
+	slog.Info("Loaded platform image mappings", "count", len(platformImages))
+
+	// load os-release ID -> small image asset key mappings over the built-ins
+	distroSmallImage = cfg.DistroSmallImage
+	for id, key := range cfg.DistroImages {
+		distroImages[strings.ToLower(id)] = key
+	}
+	if distroSmallImage {
+		slog.Info("Distro small image enabled", "mappings", len(distroImages))
+	}
+
+	// load per-game asset overrides. keys are normalized so either the Steam
+	// folder name or the display name works.
+	// images are normalized; ones Discord won't render are dropped.
+	for name, assets := range cfg.AssetOverrides {
+		var err error
+		if assets.LargeImage, err = normalizeAssetImage(assets.LargeImage); err != nil {
+			slog.Warn("Ignoring large image override", "game", loggedGame(name), "err", err)
+		}
+		if assets.SmallImage, err = normalizeAssetImage(assets.SmallImage); err != nil {
+			slog.Warn("Ignoring small image override", "game", loggedGame(name), "err", err)
+		}
+		assetOverrides[normalizeGameName(name)] = assets
+	}
+	slog.Info("Loaded asset overrides", "count", len(assetOverrides))
+
+	// load per-game party/secrets, dropping invalid party sizes and privacy.
+	// a party or secrets block left empty is dropped so Discord never gets {}
+	for name, extras := range cfg.ActivityExtras {
+		if extras.Party != nil && extras.Party.Size != nil {
+			if err := validatePartySize(extras.Party.Size); err != nil {
+				slog.Warn("Ignoring invalid party size", "game", loggedGame(name), "err", err)
+				extras.Party.Size = nil
+			}
+		}
+		if extras.Party != nil && extras.Party.Privacy != partyPrivate && extras.Party.Privacy != partyPublic {
+			slog.Warn("Ignoring invalid party privacy", "game", loggedGame(name), "privacy", extras.Party.Privacy)
+			extras.Party.Privacy = partyPrivate
+		}
+		if extras.Party != nil && extras.Party.ID == "" && extras.Party.Size == nil && extras.Party.Privacy == partyPrivate {
+			extras.Party = nil
+		}
+		if extras.Secrets != nil && *extras.Secrets == (ActivitySecrets{}) {
+			extras.Secrets = nil
+		}
+		activityExtras[normalizeGameName(name)] = extras
+	}
+	slog.Info("Loaded activity extras", "count", len(activityExtras))
+
+	// set the activity instance flag
+	activityInstance = cfg.ActivityInstance
+
+	// name the activity after the game
+	activityName = cfg.ActivityName
+
+	// send start timestamps for Discord's elapsed timer
+	showElapsedTime = cfg.ShowElapsedTime
+	slog.Info("Elapsed time display set", "enabled", showElapsedTime)
+
+	// enable SteamGridDB cover art
+	steamGridDBKey = cfg.SteamGridDBKey
+	if steamGridDBKey != "" {
+		slog.Info("SteamGridDB artwork enabled.")
+	}
+
+	// set large image priority, dropping unknown sources
+	if cfg.ImageSources != nil {
+		imageSources = nil
+		for _, source := range cfg.ImageSources {
+			switch source {
+			case imageOverride, imageSteamGridDB, imageIcon, imageDefault:
+				imageSources = append(imageSources, source)
+			default:
+				slog.Warn("Ignoring unknown image source. Use override, steamgriddb, icon, or default.", "source", source)
+			}
+		}
+		slog.Info("Large image sources set", "sources", imageSources)
+	}
+}
+
+// expand environment variables ($VAR, ${VAR}) and a leading ~ in a path
+func expandPath(path string) string {
+	path = os.ExpandEnv(strings.TrimSpace(path))
+	if path == "~" || strings.HasPrefix(path, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			path = home + path[1:]
+		}
+	}
+	return path
+}
+
+// game names from a list file referenced by the config. relative paths are
+// resolved against the config file's directory. an unreadable file is logged
+// and contributes nothing.
+func readConfigNameList(configFile string, path string) []string {
+	if path == "" {
+		return nil
+	}
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(filepath.Dir(configFile), path)
+	}
+	names, err := readNameList(path)
+	if err != nil {
+		slog.Warn("Failed to read game list file", "path", path, "err", err)
+		return nil
+	}
+	slog.Info("Read game list file", "path", path, "count", len(names))
+	return names
+}
+
+// read a newline-delimited list of names, skipping blank lines and # comments
+func readNameList(path string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		names = append(names, line)
+	}
+	return names, nil
+}
+
+// placeholder for secrets in the effective config
+const redacted = "<redacted>"
+
+// the configuration in effect after defaults, config file, and flags are
+// merged, in config.json form. map-backed lists are sorted, and names are
+// shown normalized since that's how they're matched.
+func effectiveConfig() Config {
+	cfg := Config{
+		ScanIntervalSeconds:    int(scanInterval / time.Second),
+		ScanIntervalOverrides:  map[string]int{},
+		PowerSave:              powerSave,
+		PowerSaveSeconds:       int(powerSaveInterval / time.Second),
+		IgnoredGames:           sortedKeys(ignoredGames),
+		AllowedGames:           sortedKeys(allowedGames),
+		GamePriority:           priorityOrder(),
+		IgnoredProcesses:       sortedKeys(ignoredProcesses),
+		LauncherProcesses:      sortedKeys(launcherProcesses),
+		DiscordApiVersion:      discordApiVersion,
+		HandshakeVersion:       handshakeVersion,
+		NonceStrategy:          nonceStrategy,
+		GameCacheTTLDays:       int(gameCacheTTL / (24 * time.Hour)),
+		DisableCache:           disableCache,
+		ManualMappings:         manualMappings,
+		MatchStrategy:          matchStrategy,
+		TextOverflow:           textOverflow,
+		DefaultClientID:        defaultClientID,
+		UnmatchedPolicy:        unmatchedPolicy,
+		DetailsTemplate:        detailsTemplate,
+		StateTemplate:          stateTemplate,
+		LargeTextTemplate:      largeTextTemplate,
+		DeviceStateTemplate:    &deviceStateTemplate,
+		GenericDetailsTemplate: &genericDetailsTemplate,
+		GameTemplates:          gameTemplates,
+		SanitizeDisplayNames:   sanitizeDisplayNames,
+		AppCategories:          appCategories,
+		CategoryVerbs:          categoryVerbs,
+		CategoryActivityTypes:  categoryActivityTypes,
+		PlatformImages:         platformImages,
+		DistroSmallImage:       distroSmallImage,
+		DistroImages:           distroImages,
+		AssetOverrides:         assetOverrides,
+		ActivityExtras:         activityExtras,
+		ExitGracePeriodSeconds: int(exitGracePeriod / time.Second),
+		MinSessionSeconds:      int(minSession / time.Second),
+		LogAnonymizeGames:      anonymizeGames,
+		SwitchDebounceTicks:    switchDebounceTicks,
+		ReconnectOnSwitch:      reconnectOnSwitch,
+		HandshakeFailureLimit:  &handshakeFailureLimit,
+		HandshakeBlacklistMins: int(handshakeBlacklistFor / time.Minute),
+		ScanAllUsers:           scanAllUsers,
+		HeartbeatMinutes:       int(heartbeatInterval / time.Minute),
+		SocketPath:             socketPathOverride,
+		SocketFallback:         &socketFallback,
+		DiscordFlavor:          discordFlavor,
+		SocketDirs:             socketDirs,
+		CoreSystems:            coreSystems,
+		ServerExecutables:      map[string][]string{},
+		IgnoreServers:          ignoreServers,
+		CloudGaming:            cloudGaming,
+		MediaPresence:          sortedKeys(mediaCategories),
+		MediaProcesses:         map[string]string{},
+		MediaDetailsTemplate:   &mediaDetailsTemplate,
+	}
+	for exe, app := range mediaProcesses {
+		cfg.MediaProcesses[exe] = app.Category
+	}
+	for name, exes := range serverExecutables {
+		cfg.ServerExecutables[name] = sortedKeys(exes)
+	}
+	for name, interval := range scanIntervalOverrides {
+		cfg.ScanIntervalOverrides[name] = int(interval / time.Second)
+	}
+	if steamGridDBKey != "" {
+		cfg.SteamGridDBKey = redacted
+	}
+	cfg.ImageSources = imageSources
+	cfg.ActivityInstance = activityInstance
+	cfg.ActivityName = activityName
+	cfg.ShowElapsedTime = showElapsedTime
+	minAge := int(minProcessAge / time.Second)
+	cfg.MinProcessAgeSeconds = &minAge
+	for _, p := range cloudPatterns {
+		cfg.CloudTitlePatterns = append(cfg.CloudTitlePatterns, CloudTitlePattern{Pattern: p.re.String(), Platform: p.platform})
+	}
+	return cfg
+}
+
+// write the effective config as indented JSON
+func writeEffectiveConfig(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(effectiveConfig())
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Paths is the resolved location of the config file, game cache file, and
+// saved presence state.
+type Paths struct {
+	Config   string
+	Cache    string
+	State    string
+	Presence string // sidecar presence files, <game>.json
+}
+
+// config file names looked for in a config dir, in order of precedence
+var configFileNames = []string{"config.json", "config.toml"}
+
+// the first config file that exists in dir, or "" if there's none
+func findConfigFile(dir string) string {
+	for _, name := range configFileNames {
+		path := filepath.Join(dir, name)
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+	return ""
+}
+
+// resolvePaths picks development paths when run from the repo (config.json
+// or config.toml in cwd) and otherwise falls back to the user's standard
+// config/cache dirs (~/.config and ~/.cache on Linux, honoring XDG_* if set).
+// config.json wins when a dir has both.
+func resolvePaths() Paths {
+	const appName = "discord-rpc-bridge"
+
+	cwd, _ := os.Getwd()
+	if localConfig := findConfigFile(cwd); localConfig != "" {
+		slog.Info("MODE: Development (repo paths)")
+		return Paths{
+			Config:   localConfig,
+			Cache:    filepath.Join(cwd, "data", "games.json"),
+			State:    filepath.Join(cwd, "data", "state.json"),
+			Presence: filepath.Join(cwd, "data", "presence"),
+		}
+	}
+
+	slog.Info("MODE: Deployed (user config/cache dirs)")
+
+	configDir, _ := os.UserConfigDir()
+	appConfigDir := filepath.Join(configDir, appName)
+	_ = os.MkdirAll(appConfigDir, 0755)
+
+	cacheDir, _ := os.UserCacheDir()
+	appCacheDir := filepath.Join(cacheDir, appName)
+	_ = os.MkdirAll(appCacheDir, 0755)
+
+	config := findConfigFile(appConfigDir)
+	if config == "" {
+		config = filepath.Join(appConfigDir, "config.json")
+	}
+	return Paths{
+		Config:   config,
+		Cache:    filepath.Join(appCacheDir, "games.json"),
+		State:    filepath.Join(appCacheDir, "state.json"),
+		Presence: filepath.Join(appConfigDir, "presence"),
+	}
+}
+
+// log level shared by every handler so it can be set once at startup
+var logLevel = new(slog.LevelVar)
+
+// configure the default slog logger. "text" keeps the familiar log package
+// line format (timestamp, level, message, key=value fields); "json" emits one
+// JSON object per line for log aggregators. level "off" discards all logs.
+func setupLogging(format string, level string) error {
+	if format != "text" && format != "json" {
+		return fmt.Errorf("invalid -log-format %q: must be text or json", format)
+	}
+	if level == "off" {
+		slog.SetDefault(slog.New(slog.DiscardHandler))
+		return nil
+	}
+
+	var lvl slog.Level
+	if err := lvl.UnmarshalText([]byte(level)); err != nil {
+		return fmt.Errorf("invalid -log-level %q: %w", level, err)
+	}
+	logLevel.Set(lvl)
+
+	if format == "json" {
+		slog.SetDefault(slog.New(slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{Level: logLevel})))
+	} else {
+		slog.SetLogLoggerLevel(lvl)
+	}
+	return nil
+}
+
+// where the key for log_anonymize_games hashes is kept, next to the game
+// list cache. empty keeps a key in memory for this run only.
+var logKeyFile string
+
+// the random per-install key anonymized log values are hashed with, so they
+// can't be reversed by hashing the public game list. loaded on first use.
+var logKey = sync.OnceValue(func() []byte { return loadLogKey(logKeyFile) })
+
+// read the log anonymization key from path, creating it if it's missing or
+// malformed. empty path makes a key that isn't saved.
+func loadLogKey(path string) []byte {
+	if path != "" {
+		if key, err := os.ReadFile(path); err == nil && len(key) == 32 {
+			return key
+		}
+	}
+	key := make([]byte, 32)
+	crand.Read(key)
+	if path != "" {
+		if err := os.WriteFile(path, key, 0600); err != nil {
+			slog.Warn("Failed to save the log anonymization key. Hashes won't match across runs.", "path", path, "err", err)
+		}
+	}
+	return key
+}
+
+// a short keyed hash of s with a prefix naming what it is, ex: "game-1a2b3c4d"
+func anonymized(prefix, s string) slog.Value {
+	mac := hmac.New(sha256.New, logKey())
+	mac.Write([]byte(s))
+	return slog.StringValue(prefix + "-" + hex.EncodeToString(mac.Sum(nil)[:4]))
+}
+
+// loggedGame is a game name as a log value. with log_anonymize_games it logs
+// as a keyed hash of the normalized name, stable across runs so events for
+// one game can still be correlated.
+type loggedGame string
+
+func (g loggedGame) LogValue() slog.Value {
+	if !anonymizeGames {
+		return slog.StringValue(string(g))
+	}
+	return anonymized("game", normalizeGameName(string(g)))
+}
+
+// the normalized name a game is looked up by, as a log attr. it's the hint
+// for writing a mapping, so it's left out rather than hashed when
+// anonymizing game names.
+func normalizedAttr(name string) slog.Attr {
+	if anonymizeGames {
+		return slog.Attr{}
+	}
+	return slog.String("normalized", normalizeGameName(name))
+}
+
+// loggedID is a Discord client ID or Steam appid as a log value. either names
+// the game through a public list, so with log_anonymize_games it's hashed
+// like the game name.
+type loggedID string
+
+func (id loggedID) LogValue() slog.Value {
+	if !anonymizeGames || id == "" {
+		return slog.StringValue(string(id))
+	}
+	return anonymized("id", string(id))
+}
+
+// loggedPath is a file path as a log value. paths like a sidecar's are named
+// after the game, so with log_anonymize_games only the directory is logged.
+type loggedPath string
+
+func (p loggedPath) LogValue() slog.Value {
+	if !anonymizeGames {
+		return slog.StringValue(string(p))
+	}
+	return slog.StringValue(filepath.Join(filepath.Dir(string(p)), "..."))
+}
+
+// loggedPayload is a raw IPC payload as a log value. activity frames carry
+// game names, so with log_anonymize_games only the size is logged.
+type loggedPayload string
+
+func (p loggedPayload) LogValue() slog.Value {
+	if !anonymizeGames {
+		return slog.StringValue(string(p))
+	}
+	return slog.StringValue(fmt.Sprintf("(%d bytes, anonymized)", len(p)))
+}
+
+// how often a game list that failed to load at startup is retried
+var gameListRetryInterval = time.Minute
+
+// load the game list in the background until it succeeds, then hand it to
+// the scan loop, which owns the lookup maps
+func retryGameList(ctx context.Context, src gameListSource, ready chan<- []DetectableApp) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(gameListRetryInterval):
+		}
+		apps, err := loadGameApps(src)
+		if err != nil {
+			slog.Warn("Game list still unavailable. Presence stays disabled.", "err", err, "retry_in", gameListRetryInterval)
+			continue
 		}
+		ready <- apps
+		return
 	}
-	return ""
 }
 
-// scan active processes of current user for active games
-func scanProcesses() (string, int) {
-	entries, err := os.ReadDir("/proc")
+// fetch a fresh game list for a SIGHUP reload, falling back to the cache if
+// the fetch fails. nil if neither worked, keeping the current list.
+func reloadGameList(src gameListSource) []DetectableApp {
+	var apps []DetectableApp
+	var err error
+	source := "fetched"
+	if src.NoCache {
+		apps, _, err = fetchGameList(src.URL, io.Discard)
+	} else if apps, err = refreshGameCache(src); err != nil {
+		slog.Warn("Game list fetch failed. Reloading from cache.", "err", err)
+		source = "cache"
+		apps, err = readGameCache(src.CacheFile)
+	}
+	if err == nil && len(apps) < minDetectableApps {
+		err = fmt.Errorf("game list has only %d apps (want at least %d)", len(apps), minDetectableApps)
+	}
 	if err != nil {
-		return "", 0
+		slog.Warn("Game list reload failed. Keeping the current list.", "err", err)
+		return nil
 	}
-	for _, entry := range entries {
-		if !entry.IsDir() {
-			continue
-		}
+	slog.Info("Reloaded game list", "source", source, "apps", len(apps))
+	return apps
+}
 
-		// check if PID
-		pidStr := entry.Name()
-		if pidStr[0] < '0' || pidStr[0] > '9' {
-			continue
-		}
+// how often the presented game's process is checked for exit between scans
+const pidCheckInterval = 2 * time.Second
 
-		// check symlink for native Steam games
-		var gameName string
-		exePath, err := os.Readlink(filepath.Join("/proc", pidStr, "exe")) // /proc/<pid>/exe
-		if err == nil {
-			// skip wrapper/launcher processes that carry game paths in their cmdline
-			if ignoredProcesses[filepath.Base(exePath)] {
-				continue
-			}
-			gameName = extractSteamGameName(exePath)
-		}
+// how long -once keeps the connection open after setting activity, so
+// Discord has processed the frame before the close
+const onceLinger = 2 * time.Second
 
-		// fallback: check command line args (for proton games)
-		if gameName == "" {
-			gameName = scanCmdline(pidStr)
-		}
+// scan once, present the result, and close the connection cleanly.
+// with no game there's nothing to present: activity belongs to the
+// connection that set it, so it can't be cleared from a new one.
+func runOnce(osRelease string) error {
+	game, forced := forcedGame()
+	if !forced {
+		game = detectGame()
+	}
+	if game.Name == "" {
+		slog.Info("No game found. Nothing to present.")
+		return nil
+	}
 
-		if gameName != "" && !isIgnoredGame(gameName) {
-			pid, _ := strconv.Atoi(pidStr)
-			return gameName, pid
-		}
+	conn, err := presentGame(game, osRelease)
+	if err != nil {
+		return err
 	}
-	return "", 0
+	defer conn.Close()
+
+	time.Sleep(onceLinger)
+	return sendIPCPacket(conn, opClose, []byte("{}"))
 }
 
-// read /etc/os-release to display in the Discord status
-func readOSRelease() string {
-	file, err := os.Open("/etc/os-release")
+// how long -test-presence shows the activity before clearing it
+var testPresenceHold = 10 * time.Second
+
+// present name without detecting anything, hold it long enough to check in
+// Discord, then clear it. tests the IPC half of the bridge on its own.
+func runTestPresence(name string, osRelease string) error {
+	game := DetectedGame{Name: name, Pid: os.Getpid(), Method: "test"}
+	conn, err := presentGame(game, osRelease)
 	if err != nil {
-		log.Printf("ERROR: Could not open /etc/os-release: %v", err)
-		return runtime.GOOS
+		return err
 	}
-	defer file.Close()
+	defer conn.Close()
 
-	distroInfo := make(map[string]string)
-	scanner := bufio.NewScanner(file)
-	for scanner.Scan() {
-		line := scanner.Text()
-		parts := strings.SplitN(line, "=", 2)
+	slog.Info("Holding test presence. Check your Discord profile.", "game", loggedGame(name), "hold", testPresenceHold)
+	time.Sleep(testPresenceHold)
+	nonce, err := sendActivity(conn, DetectedGame{}, osRelease)
+	if err != nil {
+		return fmt.Errorf("clear activity: %w", err)
+	}
+	if _, err := awaitReply(conn, nonce); err != nil {
+		slog.Warn("No reply to clearing the activity", "err", err)
+	}
+	slog.Info("Cleared test presence.", "game", loggedGame(name))
+	return sendIPCPacket(conn, opClose, []byte("{}"))
+}
 
-		if len(parts) == 2 {
-			key := strings.TrimSpace(parts[0])
-			value := strings.Trim(strings.TrimSpace(parts[1]), "\"")
-			distroInfo[key] = value
-		}
+// connect as game's client ID and set its activity, for the one-shot modes.
+// the caller closes the connection.
+func presentGame(game DetectedGame, osRelease string) (*IpcConn, error) {
+	socketPath, err := locateDiscordSocket()
+	if err != nil {
+		return nil, err
+	}
+	clientID, match := resolveGameClientID(game)
+	if match == matchNone {
+		return nil, fmt.Errorf("no Discord app matches %q (add a manual_mappings entry, or set unmatched_policy)", game.Name)
+	}
+	if !presentableClientID(clientID) {
+		return nil, fmt.Errorf("%q maps to client ID %q (fix its manual_mappings entry)", game.Name, clientID)
+	}
+	game.Generic = presentsGeneric(match)
+	game.ClientID = clientID
+	conn, err := connectIPC(socketPath, clientID)
+	if err != nil {
+		return nil, err
 	}
 
-	if err := scanner.Err(); err != nil {
-		log.Printf("Error reading /etc/os-release: %v", err)
-		return runtime.GOOS
+	nonce, err := sendActivity(conn, game, osRelease)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("set activity: %w", err)
 	}
+	reply, err := awaitReply(conn, nonce)
+	var derr *discordError
+	switch {
+	case errors.As(err, &derr):
+		conn.Close()
+		return nil, fmt.Errorf("set activity: %w", err)
+	case err != nil:
+		slog.Warn("No reply to activity update", "err", err)
+	default:
+		slog.Debug("Discord response", "payload", loggedPayload(reply))
+	}
+	slog.Info("Presented game", "game", loggedGame(game.Name), "client_id", loggedID(clientID), "pid", game.Pid, "appid", loggedID(game.AppID), "method", game.Method, "match", match)
+	return conn, nil
+}
 
-	if name, ok := distroInfo["PRETTY_NAME"]; ok {
-		return name
-	} else if name, ok := distroInfo["NAME"]; ok {
-		return name
+// whether switching from the connected game to gameName needs a new
+// connection. a different client ID always does; a game sharing the
+// connection's client ID only with reconnect_on_switch, otherwise its
+// activity replaces the current one on the same connection.
+func switchNeedsReconnect(currentClientID string, targetClientID string, currentGame string, gameName string) bool {
+	if currentClientID != targetClientID {
+		return true
 	}
-	return runtime.GOOS
+	return reconnectOnSwitch && currentGame != gameName
 }
 
-// send the IPC packet to Discord to update your activity
-func setActivity(conn net.Conn, appName string, pid int, osRelease string) error {
-	activity := Activity{}
+// switchDebouncer holds off switching to a different game until it has
+// been seen on switchDebounceTicks consecutive ticks, so two games briefly
+// running together (one quitting, one launching) don't flip presence back
+// and forth
+type switchDebouncer struct {
+	game  string // candidate game
+	ticks int    // consecutive ticks the candidate has been seen
+}
 
-	if appName != "" {
-		state := fmt.Sprintf("On %s", osRelease)
-		activity = Activity{
-			Details: "Playing " + appName,
-			State:   state,
-			Assets: ActivityAssets{
-				LargeImage: "default",
-				LargeText:  appName,
-			},
-		}
+// record a tick where game differs from the presented one. returns true
+// once it has been seen long enough to switch.
+func (d *switchDebouncer) ready(game string) bool {
+	if d.game != game {
+		d.game = game
+		d.ticks = 0
 	}
-	payload := DiscordRpcPayload{
-		Cmd:   "SET_ACTIVITY",
-		Nonce: fmt.Sprintf("%d", time.Now().UnixNano()),
-		Args: ActivityArgs{
-			Pid:      pid,
-			Activity: activity,
-		},
+	d.ticks++
+	if d.ticks < switchDebounceTicks {
+		return false
 	}
-	data, _ := json.Marshal(payload)
-	return sendIPCPacket(conn, 1, data) // opcode 1 = frame
+	d.reset()
+	return true
 }
 
-// load configuration from JSON
-func loadConfig(configFile string) {
-	file, err := os.ReadFile(configFile)
-	if err != nil {
-		log.Println("No config.json found. Using defaults.")
-		return
-	}
+// forget the candidate, ex: when the presented game is seen again
+func (d *switchDebouncer) reset() {
+	d.game = ""
+	d.ticks = 0
+}
 
-	var cfg Config
-	if err := json.Unmarshal(file, &cfg); err != nil {
-		log.Printf("Error parsing config.json: %v. Using defaults.", err)
-		return
-	}
+// sessionGate withholds a game until it has been detected continuously for
+// minSession, so benchmark and verify launches are never presented
+type sessionGate struct {
+	game  string    // game detected on the last tick
+	since time.Time // when game was first detected in a row
+}
 
-	// set interval
-	if cfg.ScanIntervalSeconds > 0 {
-		scanInterval = time.Duration(cfg.ScanIntervalSeconds) * time.Second
+// record a tick where game was detected ("" for none). returns true once it
+// has been detected for at least minSession.
+func (g *sessionGate) ready(game string, now time.Time) bool {
+	if g.game != game {
+		g.game = game
+		g.since = now
 	}
-	log.Printf("Scan interval set to %v.", scanInterval)
+	return now.Sub(g.since) >= minSession
+}
 
-	// merge ignored games
-	for _, name := range cfg.IgnoredGames {
-		ignoredGames[name] = true
-	}
-	log.Printf("Loaded %d ignored game entries.", len(ignoredGames))
+// handshakeBlacklist counts consecutive handshake rejections per client ID
+// and, after handshakeFailureLimit of them, stops connecting with the ID
+// until handshakeBlacklistFor has passed. a bad manual_mappings entry or a
+// delisted app would otherwise be retried forever.
+type handshakeBlacklist struct {
+	failures map[string]int
+	until    map[string]time.Time
+}
 
-	// merge ignored processes
-	for _, name := range cfg.IgnoredProcesses {
-		ignoredProcesses[name] = true
-	}
-	log.Printf("Loaded %d ignored process entries.", len(ignoredProcesses))
+func newHandshakeBlacklist() *handshakeBlacklist {
+	return &handshakeBlacklist{failures: map[string]int{}, until: map[string]time.Time{}}
+}
 
-	// load manual game name -> Discord client ID mappings
-	for name, id := range cfg.ManualMappings {
-		manualMappings[name] = id
+// record a rejected handshake. returns true if it blacklisted clientID.
+func (b *handshakeBlacklist) rejected(clientID string, now time.Time) bool {
+	b.failures[clientID]++
+	if handshakeFailureLimit == 0 || b.failures[clientID] < handshakeFailureLimit {
+		return false
 	}
-	log.Printf("Loaded %d manual game mappings.", len(manualMappings))
+	b.until[clientID] = now.Add(handshakeBlacklistFor)
+	return true
+}
 
-	// set Discord API version in URL
-	if cfg.DiscordApiVersion > 0 {
-		discordApiUrl = fmt.Sprintf("https://discord.com/api/v%d/applications/detectable", cfg.DiscordApiVersion)
-	}
-	log.Printf("Using Discord API URL: %s", discordApiUrl)
+// record a successful handshake, forgetting earlier failures
+func (b *handshakeBlacklist) accepted(clientID string) {
+	delete(b.failures, clientID)
+	delete(b.until, clientID)
+}
 
-	// set game data cache TTL
-	if cfg.GameCacheTTLDays > 0 {
-		gameCacheTTL = time.Duration(cfg.GameCacheTTLDays*24) * time.Hour
+// true while clientID is blacklisted. an expired entry is dropped, and the
+// ID gets a fresh run of attempts.
+func (b *handshakeBlacklist) blocked(clientID string, now time.Time) bool {
+	until, ok := b.until[clientID]
+	if !ok {
+		return false
 	}
-	log.Printf("Game cache TTL set to %v.", gameCacheTTL)
+	if now.Before(until) {
+		return true
+	}
+	b.accepted(clientID)
+	return false
 }
 
-// Paths is the resolved location of the config file and game cache file.
-type Paths struct {
-	Config string
-	Cache  string
+// blacklisted client IDs for the status endpoint, sorted by ID
+func (b *handshakeBlacklist) entries() []BlacklistedClient {
+	entries := make([]BlacklistedClient, 0, len(b.until))
+	for _, id := range sortedKeys(b.until) {
+		entries = append(entries, BlacklistedClient{ClientID: id, Failures: b.failures[id], Until: b.until[id]})
+	}
+	return entries
 }
 
-// resolvePaths picks development paths when run from the repo (config.json
-// in cwd) and otherwise falls back to the user's standard config/cache dirs
-// (~/.config and ~/.cache on Linux, honoring XDG_* if set).
-func resolvePaths() Paths {
-	const appName = "discord-rpc-bridge"
+// sessionClock remembers when the presented game's session started, so a
+// restart within the exit grace period (a new process) doesn't reset
+// {elapsed} or Discord's elapsed timer
+type sessionClock struct {
+	game  string
+	start time.Time
+}
 
-	cwd, _ := os.Getwd()
-	localConfig := filepath.Join(cwd, "config.json")
-	if _, err := os.Stat(localConfig); err == nil {
-		log.Println("MODE: Development (repo paths)")
-		return Paths{
-			Config: localConfig,
-			Cache:  filepath.Join(cwd, "data", "games.json"),
-		}
+// session start for game. a game other than the last one starts a new
+// session, from its process start.
+func (c *sessionClock) startFor(game DetectedGame) time.Time {
+	if c.game != game.Name || c.start.IsZero() {
+		c.game = game.Name
+		c.start = sessionStartFor(game)
 	}
+	return c.start
+}
 
-	log.Println("MODE: Deployed (user config/cache dirs)")
+// forget the session, ex: when presence is cleared
+func (c *sessionClock) reset() {
+	*c = sessionClock{}
+}
 
-	configDir, _ := os.UserConfigDir()
-	appConfigDir := filepath.Join(configDir, appName)
-	_ = os.MkdirAll(appConfigDir, 0755)
+// unmatchedGames remembers the normalized names already reported as having
+// no Discord app, so each one is logged at info level once per run
+type unmatchedGames map[string]bool
 
-	cacheDir, _ := os.UserCacheDir()
-	appCacheDir := filepath.Join(cacheDir, appName)
-	_ = os.MkdirAll(appCacheDir, 0755)
+// true the first time a game normalizing to name's key is seen
+func (u unmatchedGames) first(name string) bool {
+	key := normalizeGameName(name)
+	if u[key] {
+		return false
+	}
+	u[key] = true
+	return true
+}
 
-	return Paths{
-		Config: filepath.Join(appConfigDir, "config.json"),
-		Cache:  filepath.Join(appCacheDir, "games.json"),
+// leave names out of the -help listing. they still parse as usual.
+func hideFlags(names ...string) {
+	flag.Usage = func() {
+		visible := flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+		visible.SetOutput(flag.CommandLine.Output())
+		flag.VisitAll(func(f *flag.Flag) {
+			if !slices.Contains(names, f.Name) {
+				visible.Var(f.Value, f.Name, f.Usage)
+			}
+		})
+		fmt.Fprintf(visible.Output(), "Usage of %s:\n", os.Args[0])
+		visible.PrintDefaults()
 	}
 }
 
+// log at error level and exit, like log.Fatalf for slog
+func fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
+
 func main() {
 	versionFlag := flag.Bool("version", false, "print version and exit")
+	logLevelFlag := flag.String("log-level", "info", "log level: debug, info, warn, error, or off")
+	quietFlag := flag.Bool("quiet", false, "only log errors (same as -log-level error unless -log-level is off)")
+	logFormatFlag := flag.String("log-format", "text", "log format: text or json")
+	configFlag := flag.String("config", "", "config file to load, JSON or TOML by extension (default: config.json or config.toml in the config dir)")
+	socketFlag := flag.String("socket", "", "Discord IPC socket path, or a unix:// or tcp:// address (overrides socket_path and discovery)")
+	noCacheFlag := flag.Bool("no-cache", false, "always download the game list; never read or write the cache (same as disable_cache)")
+	refreshCacheFlag := flag.Bool("refresh-cache", false, "download a fresh game list (ignoring the cache TTL), rewrite the cache, and exit")
+	onceFlag := flag.Bool("once", false, "scan once, set activity for the detected game, then exit")
+	auditFlag := flag.Bool("audit", false, "list installed Steam games and whether each resolves to a Discord app, then exit")
+	statusAddrFlag := flag.String("status-addr", "", "serve a JSON status report at http://<addr>/status (ex: 127.0.0.1:8787)")
+	eventSocketFlag := flag.String("event-socket", "", "listen on this Unix socket path and emit newline-delimited JSON state change events")
+	doctorFlag := flag.Bool("doctor", false, "check the socket, handshake, /proc, game list cache, os-release, and installed games, print a checklist, and exit (non-zero if a critical check fails)")
+	testPresenceFlag := flag.String("test-presence", "", "present this game name without detecting anything, hold it for a few seconds, clear it, and exit")
+	daemonFlag := flag.Bool("daemon", false, "detach from the terminal and run in the background, logging to -log-file and writing -pid-file")
+	foregroundFlag := flag.Bool("foreground", false, "run in the foreground (the default; overrides -daemon)")
+	logFileFlag := flag.String("log-file", "", "log file for -daemon (default: discord-rpc-bridge.log in the cache dir)")
+	pidFileFlag := flag.String("pid-file", "", "pid file for -daemon (default: $XDG_RUNTIME_DIR/discord-rpc-bridge.pid)")
+	traceIPCFlag := flag.Bool("trace-ipc", false, "log every IPC frame sent and received (hex header and JSON payload); needs -log-level debug")
+	printConfigFlag := flag.Bool("print-config", false, "print the effective configuration (defaults, config file, and flags merged) as JSON, then exit")
+	// test-only, so left out of -help
+	recordFramesFlag := flag.String("record-frames", "", "append every IPC frame sent to this file as JSON lines, for golden tests")
+	hideFlags("record-frames")
 	flag.Parse()
 	if *versionFlag {
 		fmt.Println(version)
 		return
 	}
 
-	log.Printf("Starting discord-rpc-bridge %s...", version)
+	level := *logLevelFlag
+	if *quietFlag && level != "off" {
+		level = "error"
+	}
+	if err := setupLogging(*logFormatFlag, level); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(2)
+	}
+
+	slog.Info("Starting discord-rpc-bridge...", "version", version)
 
 	paths := resolvePaths()
-	loadConfig(paths.Config)
+	logKeyFile = filepath.Join(filepath.Dir(paths.Cache), "log-key")
+	if *configFlag != "" {
+		paths.Config = *configFlag
+	}
+	if *socketFlag != "" {
+		if _, _, err := parseSocketAddress(*socketFlag); err != nil {
+			fatal("Invalid -socket", "err", err)
+		}
+	}
+	// flags win over the config file, at startup and on every reload
+	loadSettings := func() {
+		loadConfig(paths.Config)
+		if *socketFlag != "" {
+			socketPathOverride = *socketFlag
+		}
+		if socketPathOverride != "" {
+			slog.Info("Using configured Discord socket", "socket", socketPathOverride, "fallback", socketFallback)
+		}
+		if *noCacheFlag {
+			disableCache = true
+		}
+	}
+	loadSettings()
+	traceIPC = *traceIPCFlag
+	if *recordFramesFlag != "" {
+		recordFile, err := os.OpenFile(*recordFramesFlag, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			fatal("Failed to open frame recording", "path", *recordFramesFlag, "err", err)
+		}
+		defer recordFile.Close()
+		recordFrames = newFrameRecorder(recordFile)
+		slog.Debug("Recording sent IPC frames", "path", *recordFramesFlag)
+	}
+	if *printConfigFlag {
+		if err := writeEffectiveConfig(os.Stdout); err != nil {
+			fatal("Failed to print config", "err", err)
+		}
+		return
+	}
+
+	if *refreshCacheFlag {
+		if disableCache {
+			fatal("-refresh-cache writes the cache, which is disabled")
+		}
+		apps, err := refreshGameCache(currentGameListSource(paths.Cache))
+		if err != nil {
+			fatal("Failed to refresh game list cache", "err", err)
+		}
+		populateMap(apps)
+		info, err := os.Stat(paths.Cache)
+		if err != nil {
+			fatal("Failed to stat game list cache", "err", err)
+		}
+		fmt.Printf("Indexed %d games (%d apps, %d with assets, %d bytes) into %s\n", len(nameToID), appCount(), appsWithAssets(), info.Size(), paths.Cache)
+		return
+	}
+
+	if *doctorFlag {
+		if !writeDoctor(os.Stdout, runDoctor(paths, installedSteamApps())) {
+			os.Exit(1)
+		}
+		return
+	}
+
+	// -daemon re-execs detached and exits; the child writes the pid file
+	logFile, pidFile := defaultDaemonFiles(paths)
+	if *logFileFlag != "" {
+		logFile = *logFileFlag
+	}
+	if *pidFileFlag != "" {
+		pidFile = *pidFileFlag
+	}
+	if *daemonFlag && !*foregroundFlag {
+		if *auditFlag || *onceFlag || *testPresenceFlag != "" {
+			fatal("-daemon only applies to the scanner, not -audit, -once, or -test-presence")
+		}
+		if err := checkPidFile(pidFile); err != nil {
+			fatal("Not starting daemon", "err", err)
+		}
+		pid, err := startDaemon(daemonArgs(os.Args[1:]), logFile)
+		if err != nil {
+			fatal("Failed to start daemon", "err", err)
+		}
+		fmt.Printf("Started discord-rpc-bridge in the background (pid %d). Logging to %s\n", pid, logFile)
+		return
+	}
+	if isDaemonChild() {
+		if err := writePidFile(pidFile); err != nil {
+			fatal("Failed to write pid file", "path", pidFile, "err", err)
+		}
+		defer os.Remove(pidFile)
+		slog.Info("Running as daemon", "pid", os.Getpid(), "pid_file", pidFile)
+	}
 
-	if err := loadGameData(paths.Cache); err != nil {
-		log.Fatalf("Failed to load database: %v", err)
+	// without a game list, the service still scans and logs what it finds
+	// (detection-only mode) and keeps retrying; -audit, -once, and
+	// -test-presence need it now
+	gameListErr := loadGameData(paths.Cache)
+	if gameListErr != nil && (*auditFlag || *onceFlag || *testPresenceFlag != "") {
+		fatal("Failed to load database", "err", gameListErr)
+	}
+	if *auditFlag {
+		writeAudit(os.Stdout, installedSteamApps())
+		return
 	}
 	osRelease := readOSRelease()
-	log.Printf("Detected OS release: %s", osRelease)
+	distroIDs = osReleaseIDs("/etc/os-release")
+	slog.Info("Detected OS release", "os", osRelease, "ids", distroIDs)
+	presenceDir = paths.Presence
+
+	if *onceFlag {
+		if err := runOnce(osRelease); err != nil {
+			fatal("Single scan failed", "err", err)
+		}
+		return
+	}
+	if *testPresenceFlag != "" {
+		if err := runTestPresence(*testPresenceFlag, osRelease); err != nil {
+			fatal("Test presence failed", "game", loggedGame(*testPresenceFlag), "err", err)
+		}
+		return
+	}
 
 	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 	defer stop()
 
+	var events *eventHub
+	if *eventSocketFlag != "" {
+		hub, err := newEventHub(*eventSocketFlag)
+		if err != nil {
+			fatal("Failed to listen on event socket", "path", *eventSocketFlag, "err", err)
+		}
+		events = hub
+		defer events.close()
+		slog.Info("Emitting events", "socket", *eventSocketFlag)
+	}
+
 	ticker := time.NewTicker(scanInterval)
 	defer ticker.Stop()
+	activeInterval := scanInterval
+
+	wd := newWatchdog()
+	status := newStatusTracker(wd)
+	if *statusAddrFlag != "" {
+		if err := serveStatus(*statusAddrFlag, status); err != nil {
+			fatal("Failed to start status endpoint", "addr", *statusAddrFlag, "err", err)
+		}
+		slog.Info("Serving status", "url", "http://"+*statusAddrFlag+"/status")
+	}
 
-	socketPath, _ := findDiscordSocket()
+	socketPath, _ := locateDiscordSocket()
 	var currentClientID string
-	var ipcConn net.Conn
+	var currentGame string // game the connection is presenting, for logging
+	var ipcConn *IpcConn
+	var gameLostAt time.Time // when the current game was last seen going away
+	var droppedGame string   // game whose connection failed, to report its return as a reconnect
+	var connectFailures int  // consecutive failed connection attempts
+	var retryAt time.Time    // no connection attempts before this, after a failure
+	var saved presenceState  // last state written to paths.State
+	var debounce switchDebouncer
+	var session sessionGate
+	unmatched := unmatchedGames{}
+	var hints presenceHintWatch
+	var sleep sleepDetector
+	var clock sessionClock
+	blacklist := newHandshakeBlacklist()
+	lastEvent := time.Now() // last presence change, for the heartbeat
+
+	slog.Info("Starting process scanner", "interval", scanInterval)
+	var forcedName string // DRB_FORCE_GAME value last seen, to log changes once
+
+	// detection-only mode until the game list loads in the background
+	var gameListReady chan []DetectableApp
+	var unresolvedGame string // game last logged in detection-only mode
+	if gameListErr != nil {
+		slog.Warn("Game list unavailable. Presence is disabled until it loads; detected games are only logged.", "err", gameListErr, "retry_in", gameListRetryInterval)
+		gameListReady = make(chan []DetectableApp, 1)
+		go retryGameList(ctx, currentGameListSource(paths.Cache), gameListReady)
+	}
 
-	log.Printf("Starting process scanner with interval of %v second(s)", scanInterval.Seconds())
 	scan := func() {
-		gameName, pid := scanProcesses()
+		game, forced := forcedGame()
+		if forced != (forcedName != "") || game.Name != forcedName {
+			if forced {
+				slog.Info("Forcing game from environment. Skipping process detection.", "game", loggedGame(game.Name), "env", forceGameEnv)
+			} else {
+				slog.Info("Forced game cleared. Resuming process detection.", "env", forceGameEnv)
+			}
+			forcedName = game.Name
+		}
+		if !forced {
+			game = detectGame()
+		}
+		gameName := game.Name
+		if gameListReady != nil {
+			if gameName != unresolvedGame {
+				if gameName != "" {
+					slog.Info("Detected game. Not presenting until the game list loads.", "game", loggedGame(gameName), "pid", game.Pid, "method", game.Method)
+				} else {
+					slog.Info("Game no longer detected.", "game", loggedGame(unresolvedGame))
+				}
+				unresolvedGame = gameName
+			}
+			return
+		}
+
+		// a game that hasn't run for min_session_seconds yet is treated as no
+		// game. its start timestamp is the process start, so once presented
+		// the elapsed time covers the withheld part too.
+		if sessionLong := session.ready(gameName, time.Now()); gameName != "" && gameName != currentGame && !sessionLong {
+			slog.Debug("Withholding game until its session is long enough", "game", loggedGame(gameName), "running", time.Since(session.since).Round(time.Second), "min_session", minSession)
+			game, gameName = DetectedGame{}, ""
+		}
+
+		// an unmatched game under unmatched_policy skip, or one mapped to an
+		// empty client ID, is treated as no game rather than connected with a
+		// client ID Discord would reject
+		var targetClientID string
+		var match matchKind
+		if gameName != "" {
+			targetClientID, match = resolveGameClientID(game)
+			game.Generic = presentsGeneric(match)
+			game.ClientID = targetClientID
+			switch {
+			case match != matchNone && !presentableClientID(targetClientID):
+				if unmatched.first(gameName) {
+					slog.Warn("Detected game resolved to an unusable client ID. Not presenting it. Fix its manual_mappings entry.", "game", loggedGame(gameName), "client_id", loggedID(targetClientID), "match", match)
+				}
+			case !match.fallback():
+			case !unmatched.first(gameName):
+				slog.Debug("No Discord app matched", "game", loggedGame(gameName), "client_id", loggedID(targetClientID), "policy", unmatchedPolicy)
+			case match == matchNone:
+				slog.Info("Detected game but no Discord app matched. Not presenting it. Add a manual_mappings entry, or set unmatched_policy.", "game", loggedGame(gameName), normalizedAttr(gameName))
+			default:
+				slog.Info("Detected game but no Discord app matched. Presenting it through a shared app; add a manual_mappings entry to use its own app.", "game", loggedGame(gameName), normalizedAttr(gameName), "client_id", loggedID(targetClientID), "policy", unmatchedPolicy)
+			}
+			if !presentableClientID(targetClientID) {
+				game, gameName = DetectedGame{}, ""
+			}
+		}
 
 		if gameName == "" {
 			// no game running, clear status if connected
 			if ipcConn != nil {
-				log.Println("No game found. Closing connection.")
+				// hold presence (and the connection) through quick restarts and
+				// loading-screen process churn
+				if exitGracePeriod > 0 {
+					if gameLostAt.IsZero() {
+						gameLostAt = time.Now()
+						slog.Info("Game no longer detected. Clearing presence unless it returns.", "game", loggedGame(currentGame), "grace_period", exitGracePeriod)
+					}
+					if time.Since(gameLostAt) < exitGracePeriod {
+						return
+					}
+				}
+				slog.Info("No game found. Closing connection.", "game", loggedGame(currentGame))
+				events.publish(Event{Type: "cleared", Game: currentGame})
 				ipcConn.Close()
+				if err := clearState(paths.State); err != nil {
+					slog.Warn("Failed to clear saved presence state", "err", err)
+				}
+				saved = presenceState{}
 				ipcConn = nil
 				currentClientID = ""
+				currentGame = ""
+				lastEvent = time.Now()
+				status.disconnected()
 			}
+			clock.reset()
+			gameLostAt = time.Time{}
+			connectFailures = 0
+			retryAt = time.Time{}
 			return
 		}
-		targetClientID := resolveClientID(gameName)
-
-		// if connected, but ID wrong, disconnect
-		if ipcConn != nil && currentClientID != targetClientID {
-			log.Printf("Switching games (%s -> %s). Reconnecting...", currentClientID, targetClientID)
+		if !gameLostAt.IsZero() {
+			slog.Info("Game detected again within grace period", "game", loggedGame(gameName))
+			gameLostAt = time.Time{}
+		}
+		// if connected, but ID wrong, disconnect once the new game sticks
+		if ipcConn != nil && switchNeedsReconnect(currentClientID, targetClientID, currentGame, gameName) {
+			if !debounce.ready(gameName) {
+				slog.Debug("Holding current game while new one settles", "game", loggedGame(currentGame), "candidate", loggedGame(gameName))
+				return
+			}
+			slog.Info("Switching games. Reconnecting...", "from_game", loggedGame(currentGame), "from_client_id", loggedID(currentClientID), "game", loggedGame(gameName), "client_id", loggedID(targetClientID))
 			ipcConn.Close()
 			ipcConn = nil
+		} else {
+			debounce.reset()
 		}
 
 		// connect if disconnected
+		if ipcConn == nil && time.Now().Before(retryAt) {
+			slog.Debug("Waiting to reconnect", "game", loggedGame(gameName), "retry_in", time.Until(retryAt).Round(time.Second))
+			return
+		}
+		if ipcConn == nil && blacklist.blocked(targetClientID, time.Now()) {
+			slog.Debug("Client ID is blacklisted. Not connecting.", "game", loggedGame(gameName), "client_id", loggedID(targetClientID), "until", blacklist.until[targetClientID])
+			return
+		}
 		if ipcConn == nil {
 			if socketPath == "" {
-				socketPath, _ = findDiscordSocket()
+				socketPath, _ = locateDiscordSocket()
 			}
 			if socketPath != "" {
 				conn, err := connectIPC(socketPath, targetClientID)
+				if err != nil && socketPath == socketPathOverride && socketFallback {
+					if discovered, ferr := findDiscordSocket(); ferr == nil && discovered != socketPath {
+						slog.Warn("Configured socket failed. Falling back to discovery.", "socket", socketPath, "fallback", discovered, "err", err)
+						socketPath = discovered
+						conn, err = connectIPC(socketPath, targetClientID)
+					}
+				}
 				if err == nil {
+					blacklist.accepted(targetClientID)
+					status.blacklisted(blacklist.entries())
 					ipcConn = conn
 					currentClientID = targetClientID
-					log.Printf("Connected to game %s (ID: %s)", gameName, targetClientID)
+					currentGame = gameName
+					lastEvent = time.Now()
+					slog.Info("Connected to game", "game", loggedGame(gameName), "client_id", loggedID(targetClientID), "pid", game.Pid, "appid", loggedID(game.AppID), "method", game.Method, "match", match)
+					status.connected(game, targetClientID, match)
+					eventType := "detected"
+					if gameName == droppedGame {
+						eventType = "reconnected"
+					}
+					droppedGame = ""
+					connectFailures = 0
+					retryAt = time.Time{}
+					events.publish(Event{Type: eventType, Game: gameName, ClientID: targetClientID, Pid: game.Pid})
 				} else {
-					// clear socketPath so next tick re-probes; covers Discord
+					delay := reconnectDelay(connectFailures)
+					connectFailures++
+					retryAt = time.Now().Add(delay)
+					events.publish(Event{Type: "error", Game: gameName, ClientID: targetClientID, Error: err.Error()})
+					droppedGame = gameName
+					if errors.Is(err, ErrHandshakeRejected) {
+						// the socket answered, so keep it; only the client ID is bad
+						if blacklist.rejected(targetClientID, time.Now()) {
+							slog.Warn("Discord keeps rejecting the client ID. Blacklisting it.", "game", loggedGame(gameName), "client_id", loggedID(targetClientID), "failures", blacklist.failures[targetClientID], "until", blacklist.until[targetClientID], "err", err)
+							status.blacklisted(blacklist.entries())
+							retryAt = time.Time{}
+							return
+						}
+						slog.Warn("Discord rejected the client ID. Retrying later.", "client_id", loggedID(targetClientID), "socket", socketPath, "retry_in", delay.Round(time.Second), "attempt", connectFailures, "err", err)
+						return
+					}
+					// clear socketPath so the next attempt re-probes; covers Discord
 					// being closed/relaunched in a different flavor
 					// (native ↔ Flatpak ↔ Snap) at a new socket path.
-					log.Printf("Connection failed: %v. Re-probing socket next tick.", err)
+					slog.Warn("Connection failed. Re-probing socket before retrying.", "socket", socketPath, "retry_in", delay.Round(time.Second), "attempt", connectFailures, "err", err)
 					socketPath = ""
 					return
 				}
@@ -631,31 +3920,225 @@ func main() {
 
 		// set activity if connected
 		if ipcConn != nil {
-			if err := setActivity(ipcConn, gameName, pid, osRelease); err != nil {
-				log.Printf("Failed to set activity: %v. Reconnecting...", err)
+			game.SessionStart = clock.startFor(game)
+			if err := setActivity(ipcConn, game, osRelease); err != nil {
+				slog.Warn("Failed to set activity. Reconnecting...", "game", loggedGame(gameName), "err", err)
+				events.publish(Event{Type: "error", Game: gameName, ClientID: currentClientID, Error: err.Error()})
+				droppedGame = gameName
 				ipcConn.Close()
 				ipcConn = nil
 				currentClientID = ""
+				currentGame = ""
 				socketPath = ""
+				lastEvent = time.Now()
+				status.disconnected()
+			} else if saved.Game != gameName || saved.Pid != game.Pid {
+				if currentGame != gameName {
+					// a different game sharing the connection's client ID
+					// (ex: two unmatched games on default_client_id). the
+					// activity above already replaced the old game's
+					slog.Info("Presenting game", "game", loggedGame(gameName), "client_id", loggedID(currentClientID), "pid", game.Pid, "appid", loggedID(game.AppID), "method", game.Method, "match", match)
+					currentGame = gameName
+					lastEvent = time.Now()
+					status.connected(game, currentClientID, match)
+					events.publish(Event{Type: "detected", Game: gameName, ClientID: currentClientID, Pid: game.Pid})
+				}
+				// remember what we're presenting so a restart can pick it back up
+				if state, err := newPresenceState(game); err == nil {
+					if err := saveState(paths.State, state); err != nil {
+						slog.Warn("Failed to save presence state", "err", err)
+					}
+					saved = state
+				}
 			}
 		}
 	}
 
-	scan()
+	// re-present the game from before a restart if its process is still
+	// running, instead of waiting on a full scan
+	restore := func() bool {
+		state, err := loadState(paths.State)
+		if err != nil || !state.alive() {
+			return false
+		}
+		if !state.allowed() {
+			slog.Info("Not restoring a game that's now ignored", "game", loggedGame(state.Game))
+			return false
+		}
+		if socketPath == "" {
+			return false
+		}
+		game := state.detectedGame()
+		clientID, match := resolveGameClientID(game)
+		if !presentableClientID(clientID) {
+			return false
+		}
+		game.Generic = presentsGeneric(match)
+		game.ClientID = clientID
+		conn, err := connectIPC(socketPath, clientID)
+		if err != nil {
+			return false
+		}
+		if err := setActivity(conn, game, osRelease); err != nil {
+			conn.Close()
+			return false
+		}
+		ipcConn = conn
+		currentClientID = clientID
+		currentGame = game.Name
+		saved = state
+		slog.Info("Restored presence from before restart", "game", loggedGame(game.Name), "client_id", loggedID(clientID), "pid", game.Pid, "appid", loggedID(game.AppID), "method", game.Method, "match", match)
+		status.connected(game, clientID, match)
+		events.publish(Event{Type: "detected", Game: game.Name, ClientID: clientID, Pid: game.Pid})
+		return true
+	}
+
+	// after a suspend the Discord socket is usually dead (Discord may even
+	// come back at a new path), so drop the connection, re-probe, and present
+	// again now instead of on the first failed write
+	resume := func(slept time.Duration) {
+		slog.Info("Resumed from suspend. Reconnecting to Discord...", "slept", slept.Round(time.Second), "game", loggedGame(currentGame))
+		if ipcConn != nil {
+			droppedGame = currentGame
+			ipcConn.Close()
+			ipcConn = nil
+			currentClientID = ""
+			currentGame = ""
+			status.disconnected()
+		}
+		socketPath = ""
+		connectFailures = 0
+		retryAt = time.Time{}
+		scan()
+		switch {
+		case ipcConn != nil:
+			slog.Info("Reconnected after resume", "game", loggedGame(currentGame), "client_id", loggedID(currentClientID), "socket", socketPath)
+		case !retryAt.IsZero():
+			slog.Warn("Couldn't reconnect after resume. Retrying later.", "retry_in", time.Until(retryAt).Round(time.Second))
+		}
+	}
+
+	// recover if the scan loop blocks despite IPC deadlines. the grace window
+	// leaves room for a slow scan plus handshake/HTTP timeouts.
+	go wd.run(ctx, func() time.Duration { return 3*longestScanInterval() + 30*time.Second })
+
+	// follow per-game interval overrides, returning to the default once
+	// the game exits
+	retick := func() {
+		if interval := scanIntervalFor(currentGame); interval != activeInterval {
+			slog.Info("Scan interval changed", "game", loggedGame(currentGame), "interval", interval, "saving_power", savingPower())
+			ticker.Reset(interval)
+			activeInterval = interval
+		}
+	}
+
+	// present right away rather than after the first tick, and pick the
+	// interval for whatever game that found
+	if gameListReady != nil || !restore() {
+		scan()
+	}
+	wd.beat(ipcConn)
+	retick()
+
+	// between scans, watch the presented process so a crash or quit clears
+	// presence right away instead of at the next tick
+	pidCheck := time.NewTicker(pidCheckInterval)
+	defer pidCheck.Stop()
+
+	// SIGHUP reloads the config, then the game list in the background. the
+	// new list is swapped in here, between scans, so a tick never sees a
+	// half-built map.
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+	gameListReloaded := make(chan []DetectableApp, 1)
+	reloading := false
 	for {
 		select {
 		case <-ctx.Done():
-			log.Println("Shutting down. Clearing Discord activity...")
+			slog.Info("Shutting down. Clearing Discord activity...")
 			if ipcConn != nil {
 				// best-effort: ask Discord to drop our activity, then close.
 				// without this, Discord shows the stale "Playing X" until it
 				// notices the broken pipe (can take a while).
-				_ = setActivity(ipcConn, "", 0, osRelease)
+				_ = setActivity(ipcConn, DetectedGame{}, osRelease)
 				ipcConn.Close()
 			}
+			if err := clearState(paths.State); err != nil {
+				slog.Warn("Failed to clear saved presence state", "err", err)
+			}
 			return
+		case apps := <-gameListReady:
+			populateMap(apps)
+			gameListReady = nil
+			slog.Info("Game list loaded. Presence enabled.")
+			scan()
+			wd.beat(ipcConn)
+			retick()
+		case <-hup:
+			slog.Info("Received SIGHUP. Reloading config and game list...")
+			loadSettings()
+			// pick up a changed scan or heartbeat interval now, even if the
+			// game list reload fails or is already running
+			retick()
+			if reloading {
+				slog.Info("Game list reload already in progress.")
+				continue
+			}
+			reloading = true
+			src := currentGameListSource(paths.Cache)
+			go func() { gameListReloaded <- reloadGameList(src) }()
+		case apps := <-gameListReloaded:
+			reloading = false
+			if apps == nil {
+				continue
+			}
+			populateMap(apps)
+			if gameListReady != nil {
+				gameListReady = nil
+				slog.Info("Game list loaded. Presence enabled.")
+			}
+			scan()
+			wd.beat(ipcConn)
+			retick()
+		case <-pidCheck.C:
+			if slept, ok := sleep.slept(time.Now()); ok {
+				resume(slept)
+				wd.beat(ipcConn)
+				retick()
+				continue
+			}
+			// a sidecar presence file rewritten while its game runs shows up
+			// now rather than at the next tick
+			if ipcConn != nil && hints.changed(currentGame) {
+				slog.Info("Presence file changed. Updating activity.", "game", loggedGame(currentGame))
+				scan()
+				wd.beat(ipcConn)
+				retick()
+				continue
+			}
+			if ipcConn == nil || saved.Game == "" || !gameLostAt.IsZero() || saved.alive() {
+				continue
+			}
+			slog.Info("Game process exited. Rescanning.", "game", loggedGame(saved.Game), "pid", saved.Pid)
+			scan()
+			wd.beat(ipcConn)
+			retick()
 		case <-ticker.C:
 			scan()
+			wd.beat(ipcConn)
+			retick()
+
+			// let people watching journalctl know the bridge is still alive
+			// after a long quiet stretch
+			if heartbeatInterval > 0 && time.Since(lastEvent) >= heartbeatInterval {
+				if currentGame == "" {
+					slog.Info("Scanner alive, no game detected.")
+				} else {
+					slog.Info("Scanner alive", "game", loggedGame(currentGame))
+				}
+				lastEvent = time.Now()
+			}
 		}
 	}
 }
@@ -1,6 +1,33 @@
 package main
 
-import "testing"
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
 
 func TestNormalizeGameName(t *testing.T) {
 	tests := []struct {
@@ -45,6 +72,16 @@ func TestExtractSteamGameName(t *testing.T) {
 			"C:\\steamapps\\common\\Celeste\\Celeste.exe",
 			"Celeste",
 		},
+		{
+			"proton drive letter",
+			"Z:\\home\\user\\.local\\share\\Steam\\steamapps\\common\\Hollow Knight\\hollow_knight.exe",
+			"Hollow Knight",
+		},
+		{
+			"mixed separators",
+			"Z:\\home\\user/.steam/steam\\steamapps\\common/Celeste\\Celeste.exe",
+			"Celeste",
+		},
 		{
 			"no steamapps",
 			"/usr/bin/firefox",
@@ -55,6 +92,66 @@ func TestExtractSteamGameName(t *testing.T) {
 			"/steamapps/common/Factorio",
 			"Factorio",
 		},
+		{
+			"embedded mid-token",
+			"--exe=/home/user/.steam/steam/steamapps/common/Hades/Hades.exe",
+			"Hades",
+		},
+		{
+			"escaped wine separators",
+			"Z:\\\\home\\\\user\\\\.steam\\\\steam\\\\steamapps\\\\common\\\\Hades\\\\Hades.exe",
+			"Hades",
+		},
+		{
+			"quoted token",
+			"\"/home/user/.steam/steam/steamapps/common/Hades\"",
+			"Hades",
+		},
+		{
+			"legacy SteamApps casing",
+			"/mnt/games/SteamApps/common/Portal 2/portal2_linux",
+			"Portal 2",
+		},
+		{
+			"ends at common",
+			"/home/user/.steam/steam/steamapps/common",
+			"",
+		},
+		{
+			"ends at common with trailing slash",
+			"/home/user/.steam/steam/steamapps/common/",
+			"",
+		},
+		{
+			"ends at common with trailing backslash",
+			"Z:\\home\\user\\.steam\\steam\\steamapps\\common\\",
+			"",
+		},
+		{
+			"game folder with trailing slash",
+			"/steamapps/common/Factorio/",
+			"Factorio",
+		},
+		{
+			"key appears twice",
+			"/mnt/games/steamapps/common/Tools/steamapps/common/Other/run.sh",
+			"Tools",
+		},
+		{
+			"key as folder name prefix",
+			"/mnt/steamapps/commonfoo/steamapps/common/Celeste/Celeste",
+			"Celeste",
+		},
+		{
+			"key as folder name prefix only",
+			"/mnt/steamapps/commonfoo/Celeste",
+			"",
+		},
+		{
+			"backslash path without drive",
+			"\\steamapps\\common\\Celeste\\Celeste.exe",
+			"Celeste",
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -66,32 +163,116 @@ func TestExtractSteamGameName(t *testing.T) {
 	}
 }
 
+func TestGameFromCmdline(t *testing.T) {
+	game := "/home/user/.local/share/Steam/steamapps/common/Celeste/Celeste.exe"
+	junk := strings.Repeat(strings.Repeat("x", 1000)+"\x00", 1000) // ~1MB of args
+
+	// found early: stop reading instead of taking in the whole cmdline
+	r := &countingReader{r: strings.NewReader("wine\x00" + game + "\x00" + junk)}
+	if name, _, path := gameFromCmdline(r); name != "Celeste" || path != game {
+		t.Errorf("gameFromCmdline = %q from %q, want Celeste", name, path)
+	}
+	if r.n >= maxCmdlineBytes {
+		t.Errorf("read %d bytes to find a game in the first args, want an early exit", r.n)
+	}
+
+	// past the cap: never read, never matched
+	r = &countingReader{r: strings.NewReader("launcher\x00" + junk + game + "\x00")}
+	if name, _, _ := gameFromCmdline(r); name != "" {
+		t.Errorf("gameFromCmdline matched %q past the %d byte cap", name, maxCmdlineBytes)
+	}
+	if r.n > maxCmdlineBytes {
+		t.Errorf("read %d bytes, want at most %d", r.n, maxCmdlineBytes)
+	}
+
+	// an arg cut off by the cap is dropped rather than matched partially
+	padding := strings.Repeat("x", maxCmdlineBytes-len("launcher\x00")-len(game)+10)
+	if name, _, _ := gameFromCmdline(strings.NewReader("launcher\x00" + padding + game + "\x00")); name != "" {
+		t.Errorf("gameFromCmdline matched %q in a truncated arg", name)
+	}
+
+	// the last arg doesn't need a trailing null, and wrappers are skipped
+	if name, _, _ := gameFromCmdline(strings.NewReader("wine\x00" + game)); name != "Celeste" {
+		t.Errorf("gameFromCmdline without a trailing null = %q", name)
+	}
+	if name, _, _ := gameFromCmdline(strings.NewReader("/home/user/.local/share/Steam/ubuntu12_32/reaper\x00" + game + "\x00")); name != "" {
+		t.Errorf("gameFromCmdline matched %q under an ignored wrapper", name)
+	}
+}
+
 func TestResolveClientID(t *testing.T) {
 	// seed lookup map
 	nameToID["balatro"] = "1209665818464358430"
 	nameToID["yakuzakiwami3darkties"] = "1464821189921996860"
 	manualMappings["YakuzaKiwami3"] = "1464821189921996860"
+	defer func() {
+		delete(nameToID, "balatro")
+		delete(nameToID, "yakuzakiwami3darkties")
+		delete(manualMappings, "YakuzaKiwami3")
+	}()
 
-	got := resolveClientID("Balatro")
-	if got != "1209665818464358430" {
-		t.Errorf("resolveClientID(Balatro) = %q, want 1209665818464358430", got)
+	got, match := resolveClientID("Balatro")
+	if got != "1209665818464358430" || match != matchExact {
+		t.Errorf("resolveClientID(Balatro) = %q, %v, want 1209665818464358430, exact", got, match)
 	}
 
 	// manual mapping takes precedence and resolves a folder name that wouldn't normalize-match
-	got = resolveClientID("YakuzaKiwami3")
-	if got != "1464821189921996860" {
-		t.Errorf("resolveClientID(YakuzaKiwami3) = %q, want 1464821189921996860", got)
+	got, match = resolveClientID("YakuzaKiwami3")
+	if got != "1464821189921996860" || match != matchManual {
+		t.Errorf("resolveClientID(YakuzaKiwami3) = %q, %v, want 1464821189921996860, manual", got, match)
+	}
+
+	got, match = resolveClientID("NonExistentGame")
+	if got != unknownClientID || match != matchNone {
+		t.Errorf("resolveClientID(NonExistentGame) = %q, %v, want %s, none", got, match, unknownClientID)
+	}
+
+	// unmatched games use the configured default app, unless skipped
+	defaultClientID = "1111111111111111111"
+	defer func() { defaultClientID = "" }()
+	if got, match = resolveClientID("NonExistentGame"); match != matchNone {
+		t.Errorf("resolveClientID(NonExistentGame) with unmatched_policy skip = %q, %v, want none", got, match)
+	}
+	unmatchedPolicy = unmatchedDefault
+	defer func() { unmatchedPolicy = unmatchedSkip }()
+	got, match = resolveClientID("NonExistentGame")
+	if got != "1111111111111111111" || match != matchDefault {
+		t.Errorf("resolveClientID(NonExistentGame) with default = %q, %v, want 1111111111111111111, default", got, match)
 	}
+	got, match = resolveClientID("Balatro")
+	if got != "1209665818464358430" || match != matchExact {
+		t.Errorf("resolveClientID(Balatro) with default = %q, %v, want 1209665818464358430, exact", got, match)
+	}
+}
 
-	got = resolveClientID("NonExistentGame")
-	if got != "000000000000000000" {
-		t.Errorf("resolveClientID(NonExistentGame) = %q, want 000000000000000000", got)
+func TestIsIgnoredGameAllowlist(t *testing.T) {
+	allowedGames = map[string]bool{normalizeGameName("Balatro"): true, normalizeGameName("SomeExactName"): true}
+	ignoredGames[normalizeGameName("SomeExactName")] = true
+	defer func() {
+		allowedGames = map[string]bool{}
+		delete(ignoredGames, normalizeGameName("SomeExactName"))
+	}()
+
+	tests := []struct {
+		name string
+		want bool
+	}{
+		{"Balatro", false},
+		{"balatro", false},
+		{"SomeExactName", false}, // allow wins over ignore
+		{"YakuzaKiwami3", true},
+		{"Proton 9.0", true},
+	}
+	for _, tt := range tests {
+		if got := isIgnoredGame(tt.name); got != tt.want {
+			t.Errorf("isIgnoredGame(%q) with allowlist = %v, want %v", tt.name, got, tt.want)
+		}
 	}
 }
 
 func TestIsIgnoredGame(t *testing.T) {
-	ignoredGames["SomeExactName"] = true
-	defer delete(ignoredGames, "SomeExactName")
+	ignoredGames[normalizeGameName("SomeExactName")] = true
+	defer delete(ignoredGames, normalizeGameName("SomeExactName"))
 
 	tests := []struct {
 		name string
@@ -106,6 +287,10 @@ func TestIsIgnoredGame(t *testing.T) {
 		{"Proton 9.0", true},
 		{"Proton Hotfix", true},
 		{"SomeExactName", true},
+		{"someexactname", true},
+		{"Some Exact-Name", true},
+		{"steamlinuxruntime_soldier", true},
+		{"proton experimental", true},
 		{"YakuzaKiwami3", false},
 		{"Balatro", false},
 	}
@@ -123,3 +308,2052 @@ func TestVersionIsSet(t *testing.T) {
 		t.Error("version should not be empty")
 	}
 }
+
+func TestRenderTemplate(t *testing.T) {
+	game := DetectedGame{Name: "Balatro", Platform: "Steam"}
+	got := renderTemplate("{game} on {os}", game, "Arch Linux")
+	if got != "Balatro on Arch Linux" {
+		t.Errorf("renderTemplate = %q, want %q", got, "Balatro on Arch Linux")
+	}
+	got = renderTemplate("Playing {game} via {platform}", game, "Arch Linux")
+	if got != "Playing Balatro via Steam" {
+		t.Errorf("renderTemplate = %q, want %q", got, "Playing Balatro via Steam")
+	}
+	got = renderTemplate("appid {appid}", DetectedGame{Name: "Cyberpunk 2077", AppID: "1091500"}, "")
+	if got != "appid 1091500" {
+		t.Errorf("renderTemplate = %q, want %q", got, "appid 1091500")
+	}
+	got = renderTemplate("appid {appid}", game, "")
+	if got != "appid " {
+		t.Errorf("renderTemplate without an appid = %q, want the token empty", got)
+	}
+	got = renderTemplate("Playing on Steam Deck", game, "SteamOS")
+	if got != "Playing on Steam Deck" {
+		t.Errorf("renderTemplate without tokens = %q, want it unchanged", got)
+	}
+}
+
+func TestRenderTemplateElapsed(t *testing.T) {
+	game := DetectedGame{Name: "Balatro", SessionStart: time.Now().Add(-(2*time.Hour + 5*time.Minute + 30*time.Second))}
+	if got := renderTemplate("{elapsed} in", game, "Linux"); got != "2:05 in" {
+		t.Errorf("renderTemplate({elapsed}) = %q, want 2:05 in", got)
+	}
+	// no session start and no process to take it from
+	if got := renderTemplate("{elapsed}", DetectedGame{Name: "Balatro"}, "Linux"); got != "" {
+		t.Errorf("renderTemplate({elapsed}) without a start = %q", got)
+	}
+	if got := renderTemplate("{elapsed}", DetectedGame{Name: "Balatro", Pid: os.Getpid()}, "Linux"); !strings.HasPrefix(got, "0:") {
+		t.Errorf("renderTemplate({elapsed}) from this process's start = %q", got)
+	}
+
+	for d, want := range map[time.Duration]string{
+		0:                             "0:00",
+		59 * time.Second:              "0:00",
+		9 * time.Minute:               "0:09",
+		time.Hour:                     "1:00",
+		26*time.Hour + 40*time.Minute: "26:40",
+		-time.Minute:                  "0:00",
+	} {
+		if got := formatElapsed(d); got != want {
+			t.Errorf("formatElapsed(%v) = %q, want %q", d, got, want)
+		}
+	}
+}
+
+func TestSessionClock(t *testing.T) {
+	var c sessionClock
+	start := time.Now().Add(-time.Hour)
+	first := c.startFor(DetectedGame{Name: "Balatro", SessionStart: start})
+	if !first.Equal(start) {
+		t.Fatalf("startFor = %v, want the game's start", first)
+	}
+	// restarted within the grace period: a new process, the same session
+	if got := c.startFor(DetectedGame{Name: "Balatro", Pid: os.Getpid()}); !got.Equal(start) {
+		t.Errorf("startFor after a restart = %v, want the session kept from %v", got, start)
+	}
+	if got := c.startFor(DetectedGame{Name: "Hades", SessionStart: start.Add(time.Minute)}); !got.Equal(start.Add(time.Minute)) {
+		t.Errorf("startFor a different game = %v, want a new session", got)
+	}
+	c.reset()
+	if got := c.startFor(DetectedGame{Name: "Hades", SessionStart: start.Add(2 * time.Minute)}); !got.Equal(start.Add(2 * time.Minute)) {
+		t.Errorf("startFor after reset = %v, want a new session", got)
+	}
+}
+
+func TestRenderTemplateManifestTokens(t *testing.T) {
+	game := DetectedGame{Name: "Balatro", LastPlayed: time.Date(2024, 6, 10, 12, 0, 0, 0, time.Local), InstallSize: 420 << 30}
+	if got := renderTemplate("{install_size} installed, last played {last_played}", game, ""); got != "420 GB installed, last played Jun 10, 2024" {
+		t.Errorf("renderTemplate = %q", got)
+	}
+	if got := renderTemplate("[{install_size}|{last_played}]", DetectedGame{Name: "Hades"}, ""); got != "[|]" {
+		t.Errorf("renderTemplate for a non-Steam game = %q, want the tokens empty", got)
+	}
+	sizes := map[int64]string{0: "", 512: "512 B", 3584 << 20: "3.5 GB", 15 << 20: "15 MB", 2 << 40: "2.0 TB"}
+	for bytes, want := range sizes {
+		if got := formatSize(bytes); got != want {
+			t.Errorf("formatSize(%d) = %q, want %q", bytes, got, want)
+		}
+	}
+	if !usesManifestTokens(TemplateConfig{State: "{install_size} on disk"}) || usesManifestTokens(TemplateConfig{State: "{game}"}) {
+		t.Error("usesManifestTokens didn't spot {install_size} in the state")
+	}
+}
+
+func TestParseStartTicks(t *testing.T) {
+	// comm containing spaces and parens must not shift the field count
+	stat := "4242 (Game (x64) Main) S 1 4242 4242 0 -1 4194560 1000 0 0 0 50 10 0 0 20 0 12 0 987654 1234567 890 18446744073709551615 1 1 0 0 0 0 0 4096 0 0 0 17 3 0 0 0 0 0"
+	got, err := parseStartTicks([]byte(stat))
+	if err != nil {
+		t.Fatalf("parseStartTicks: %v", err)
+	}
+	if got != 987654 {
+		t.Errorf("parseStartTicks = %d, want 987654", got)
+	}
+
+	if _, err := parseStartTicks([]byte("4242 (truncated) S 1 2")); err == nil {
+		t.Error("parseStartTicks on truncated stat should fail")
+	}
+}
+
+func TestPlatformFromPath(t *testing.T) {
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"/home/user/.steam/steam/steamapps/common/Balatro/balatro", "Steam"},
+		{"Z:\\home\\user\\.steam\\steam\\steamapps\\common\\Celeste\\Celeste.exe", "Steam"},
+		{"/home/user/Games/Heroic/Hades/Hades.exe", "Heroic"},
+		{"/home/user/.local/share/lutris/runners/wine/bin/wine", "Lutris"},
+		{"/usr/bin/firefox", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			if got := platformFromPath(tt.path); got != tt.want {
+				t.Errorf("platformFromPath(%q) = %q, want %q", tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadIpcResponse(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+
+	go func() {
+		frame := make([]byte, 8)
+		payload := []byte(`{"cmd":"DISPATCH","evt":"READY"}`)
+		binary.LittleEndian.PutUint32(frame[0:4], opFrame)
+		binary.LittleEndian.PutUint32(frame[4:8], uint32(len(payload)))
+		server.Write(append(frame, payload...))
+
+		// oversized length header
+		binary.LittleEndian.PutUint32(frame[4:8], 1<<21)
+		server.Write(frame)
+	}()
+
+	opcode, payload, err := readIpcResponse(client)
+	if err != nil {
+		t.Fatalf("readIpcResponse: %v", err)
+	}
+	if opcode != opFrame || string(payload) != `{"cmd":"DISPATCH","evt":"READY"}` {
+		t.Errorf("readIpcResponse = (%d, %q), want (%d, READY payload)", opcode, payload, opFrame)
+	}
+
+	if _, _, err := readIpcResponse(client); err == nil {
+		t.Error("readIpcResponse should reject payloads over the size cap")
+	}
+}
+
+func TestPopulateMapCollisions(t *testing.T) {
+	apps := []DetectableApp{
+		{ID: "300", Name: "Collider"},
+		{ID: "200", Name: "Collider™"},
+		{ID: "100", Name: "Collider!"},
+	}
+	populateMap(apps)
+
+	// longer original name wins ("™" is 3 bytes, so "Collider™" beats "Collider!")
+	if got := nameToID["collider"]; got != "200" {
+		t.Errorf("nameToID[collider] = %q, want 200", got)
+	}
+	if got := len(nameCollisions["collider"]); got != 3 {
+		t.Errorf("len(nameCollisions[collider]) = %d, want 3", got)
+	}
+
+	// order of the input must not change the winner
+	delete(nameToID, "collider")
+	delete(nameCollisions, "collider")
+	populateMap([]DetectableApp{apps[2], apps[1], apps[0]})
+	if got := nameToID["collider"]; got != "200" {
+		t.Errorf("nameToID[collider] after reorder = %q, want 200", got)
+	}
+	delete(nameToID, "collider")
+	delete(nameCollisions, "collider")
+}
+
+func TestTokenSetKey(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"Half-Life 2", "2 half life"},
+		{"HalfLife2", "2 half life"},
+		{"The Witcher 3: Wild Hunt - Game of the Year Edition", "3 hunt wild witcher"},
+		{"Game of Thrones", "game thrones"},
+		{"Year of the Game", "game year"},
+		{"Witcher 3 Wild Hunt GOTY", "3 hunt wild witcher"},
+		{"Portal: Reloaded", "portal reloaded"},
+		{"PortalReloaded", "portal reloaded"},
+		{"Ragnarök", "ragnarok"},
+		{"The", ""},
+	}
+	for _, tt := range tests {
+		if got := tokenSetKey(tt.name); got != tt.want {
+			t.Errorf("tokenSetKey(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestResolveClientIDTokenSet(t *testing.T) {
+	populateMap([]DetectableApp{{ID: "500", Name: "Hunt: Wild Witcher"}, {ID: "600", Name: "Legend of Heroes"}})
+	defer populateMap(nil)
+
+	if _, match := resolveClientID("WildWitcherHunt"); match != matchNone {
+		t.Errorf("match with the exact strategy = %v, want none", match)
+	}
+	matchStrategy = "token_set"
+	defer func() { matchStrategy = "exact" }()
+	if id, match := resolveClientID("WildWitcherHunt"); id != "500" || match != matchTokenSet {
+		t.Errorf("resolveClientID(WildWitcherHunt) = %s, %v, want 500, token_set", id, match)
+	}
+	if id, match := resolveClientID("The Legend of Heroes"); id != "600" || match != matchTokenSet {
+		t.Errorf("resolveClientID(The Legend of Heroes) = %s, %v, want 600, token_set", id, match)
+	}
+	if _, match := resolveClientID("The"); match != matchNone {
+		t.Errorf("a name of only minor words matched: %v", match)
+	}
+}
+
+func TestAppForExecutable(t *testing.T) {
+	populateMap([]DetectableApp{
+		{ID: "1", Name: "Hades", Executables: []Executable{{Name: "hades/Hades.x86_64", OS: "linux"}, {Name: "hades.exe", OS: "win32"}}},
+		{ID: "2", Name: "Shared A", Executables: []Executable{{Name: "a/game.x86_64", OS: "linux"}}},
+		{ID: "3", Name: "Shared B", Executables: []Executable{{Name: "b/game.x86_64", OS: "linux"}}},
+		{ID: "4", Name: "Launched", Executables: []Executable{{Name: ">launched", OS: "linux"}, {Name: "bin/launched", OS: "linux"}}},
+		{ID: "5", Name: "Bare A", Executables: []Executable{{Name: "run.sh", OS: "linux"}}},
+		{ID: "6", Name: "Bare B", Executables: []Executable{{Name: "run.sh", OS: "linux"}, {Name: "tool/run.sh", OS: "linux"}}},
+	})
+	defer populateMap(nil)
+
+	tests := []struct {
+		exe  string
+		want string // app ID, empty for no match
+	}{
+		{"/games/Hades/Hades.x86_64", "1"},
+		{"/usr/bin/Hades.x86_64", ""}, // listed directory missing
+		{"/games/hades.exe", ""},      // windows executable
+		{"/games/a/game.x86_64", "2"},
+		{"/games/b/game.x86_64", "3"},
+		{"/games/c/game.x86_64", ""},
+		{"/opt/launched", "4"},
+		{"/opt/run.sh", ""},        // listed bare by two apps
+		{"/opt/tool/run.sh", "6"},  // the longer listed path wins
+		{"/opt/mytool/run.sh", ""}, // a suffix of a directory name isn't the directory
+	}
+	for _, tt := range tests {
+		app, ok := appForExecutable(tt.exe)
+		if app.ID != tt.want || ok != (tt.want != "") {
+			t.Errorf("appForExecutable(%q) = %q, %v, want %q", tt.exe, app.ID, ok, tt.want)
+		}
+	}
+}
+
+func TestDetectPidExecutable(t *testing.T) {
+	defer func(age time.Duration) { minProcessAge = age }(minProcessAge)
+	minProcessAge = 0
+	exe, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	listed := filepath.Base(filepath.Dir(exe)) + "/" + filepath.Base(exe)
+	// another app by the same name wins the name lookup
+	populateMap([]DetectableApp{
+		{ID: "77", Name: "Test Runner Game", Executables: []Executable{{Name: listed, OS: "linux"}}},
+		{ID: "7", Name: "Test Runner Game"},
+	})
+	defer populateMap(nil)
+
+	game, ok := detectPid(strconv.Itoa(os.Getpid()))
+	if !ok || game.Name != "Test Runner Game" || game.Method != "executable" || game.Pid != os.Getpid() || game.ListedID != "77" {
+		t.Errorf("detectPid(self) = %+v, %v, want the indexed game by executable", game, ok)
+	}
+	if id, match := resolveGameClientID(game); id != "77" || match != matchListed {
+		t.Errorf("resolveGameClientID(%q) = %s, %v, want the listed app 77", game.Name, id, match)
+	}
+	manualMappings[game.Name] = "99"
+	defer delete(manualMappings, game.Name)
+	if id, match := resolveGameClientID(game); id != "99" || match != matchManual {
+		t.Errorf("resolveGameClientID with a manual mapping = %s, %v, want 99", id, match)
+	}
+}
+
+func TestPopulateMapReplaces(t *testing.T) {
+	populateMap([]DetectableApp{{ID: "1", Name: "Old Game"}, {ID: "2", Name: "Kept Game"}})
+	populateMap([]DetectableApp{{ID: "2", Name: "Kept Game"}, {ID: "3", Name: "New Game"}})
+	defer populateMap(nil)
+
+	if _, ok := nameToID["oldgame"]; ok {
+		t.Error("a game dropped from the list still resolves")
+	}
+	if nameToID["keptgame"] != "2" || nameToID["newgame"] != "3" {
+		t.Errorf("nameToID = %v, want keptgame and newgame", nameToID)
+	}
+	if _, ok := appByID("1"); ok {
+		t.Error("appByID still finds a dropped app")
+	}
+}
+
+func TestReloadGameList(t *testing.T) {
+	up := true
+	serveGameList(t, func(w http.ResponseWriter, r *http.Request) {
+		if !up {
+			http.Error(w, "down", http.StatusServiceUnavailable)
+			return
+		}
+		w.Write(testGameList(minDetectableApps))
+	})
+	cacheFile := filepath.Join(t.TempDir(), "games.json")
+
+	if apps := reloadGameList(currentGameListSource(cacheFile)); len(apps) != minDetectableApps {
+		t.Fatalf("reloadGameList fetched %d apps, want %d", len(apps), minDetectableApps)
+	}
+	up = false
+	if apps := reloadGameList(currentGameListSource(cacheFile)); len(apps) != minDetectableApps {
+		t.Errorf("reloadGameList with the API down got %d apps, want the cached %d", len(apps), minDetectableApps)
+	}
+	if apps := reloadGameList(currentGameListSource(filepath.Join(t.TempDir(), "missing.json"))); apps != nil {
+		t.Errorf("reloadGameList with no API or cache got %d apps, want nil", len(apps))
+	}
+}
+
+func TestAppLookups(t *testing.T) {
+	populateMap([]DetectableApp{
+		{ID: "1001", Name: "Lookup Game", Icon: "abc123"},
+		{ID: "1002", Name: "Lookup Tool"},
+	})
+	defer func() {
+		delete(nameToID, "lookupgame")
+		delete(nameToID, "lookuptool")
+		populateMap(nil)
+	}()
+
+	if got := appCount(); got != 2 {
+		t.Errorf("appCount = %d, want 2", got)
+	}
+	if got := appsWithAssets(); got != 1 {
+		t.Errorf("appsWithAssets = %d, want 1", got)
+	}
+	if app, ok := appByID("1002"); !ok || app.Name != "Lookup Tool" {
+		t.Errorf("appByID(1002) = %+v, %v, want Lookup Tool", app, ok)
+	}
+	if _, ok := appByID("9999"); ok {
+		t.Error("appByID(9999) found an app that was never loaded")
+	}
+	if app, ok := appByName("lookup game™"); !ok || app.ID != "1001" {
+		t.Errorf("appByName(lookup game™) = %+v, %v, want 1001", app, ok)
+	}
+}
+
+func TestPreferAppTieBreak(t *testing.T) {
+	a := DetectableApp{ID: "1209665818464358430", Name: "Game!"}
+	b := DetectableApp{ID: "1464821189921996860", Name: "Game?"}
+	if !preferApp(a, b) || preferApp(b, a) {
+		t.Error("preferApp should pick the smaller ID when names are the same length")
+	}
+}
+
+func TestMergeAssets(t *testing.T) {
+	base := ActivityAssets{LargeImage: "default", LargeText: "Balatro"}
+	got := mergeAssets(base, ActivityAssets{LargeImage: "balatro_logo", SmallImage: "joker"})
+	want := ActivityAssets{LargeImage: "balatro_logo", LargeText: "Balatro", SmallImage: "joker"}
+	if got != want {
+		t.Errorf("mergeAssets = %+v, want %+v", got, want)
+	}
+}
+
+func TestValidatePartySize(t *testing.T) {
+	tests := []struct {
+		size  []int
+		valid bool
+	}{
+		{[]int{1, 4}, true},
+		{[]int{4, 4}, true},
+		{[]int{5, 4}, false},
+		{[]int{0, 4}, false},
+		{[]int{4}, false},
+		{[]int{1, 2, 3}, false},
+	}
+	for _, tt := range tests {
+		if err := validatePartySize(tt.size); (err == nil) != tt.valid {
+			t.Errorf("validatePartySize(%v) err = %v, want valid=%v", tt.size, err, tt.valid)
+		}
+	}
+}
+
+func TestSocketExistsAbstract(t *testing.T) {
+	name := fmt.Sprintf("@discord-rpc-bridge-test-%d", os.Getpid())
+	if socketExists(name) {
+		t.Fatalf("socketExists(%q) = true before listening", name)
+	}
+	ln, err := net.Listen("unix", name)
+	if err != nil {
+		t.Skipf("abstract sockets unavailable: %v", err)
+	}
+	defer ln.Close()
+	go func() {
+		if conn, err := ln.Accept(); err == nil {
+			conn.Close()
+		}
+	}()
+	if !socketExists(name) {
+		t.Errorf("socketExists(%q) = false while listening", name)
+	}
+}
+
+func TestParseSocketAddress(t *testing.T) {
+	tests := []struct {
+		addr, network, address string
+		wantErr                bool
+	}{
+		{"/run/user/1000/discord-ipc-0", "unix", "/run/user/1000/discord-ipc-0", false},
+		{"@discord-ipc-0", "unix", "@discord-ipc-0", false},
+		{"unix:///tmp/discord-ipc-0", "unix", "/tmp/discord-ipc-0", false},
+		{"tcp://127.0.0.1:6463", "tcp", "127.0.0.1:6463", false},
+		{"tcp://[::1]:6463", "tcp", "[::1]:6463", false},
+		{"tcp://127.0.0.1", "", "", true}, // no port
+		{"unix://", "", "", true},
+		{"http://127.0.0.1:6463", "", "", true},
+	}
+	for _, tt := range tests {
+		network, address, err := parseSocketAddress(tt.addr)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseSocketAddress(%q) err = %v, wantErr %v", tt.addr, err, tt.wantErr)
+			continue
+		}
+		if network != tt.network || address != tt.address {
+			t.Errorf("parseSocketAddress(%q) = %q, %q, want %q, %q", tt.addr, network, address, tt.network, tt.address)
+		}
+	}
+}
+
+func TestConnectIPCOverTCP(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	handshake := make(chan int32, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		opcode, _, err := readIpcResponse(conn)
+		if err != nil {
+			return
+		}
+		handshake <- opcode
+		sendIPCPacket(newIpcConn(conn), opFrame, []byte(`{"evt":"READY"}`))
+	}()
+
+	conn, err := connectIPC("tcp://"+ln.Addr().String(), "123")
+	if err != nil {
+		t.Fatalf("connectIPC over tcp: %v", err)
+	}
+	defer conn.Close()
+	if got := <-handshake; got != opHandshake {
+		t.Errorf("server got opcode %d, want handshake %d", got, opHandshake)
+	}
+}
+
+// serve each accepted connection with the next handler, reading the
+// handshake first
+func serveHandshakes(t *testing.T, handlers ...func(conn net.Conn)) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "discord-ipc-0")
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for _, handle := range handlers {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			if _, _, err := readIpcResponse(conn); err == nil {
+				handle(conn)
+			}
+			conn.Close()
+		}
+	}()
+	return path
+}
+
+func TestConnectIPCRetriesHandshakeEOF(t *testing.T) {
+	defer func(delay time.Duration) { handshakeRetryDelay = delay }(handshakeRetryDelay)
+	handshakeRetryDelay = time.Millisecond
+
+	hangUp := func(conn net.Conn) {}
+	ready := func(conn net.Conn) {
+		sendIPCPacket(newIpcConn(conn), opFrame, []byte(`{"evt":"READY"}`))
+		time.Sleep(50 * time.Millisecond)
+	}
+	conn, err := connectIPC(serveHandshakes(t, hangUp, ready), "123")
+	if err != nil {
+		t.Fatalf("connectIPC after one EOF: %v", err)
+	}
+	conn.Close()
+
+	_, err = connectIPC(serveHandshakes(t, hangUp, hangUp, hangUp), "123")
+	if !errors.Is(err, errHandshakeEOF) {
+		t.Errorf("connectIPC after repeated EOFs err = %v, want errHandshakeEOF", err)
+	}
+}
+
+// fakeDiscord runs script against the first connection to a temp unix
+// socket, the way Discord's IPC server would talk to the bridge. script
+// failures are reported through t once it returns.
+func fakeDiscord(t *testing.T, script func(conn *IpcConn) error) (path string, done <-chan error) {
+	t.Helper()
+	path = filepath.Join(t.TempDir(), "discord-ipc-0")
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	errc := make(chan error, 1)
+	go func() {
+		raw, err := ln.Accept()
+		if err != nil {
+			errc <- err
+			return
+		}
+		defer raw.Close()
+		errc <- script(newIpcConn(raw))
+	}()
+	return path, errc
+}
+
+// read a frame and check its opcode, decoding a JSON payload into v
+func expectFrame(conn *IpcConn, opcode int32, v any) ([]byte, error) {
+	got, payload, err := readIpcResponse(conn)
+	if err != nil {
+		return nil, err
+	}
+	if got != opcode {
+		return nil, fmt.Errorf("opcode = %d, want %d (payload %s)", got, opcode, payload)
+	}
+	if v != nil {
+		if err := json.Unmarshal(payload, v); err != nil {
+			return nil, fmt.Errorf("decode %s: %w", payload, err)
+		}
+	}
+	return payload, nil
+}
+
+// connect, set activity, clear it, and close against a fake Discord that
+// sends a PING and a reply to another command before each real reply
+func TestRunTestPresence(t *testing.T) {
+	defer func(hold time.Duration) { testPresenceHold = hold }(testPresenceHold)
+	testPresenceHold = time.Millisecond
+	defer func(path string) { socketPathOverride = path }(socketPathOverride)
+	populateMap([]DetectableApp{{ID: "1209665818464358430", Name: "Balatro"}})
+	defer populateMap(nil)
+
+	type command struct {
+		Cmd   string `json:"cmd"`
+		Nonce string `json:"nonce"`
+		Args  struct {
+			Pid      int             `json:"pid"`
+			Activity json.RawMessage `json:"activity"`
+		} `json:"args"`
+	}
+	// reply to cmd after a PING that must be PONGed and a stray reply that
+	// must be skipped
+	reply := func(conn *IpcConn, cmd command) error {
+		sendIPCPacket(conn, opPing, []byte(`{"ping":42}`))
+		if pong, err := expectFrame(conn, opPong, nil); err != nil || string(pong) != `{"ping":42}` {
+			return fmt.Errorf("PONG = %s, %v, want the PING payload echoed", pong, err)
+		}
+		sendIPCPacket(conn, opFrame, []byte(`{"cmd":"SET_ACTIVITY","evt":"ERROR","nonce":"someone-else","data":{"code":4000,"message":"not yours"}}`))
+		return sendIPCPacket(conn, opFrame, fmt.Appendf(nil, `{"cmd":%q,"nonce":%q,"data":{}}`, cmd.Cmd, cmd.Nonce))
+	}
+
+	var set, clear command
+	path, done := fakeDiscord(t, func(conn *IpcConn) error {
+		var handshake IpcHandshake
+		if _, err := expectFrame(conn, opHandshake, &handshake); err != nil {
+			return fmt.Errorf("handshake: %w", err)
+		}
+		if handshake.ClientID != "1209665818464358430" || handshake.V != 1 {
+			return fmt.Errorf("handshake = %+v, want Balatro's client ID on v1", handshake)
+		}
+		sendIPCPacket(conn, opFrame, []byte(`{"cmd":"DISPATCH","evt":"READY","data":{"v":1}}`))
+
+		if _, err := expectFrame(conn, opFrame, &set); err != nil {
+			return fmt.Errorf("set activity: %w", err)
+		}
+		if err := reply(conn, set); err != nil {
+			return err
+		}
+		if _, err := expectFrame(conn, opFrame, &clear); err != nil {
+			return fmt.Errorf("clear activity: %w", err)
+		}
+		if err := reply(conn, clear); err != nil {
+			return err
+		}
+		if _, err := expectFrame(conn, opClose, nil); err != nil {
+			return fmt.Errorf("close: %w", err)
+		}
+		return nil
+	})
+	socketPathOverride = path
+
+	start := time.Now()
+	if err := runTestPresence("Balatro", "Linux"); err != nil {
+		t.Fatalf("runTestPresence: %v", err)
+	}
+	if err := <-done; err != nil {
+		t.Fatalf("fake Discord: %v", err)
+	}
+	// a missed reply waits out the 5s read deadline
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("session took %v; a reply was probably not matched", elapsed)
+	}
+	if set.Cmd != "SET_ACTIVITY" || set.Args.Pid != os.Getpid() || !strings.Contains(string(set.Args.Activity), `"details":"Playing Balatro"`) {
+		t.Errorf("set = %+v %s, want Balatro's activity for this process", set, set.Args.Activity)
+	}
+	if string(clear.Args.Activity) != "null" {
+		t.Errorf("clear activity = %s, want null", clear.Args.Activity)
+	}
+	if set.Nonce == "" || set.Nonce == clear.Nonce {
+		t.Errorf("nonces %q and %q, want distinct ones", set.Nonce, clear.Nonce)
+	}
+}
+
+func TestRunTestPresenceEmptyMapping(t *testing.T) {
+	defer func(path string) { socketPathOverride = path }(socketPathOverride)
+	manualMappings["Balatro"] = ""
+	defer delete(manualMappings, "Balatro")
+	socketPathOverride = serveHandshakes(t, func(net.Conn) {
+		t.Error("connected with an empty client ID")
+	})
+	if err := runTestPresence("Balatro", "Linux"); err == nil || !strings.Contains(err.Error(), "manual_mappings") {
+		t.Errorf("runTestPresence err = %v, want a manual_mappings error", err)
+	}
+}
+
+func TestAwaitReplyError(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+	go sendIPCPacket(newIpcConn(server), opFrame, []byte(`{"cmd":"SET_ACTIVITY","evt":"ERROR","nonce":"7","data":{"code":4002,"message":"child \"activity\" fails"}}`))
+	_, err := awaitReply(newIpcConn(client), "7")
+	var derr *discordError
+	if !errors.As(err, &derr) || derr.Code != 4002 || !strings.Contains(derr.Message, "activity") {
+		t.Errorf("awaitReply err = %v, want Discord's 4002 error", err)
+	}
+
+	go sendIPCPacket(newIpcConn(server), opClose, []byte(`{"code":1000}`))
+	if _, err := awaitReply(newIpcConn(client), "8"); !errors.Is(err, ErrConnectionLost) {
+		t.Errorf("awaitReply after a close err = %v, want ErrConnectionLost", err)
+	}
+}
+
+func TestConnectIPCRejected(t *testing.T) {
+	reject := func(conn net.Conn) {
+		sendIPCPacket(newIpcConn(conn), opClose, []byte(`{"code":4000,"message":"Invalid Client ID"}`))
+	}
+	_, err := connectIPC(serveHandshakes(t, reject), "123")
+	if !errors.Is(err, ErrHandshakeRejected) || errors.Is(err, ErrConnectionLost) {
+		t.Fatalf("connectIPC err = %v, want ErrHandshakeRejected", err)
+	}
+	if !strings.Contains(err.Error(), "Invalid Client ID") {
+		t.Errorf("rejection error %q doesn't include Discord's reason", err)
+	}
+}
+
+func TestConnectIPCBadHandshakeReply(t *testing.T) {
+	// a header claiming a payload over the frame cap
+	garbage := func(conn net.Conn) {
+		conn.Write([]byte{1, 0, 0, 0, 0xff, 0xff, 0xff, 0x7f})
+	}
+	conn, err := connectIPC(serveHandshakes(t, garbage), "123")
+	if !errors.Is(err, ErrConnectionLost) || conn != nil {
+		t.Fatalf("connectIPC = %v, %v, want no connection and ErrConnectionLost", conn, err)
+	}
+}
+
+func TestIPCErrorSentinels(t *testing.T) {
+	if !errors.Is(errHandshakeEOF, ErrConnectionLost) {
+		t.Error("errHandshakeEOF isn't ErrConnectionLost")
+	}
+
+	client, server := net.Pipe()
+	server.Close()
+	err := setActivity(newIpcConn(client), DetectedGame{Name: "Portal 2"}, "Linux")
+	if !errors.Is(err, ErrConnectionLost) {
+		t.Errorf("setActivity on a closed connection err = %v, want ErrConnectionLost", err)
+	}
+
+	t.Setenv("TMPDIR", t.TempDir())
+	oldFlavor, oldDirs := discordFlavor, socketDirs
+	t.Cleanup(func() { discordFlavor, socketDirs = oldFlavor, oldDirs })
+	discordFlavor, socketDirs = "auto", nil
+	for _, path := range socketCandidates(os.Getuid(), discordFlavor) {
+		if socketExists(path) {
+			t.Skipf("a Discord socket exists at %s", path)
+		}
+	}
+	if _, err := findDiscordSocket(); !errors.Is(err, ErrSocketNotFound) {
+		t.Errorf("findDiscordSocket err = %v, want ErrSocketNotFound", err)
+	}
+}
+
+func TestSocketCandidatesFlavor(t *testing.T) {
+	contains := func(paths []string, want string) bool {
+		for _, p := range paths {
+			if p == want {
+				return true
+			}
+		}
+		return false
+	}
+	canaryFlatpak := "/run/user/1000/app/com.discordapp.DiscordCanary/discord-ipc-0"
+	stableFlatpak := "/run/user/1000/app/com.discordapp.Discord/discord-ipc-0"
+
+	auto := socketCandidates(1000, "auto")
+	if auto[0] != "/run/user/1000/discord-ipc-0" {
+		t.Errorf("auto candidates start with %q, want the native socket", auto[0])
+	}
+	if !contains(auto, canaryFlatpak) || !contains(auto, stableFlatpak) {
+		t.Error("auto candidates should include every flavor")
+	}
+
+	canary := socketCandidates(1000, "canary")
+	if canary[0] != canaryFlatpak {
+		t.Errorf("canary candidates start with %q, want %q", canary[0], canaryFlatpak)
+	}
+	if contains(canary, stableFlatpak) {
+		t.Error("canary candidates should skip stable-only sockets")
+	}
+	if !contains(canary, "/run/user/1000/discord-ipc-0") {
+		t.Error("canary candidates should keep the shared native socket")
+	}
+}
+
+func TestSocketCandidatesExtraDirs(t *testing.T) {
+	t.Setenv("HOME", "/home/tester")
+	t.Setenv("NIX_RUN", "/nix/run")
+	path := filepath.Join(t.TempDir(), "config.json")
+	writeTestFile(t, path, `{"socket_dirs": ["~/.discord", "$NIX_RUN/discord", ""]}`)
+	defer resetConfigCollections()
+	loadConfig(path)
+
+	if want := []string{"/home/tester/.discord", "/nix/run/discord"}; !slices.Equal(socketDirs, want) {
+		t.Fatalf("socketDirs = %v, want %v", socketDirs, want)
+	}
+	candidates := socketCandidates(1000, "canary")
+	if candidates[0] != "/run/user/1000/app/com.discordapp.DiscordCanary/discord-ipc-0" {
+		t.Errorf("extra dirs should come after the built-ins, got %v first", candidates[0])
+	}
+	if got := candidates[len(candidates)-1]; got != "/nix/run/discord/discord-ipc-9" {
+		t.Errorf("last candidate = %q, want the last slot of the last extra dir", got)
+	}
+	if !slices.Contains(candidates, "/home/tester/.discord/discord-ipc-0") {
+		t.Errorf("candidates missing the first extra dir: %v", candidates)
+	}
+}
+
+func TestSanitizeDisplayName(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"ELDEN RING™", "ELDEN RING"},
+		{"Tom Clancy's Rainbow Six® Siege", "Tom Clancy's Rainbow Six Siege"},
+		{"  Spaced   Out  ", "Spaced Out"},
+		{"Balatro", "Balatro"},
+	}
+	for _, tt := range tests {
+		if got := sanitizeDisplayName(tt.input); got != tt.want {
+			t.Errorf("sanitizeDisplayName(%q) = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestVerbFor(t *testing.T) {
+	appCategories = map[string]string{
+		normalizeGameName("OBS Studio"): "streaming",
+		normalizeGameName("Blender"):    "application",
+		normalizeGameName("Odd Tool"):   "unknown",
+	}
+	defer func() { appCategories = map[string]string{} }()
+
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"OBS Studio", "Streaming with"},
+		{"Blender", "Using"},
+		{"Balatro", "Playing"},
+		{"Odd Tool", "Playing"},
+	}
+	for _, tt := range tests {
+		if got := verbFor(DetectedGame{Name: tt.name}); got != tt.want {
+			t.Errorf("verbFor(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+
+	got := renderTemplate("{verb} {game}", DetectedGame{Name: "Blender"}, "Arch Linux")
+	if got != "Using Blender" {
+		t.Errorf("renderTemplate = %q, want %q", got, "Using Blender")
+	}
+}
+
+func TestScanIntervalFor(t *testing.T) {
+	scanIntervalOverrides = map[string]time.Duration{normalizeGameName("Celeste"): 2 * time.Second}
+	defer func() { scanIntervalOverrides = map[string]time.Duration{} }()
+
+	if got := scanIntervalFor("Celeste™"); got != 2*time.Second {
+		t.Errorf("scanIntervalFor(Celeste™) = %v, want 2s", got)
+	}
+	if got := scanIntervalFor("Balatro"); got != scanInterval {
+		t.Errorf("scanIntervalFor(Balatro) = %v, want default %v", got, scanInterval)
+	}
+	if got := scanIntervalFor(""); got != scanInterval {
+		t.Errorf("scanIntervalFor(no game) = %v, want default %v", got, scanInterval)
+	}
+}
+
+func TestScanIntervalPowerSave(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, "AC", "online"), "1\n")
+	writeTestFile(t, filepath.Join(dir, "BAT0", "status"), "Charging\n")
+	defer func(prev string) { powerSupplyDir, powerSave = prev, "off" }(powerSupplyDir)
+	powerSupplyDir, powerSave = dir, "battery"
+	scanIntervalOverrides = map[string]time.Duration{normalizeGameName("Celeste"): 2 * time.Second}
+	defer func() { scanIntervalOverrides = map[string]time.Duration{} }()
+
+	if got := scanIntervalFor("Celeste"); got != 2*time.Second {
+		t.Errorf("scanIntervalFor(Celeste) on AC = %v, want the 2s override", got)
+	}
+	writeTestFile(t, filepath.Join(dir, "BAT0", "status"), "Discharging\n")
+	if got := scanIntervalFor("Celeste"); got != powerSaveInterval {
+		t.Errorf("scanIntervalFor(Celeste) on battery = %v, want %v", got, powerSaveInterval)
+	}
+	if got := scanIntervalFor(""); got != powerSaveInterval {
+		t.Errorf("scanIntervalFor(no game) on battery = %v, want %v", got, powerSaveInterval)
+	}
+
+	writeTestFile(t, filepath.Join(dir, "BAT0", "status"), "Full\n")
+	powerSave = "always"
+	if got := scanIntervalFor(""); got != powerSaveInterval {
+		t.Errorf("scanIntervalFor with power_save always = %v, want %v", got, powerSaveInterval)
+	}
+	if got := longestScanInterval(); got < powerSaveInterval {
+		t.Errorf("longestScanInterval = %v, want at least %v", got, powerSaveInterval)
+	}
+}
+
+func TestReconnectDelay(t *testing.T) {
+	tests := []struct {
+		attempt int
+		base    time.Duration
+	}{
+		{0, 5 * time.Second},
+		{1, 10 * time.Second},
+		{3, 40 * time.Second},
+		{5, 2 * time.Minute},  // capped
+		{64, 2 * time.Minute}, // no shift overflow
+	}
+	for _, tt := range tests {
+		lo := time.Duration(float64(tt.base) * (1 - reconnectJitter))
+		hi := time.Duration(float64(tt.base) * (1 + reconnectJitter))
+		for range 100 {
+			if got := reconnectDelay(tt.attempt); got < lo || got > hi {
+				t.Fatalf("reconnectDelay(%d) = %v, want within [%v, %v]", tt.attempt, got, lo, hi)
+			}
+		}
+	}
+}
+
+// chunkedConn records writes a few bytes at a time, yielding in between,
+// so unserialized concurrent writers would interleave frame bytes
+type chunkedConn struct {
+	net.Conn
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (c *chunkedConn) Write(p []byte) (int, error) {
+	for i := 0; i < len(p); i += 3 {
+		c.mu.Lock()
+		c.buf.Write(p[i:min(i+3, len(p))])
+		c.mu.Unlock()
+		runtime.Gosched()
+	}
+	return len(p), nil
+}
+
+// shortConn accepts at most a few bytes per Write, without an error
+type shortConn struct {
+	net.Conn
+	buf   bytes.Buffer
+	stall bool // accept nothing
+}
+
+func (c *shortConn) Write(p []byte) (int, error) {
+	if c.stall {
+		return 0, nil
+	}
+	return c.buf.Write(p[:min(3, len(p))])
+}
+
+func TestSendIPCPacketShortWrites(t *testing.T) {
+	raw := &shortConn{}
+	payload := []byte(`{"cmd":"SET_ACTIVITY"}`)
+	if err := sendIPCPacket(newIpcConn(raw), opFrame, payload); err != nil {
+		t.Fatalf("sendIPCPacket: %v", err)
+	}
+	if raw.buf.Len() != 8+len(payload) {
+		t.Fatalf("wrote %d bytes, want %d", raw.buf.Len(), 8+len(payload))
+	}
+	if got := raw.buf.Bytes()[8:]; !bytes.Equal(got, payload) {
+		t.Errorf("payload = %q, want %q", got, payload)
+	}
+
+	stalled := &shortConn{stall: true}
+	if err := sendIPCPacket(newIpcConn(stalled), opFrame, payload); !errors.Is(err, io.ErrShortWrite) {
+		t.Errorf("sendIPCPacket on a stalled conn err = %v, want io.ErrShortWrite", err)
+	}
+}
+
+func TestSendIPCPacketConcurrent(t *testing.T) {
+	raw := &chunkedConn{}
+	conn := newIpcConn(raw)
+
+	const writers, frames = 8, 50
+	var wg sync.WaitGroup
+	for w := range writers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range frames {
+				payload := fmt.Appendf(nil, `{"writer":%d,"frame":%d}`, w, i)
+				if err := sendIPCPacket(conn, opFrame, payload); err != nil {
+					t.Errorf("sendIPCPacket: %v", err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	// every frame must decode intact from the byte stream
+	data := raw.buf.Bytes()
+	count := 0
+	for len(data) > 0 {
+		if len(data) < 8 {
+			t.Fatalf("truncated header after %d frames", count)
+		}
+		opcode := binary.LittleEndian.Uint32(data[0:4])
+		length := int(binary.LittleEndian.Uint32(data[4:8]))
+		if opcode != opFrame || length > len(data)-8 {
+			t.Fatalf("corrupt frame %d: opcode %d, length %d", count, opcode, length)
+		}
+		var frame struct{ Writer, Frame int }
+		if err := json.Unmarshal(data[8:8+length], &frame); err != nil {
+			t.Fatalf("frame %d payload %q: %v", count, data[8:8+length], err)
+		}
+		data = data[8+length:]
+		count++
+	}
+	if count != writers*frames {
+		t.Errorf("decoded %d frames, want %d", count, writers*frames)
+	}
+}
+
+// JSON game list with n generated apps
+func testGameList(n int) []byte {
+	apps := make([]DetectableApp, n)
+	for i := range apps {
+		apps[i] = DetectableApp{ID: fmt.Sprintf("%d", 1000+i), Name: fmt.Sprintf("Test Game %d", i)}
+	}
+	data, _ := json.Marshal(apps)
+	return data
+}
+
+// point the game list download at a test server for the rest of the test
+func serveGameList(t *testing.T, handler http.HandlerFunc) {
+	t.Helper()
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+	prevURL := discordApiUrl
+	discordApiUrl = srv.URL
+	t.Cleanup(func() { discordApiUrl = prevURL })
+}
+
+func TestRefreshGameCacheGzip(t *testing.T) {
+	serveGameList(t, func(w http.ResponseWriter, r *http.Request) {
+		if !strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
+			t.Errorf("request Accept-Encoding = %q, want gzip", r.Header.Get("Accept-Encoding"))
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Encoding", "gzip")
+		gz := gzip.NewWriter(w)
+		gz.Write(testGameList(minDetectableApps))
+		gz.Close()
+	})
+
+	cacheFile := filepath.Join(t.TempDir(), "games.json")
+	apps, err := refreshGameCache(currentGameListSource(cacheFile))
+	if err != nil {
+		t.Fatalf("refreshGameCache: %v", err)
+	}
+	if len(apps) != minDetectableApps || apps[0].Name != "Test Game 0" {
+		t.Fatalf("refreshGameCache returned %d apps, want %d", len(apps), minDetectableApps)
+	}
+
+	// the cache holds plain JSON, not the gzip stream
+	cached, err := readGameCache(cacheFile)
+	if err != nil {
+		t.Fatalf("cache is not plain JSON: %v", err)
+	}
+	if len(cached) != minDetectableApps || cached[0].ID != "1000" {
+		t.Errorf("cached %d apps, want %d", len(cached), minDetectableApps)
+	}
+}
+
+func TestRefreshGameCacheWritesResponseBytes(t *testing.T) {
+	// trailing whitespace after the array is past where the decoder stops
+	body := append(testGameList(minDetectableApps), []byte("\n\n")...)
+	serveGameList(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write(body)
+	})
+
+	dir := t.TempDir()
+	cacheFile := filepath.Join(dir, "games.json")
+	if _, err := refreshGameCache(currentGameListSource(cacheFile)); err != nil {
+		t.Fatalf("refreshGameCache: %v", err)
+	}
+	cached, err := os.ReadFile(cacheFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(cached, body) {
+		t.Errorf("cache holds %d bytes, want the %d-byte response", len(cached), len(body))
+	}
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 {
+		t.Errorf("cache dir has %d entries, want only the cache (temp file left behind?)", len(entries))
+	}
+}
+
+func TestRefreshGameCacheRejectsShortList(t *testing.T) {
+	serveGameList(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`[]`))
+	})
+
+	cacheFile := filepath.Join(t.TempDir(), "games.json")
+	if _, err := refreshGameCache(currentGameListSource(cacheFile)); err == nil {
+		t.Fatal("refreshGameCache accepted an empty list")
+	}
+	if _, err := os.Stat(cacheFile); !os.IsNotExist(err) {
+		t.Error("refreshGameCache wrote a cache for an empty list")
+	}
+	if entries, _ := os.ReadDir(filepath.Dir(cacheFile)); len(entries) != 0 {
+		t.Errorf("refreshGameCache left %d files behind", len(entries))
+	}
+}
+
+func TestLoadGameDataRefetchesEmptyCache(t *testing.T) {
+	defer populateMap(nil)
+	fetches := 0
+	serveGameList(t, func(w http.ResponseWriter, r *http.Request) {
+		fetches++
+		w.Write(testGameList(minDetectableApps))
+	})
+
+	// a fresh-but-empty cache must not be trusted
+	cacheFile := filepath.Join(t.TempDir(), "games.json")
+	if err := os.WriteFile(cacheFile, []byte(`[]`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := loadGameData(cacheFile); err != nil {
+		t.Fatalf("loadGameData: %v", err)
+	}
+	if fetches != 1 {
+		t.Errorf("fetched %d times, want 1", fetches)
+	}
+	if got := appCount(); got != minDetectableApps {
+		t.Errorf("appCount = %d, want %d", got, minDetectableApps)
+	}
+}
+
+func TestForcedGame(t *testing.T) {
+	t.Setenv(forceGameEnv, "")
+	if _, ok := forcedGame(); ok {
+		t.Error("forcedGame with an empty variable should not force a game")
+	}
+
+	t.Setenv(forceGameEnv, "  Cloud Game  ")
+	game, ok := forcedGame()
+	if !ok || game.Name != "Cloud Game" || game.Pid != os.Getpid() {
+		t.Errorf("forcedGame = %+v, %v, want Cloud Game with the bridge's PID", game, ok)
+	}
+}
+
+func TestTemplatesFor(t *testing.T) {
+	gameTemplates = map[string]TemplateConfig{normalizeGameName("Crypt of the NecroDancer"): {Details: "Scoring"}}
+	defer func() { gameTemplates = map[string]TemplateConfig{} }()
+
+	got := templatesFor(DetectedGame{Name: "Crypt of the NecroDancer"})
+	if got.Details != "Scoring" || got.State != stateTemplate {
+		t.Errorf("templatesFor(NecroDancer) = %+v, want Scoring details and the global state", got)
+	}
+	got = templatesFor(DetectedGame{Name: "Balatro"})
+	if got.Details != detailsTemplate || got.State != stateTemplate || got.LargeText != largeTextTemplate {
+		t.Errorf("templatesFor(Balatro) = %+v, want global templates", got)
+	}
+}
+
+func TestSetupLoggingOff(t *testing.T) {
+	prev := slog.Default()
+	defer slog.SetDefault(prev)
+
+	if err := setupLogging("json", "off"); err != nil {
+		t.Fatalf("setupLogging(json, off): %v", err)
+	}
+	if slog.Default().Enabled(context.Background(), slog.LevelError) {
+		t.Error("-log-level off should discard errors too")
+	}
+	if err := setupLogging("text", "loud"); err == nil {
+		t.Error("setupLogging with an unknown level should fail")
+	}
+	if err := setupLogging("yaml", "off"); err == nil {
+		t.Error("setupLogging with an unknown format should fail, even when off")
+	}
+}
+
+func TestTraceIPC(t *testing.T) {
+	prev := slog.Default()
+	defer slog.SetDefault(prev)
+	var logs bytes.Buffer
+	slog.SetDefault(slog.New(slog.NewTextHandler(&logs, &slog.HandlerOptions{Level: slog.LevelDebug})))
+
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+	go sendIPCPacket(newIpcConn(server), opFrame, []byte(`{"evt":"READY"}`))
+	if _, _, err := readIpcResponse(client); err != nil {
+		t.Fatalf("readIpcResponse: %v", err)
+	}
+	if strings.Contains(logs.String(), "IPC frame") {
+		t.Fatalf("frames logged without -trace-ipc:\n%s", logs.String())
+	}
+
+	traceIPC = true
+	defer func() { traceIPC = false }()
+	go sendIPCPacket(newIpcConn(server), opFrame, []byte(`{"evt":"READY"}`))
+	if _, _, err := readIpcResponse(client); err != nil {
+		t.Fatalf("readIpcResponse: %v", err)
+	}
+	for _, want := range []string{"dir=send", "dir=recv", "header=010000000f000000", `\"evt\": \"READY\"`} {
+		if !strings.Contains(logs.String(), want) {
+			t.Errorf("trace log missing %s:\n%s", want, logs.String())
+		}
+	}
+}
+
+func TestLogAnonymizeGames(t *testing.T) {
+	prev := slog.Default()
+	defer slog.SetDefault(prev)
+	var logs bytes.Buffer
+	slog.SetDefault(slog.New(slog.NewTextHandler(&logs, &slog.HandlerOptions{Level: slog.LevelDebug})))
+
+	anonymizeGames = true
+	defer func() { anonymizeGames = false }()
+	traceIPC = true
+	defer func() { traceIPC = false }()
+
+	slog.Info("Presenting game", "game", loggedGame("Hollow Knight"))
+	slog.Info("Presenting game", "game", loggedGame("hollow knight"), normalizedAttr("Hollow Knight"), "client_id", loggedID("1209665818464358430"), "appid", loggedID("367520"))
+	slog.Warn("Ignoring unreadable presence file", "path", loggedPath("/run/presence/Hollow Knight.json"))
+	activity, _ := sentActivity(t, DetectedGame{Name: "Hollow Knight"})
+	if activity.Details != "Playing Hollow Knight" {
+		t.Errorf("details = %q, want the real name sent to Discord", activity.Details)
+	}
+	for _, leak := range []string{"hollow", "1209665818464358430", "367520", "normalized"} {
+		if strings.Contains(strings.ToLower(logs.String()), leak) {
+			t.Errorf("%s logged with log_anonymize_games:\n%s", leak, logs.String())
+		}
+	}
+	hashed := loggedGame("Hollow Knight").LogValue().String()
+	if !strings.HasPrefix(hashed, "game-") || strings.Count(logs.String(), "game="+hashed) < 2 {
+		t.Errorf("want both spellings to log game=%s:\n%s", hashed, logs.String())
+	}
+	sum := sha256.Sum256([]byte("hollowknight"))
+	if hashed == "game-"+hex.EncodeToString(sum[:4]) {
+		t.Error("game hash isn't keyed")
+	}
+
+	anonymizeGames = false
+	if got := loggedGame("Hollow Knight").LogValue().String(); got != "Hollow Knight" {
+		t.Errorf("loggedGame without log_anonymize_games = %q", got)
+	}
+	if got := normalizedAttr("Hollow Knight"); got.Value.String() != "hollowknight" {
+		t.Errorf("normalizedAttr without log_anonymize_games = %v", got)
+	}
+}
+
+func TestLoadLogKey(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "log-key")
+	key := loadLogKey(path)
+	if len(key) != 32 {
+		t.Fatalf("key is %d bytes, want 32", len(key))
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0600 {
+		t.Fatalf("saved key = %v, %v, want a private file", info, err)
+	}
+	if again := loadLogKey(path); !bytes.Equal(again, key) {
+		t.Error("key changed across loads")
+	}
+	writeTestFile(t, path, "short")
+	if replaced := loadLogKey(path); len(replaced) != 32 || bytes.Equal(replaced, key) {
+		t.Errorf("malformed key file wasn't replaced: %x", replaced)
+	}
+}
+
+func TestNormalizeAssetImage(t *testing.T) {
+	tests := []struct {
+		image string
+		want  string
+		ok    bool
+	}{
+		{"", "", true},
+		{"balatro_logo", "balatro_logo", true},
+		{" Balatro_Logo ", "balatro_logo", true},
+		{"https://example.com/celeste.png", "https://example.com/celeste.png", true},
+		{"//example.com/celeste.png", "https://example.com/celeste.png", true},
+		{"mp:external/abc/https/example.com/celeste.png", "mp:external/abc/https/example.com/celeste.png", true},
+		{"mp:", "", false},
+		{"http://example.com/celeste.png", "", false},
+		{"file:///home/user/art.png", "", false},
+		{"https://", "", false},
+		{"example.com/celeste.png", "", false},
+		{"balatro logo", "", false},
+	}
+	for _, tt := range tests {
+		got, err := normalizeAssetImage(tt.image)
+		if got != tt.want || (err == nil) != tt.ok {
+			t.Errorf("normalizeAssetImage(%q) = %q, %v, want %q, ok=%v", tt.image, got, err, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestSetActivityNormalizesImages(t *testing.T) {
+	assetOverrides = map[string]ActivityAssets{
+		normalizeGameName("Balatro"): {LargeImage: "//example.com/balatro.png", SmallImage: "Joker"},
+		normalizeGameName("Celeste"): {LargeImage: "example.com/celeste.png", SmallImage: "http://example.com/berry.png"},
+	}
+	defer func() {
+		assetOverrides = map[string]ActivityAssets{}
+		warnedImages = map[string]bool{}
+	}()
+
+	activity, raw := sentActivity(t, DetectedGame{Name: "Balatro"})
+	if activity.Assets == nil || activity.Assets.LargeImage != "https://example.com/balatro.png" || activity.Assets.SmallImage != "joker" {
+		t.Errorf("activity = %s, want normalized images", raw)
+	}
+	activity, raw = sentActivity(t, DetectedGame{Name: "Celeste"})
+	if activity.Assets == nil || activity.Assets.LargeImage != "" || activity.Assets.SmallImage != "" {
+		t.Errorf("activity = %s, want images Discord won't render left out", raw)
+	}
+}
+
+func TestSwitchNeedsReconnect(t *testing.T) {
+	if !switchNeedsReconnect("111", "222", "Hades", "Celeste") {
+		t.Error("a different client ID should reconnect")
+	}
+	if switchNeedsReconnect("111", "111", "Hades", "Celeste") {
+		t.Error("a game sharing the client ID should reuse the connection")
+	}
+
+	reconnectOnSwitch = true
+	defer func() { reconnectOnSwitch = false }()
+	if !switchNeedsReconnect("111", "111", "Hades", "Celeste") {
+		t.Error("reconnect_on_switch should reconnect between games sharing a client ID")
+	}
+	if switchNeedsReconnect("111", "111", "Hades", "Hades") {
+		t.Error("reconnect_on_switch reconnected without a switch")
+	}
+}
+
+func TestSwitchDebouncer(t *testing.T) {
+	var d switchDebouncer
+	if d.ready("Hades") {
+		t.Fatal("switched after one tick")
+	}
+	// a different candidate restarts the count
+	if d.ready("Celeste") {
+		t.Fatal("switched to a new candidate after one tick")
+	}
+	if !d.ready("Celeste") {
+		t.Fatal("did not switch after two consecutive ticks")
+	}
+
+	d.ready("Hades")
+	d.reset()
+	if d.ready("Hades") {
+		t.Error("reset should require the full tick count again")
+	}
+}
+
+func TestHandshakeBlacklist(t *testing.T) {
+	b := newHandshakeBlacklist()
+	start := time.Now()
+	for i := 1; i < handshakeFailureLimit; i++ {
+		if b.rejected("111", start) {
+			t.Fatalf("blacklisted after %d failures, want %d", i, handshakeFailureLimit)
+		}
+	}
+	if !b.rejected("111", start) {
+		t.Fatalf("not blacklisted after %d failures", handshakeFailureLimit)
+	}
+	if !b.blocked("111", start.Add(time.Minute)) || b.blocked("222", start) {
+		t.Error("only the rejected client ID should be blocked")
+	}
+	if got := b.entries(); len(got) != 1 || got[0].ClientID != "111" || got[0].Failures != handshakeFailureLimit || !got[0].Until.Equal(start.Add(handshakeBlacklistFor)) {
+		t.Errorf("entries = %+v", got)
+	}
+
+	// expired: a fresh run of attempts
+	if b.blocked("111", start.Add(handshakeBlacklistFor)) || len(b.entries()) != 0 {
+		t.Error("blacklist entry didn't expire")
+	}
+	if b.rejected("111", start) {
+		t.Error("blacklisted again on the first failure after expiry")
+	}
+
+	// a successful handshake resets the count
+	b.accepted("111")
+	for i := 1; i < handshakeFailureLimit; i++ {
+		b.rejected("111", start)
+	}
+	if b.blocked("111", start) {
+		t.Error("blocked before reaching the limit again")
+	}
+
+	handshakeFailureLimit = 0
+	defer func() { handshakeFailureLimit = 3 }()
+	for range 10 {
+		if b.rejected("333", start) {
+			t.Fatal("blacklisted with handshake_failure_limit 0")
+		}
+	}
+}
+
+func TestSessionGate(t *testing.T) {
+	minSession = time.Minute
+	defer func() { minSession = 0 }()
+
+	var g sessionGate
+	start := time.Now()
+	if g.ready("Hades", start) {
+		t.Fatal("ready on the first tick")
+	}
+	if g.ready("Hades", start.Add(59*time.Second)) {
+		t.Fatal("ready before min_session_seconds")
+	}
+	if !g.ready("Hades", start.Add(time.Minute)) {
+		t.Fatal("not ready after min_session_seconds")
+	}
+
+	// a gap restarts the session
+	g.ready("", start.Add(61*time.Second))
+	if g.ready("Hades", start.Add(62*time.Second)) {
+		t.Error("ready right after the game was gone")
+	}
+
+	minSession = 0
+	if !g.ready("Celeste", start) {
+		t.Error("not ready with min_session_seconds disabled")
+	}
+}
+
+func TestGamePriority(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	writeTestFile(t, path, `{"game_priority": ["Final Fantasy XIV", "Balatro", "final-fantasy-xiv"]}`)
+	defer resetConfigCollections()
+	loadConfig(path)
+
+	if got := priorityOrder(); !slices.Equal(got, []string{"finalfantasyxiv", "balatro"}) {
+		t.Fatalf("priorityOrder = %v, want the duplicate dropped", got)
+	}
+	mmo, idle, other := DetectedGame{Name: "FINAL FANTASY XIV"}, DetectedGame{Name: "Balatro"}, DetectedGame{Name: "Cookie Clicker"}
+	if !outranks(mmo, idle) || outranks(idle, mmo) {
+		t.Error("the first listed game should outrank the second")
+	}
+	if !outranks(idle, other) || outranks(other, idle) {
+		t.Error("a listed game should outrank an unlisted one")
+	}
+	if outranks(other, DetectedGame{Name: "Hades"}) {
+		t.Error("unlisted games should tie")
+	}
+}
+
+func TestUnmatchedGames(t *testing.T) {
+	u := unmatchedGames{}
+	if !u.first("Some Indie Game") {
+		t.Fatal("first sighting not reported")
+	}
+	if u.first("some-indie-game") {
+		t.Error("a name normalizing to the same key was reported again")
+	}
+	if !u.first("Other Game") {
+		t.Error("a different game wasn't reported")
+	}
+}
+
+func TestActivityTypeFor(t *testing.T) {
+	appCategories = map[string]string{normalizeGameName("Spotify"): "music", normalizeGameName("Blender"): "application"}
+	defer func() { appCategories = map[string]string{} }()
+
+	tests := []struct {
+		name string
+		want int
+	}{
+		{"Spotify", activityListening},
+		{"Blender", activityPlaying},
+		{"Balatro", activityPlaying},
+	}
+	for _, tt := range tests {
+		if got := activityTypeFor(DetectedGame{Name: tt.name}); got != tt.want {
+			t.Errorf("activityTypeFor(%q) = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+	if validActivityType(1) || validActivityType(4) || !validActivityType(activityCompeting) {
+		t.Error("validActivityType should reject streaming and custom, and accept competing")
+	}
+}
+
+func TestLoadConfigRebuildsCollections(t *testing.T) {
+	dir := t.TempDir()
+	first := filepath.Join(dir, "first.json")
+	second := filepath.Join(dir, "second.json")
+	writeTestFile(t, first, `{"ignored_games": ["Old Game"], "ignored_processes": ["oldwrapper"]}`)
+	writeTestFile(t, second, `{"ignored_games": ["New Game"]}`)
+	defer resetConfigCollections()
+
+	loadConfig(first)
+	if !ignoredGames[normalizeGameName("Old Game")] || !ignoredProcesses["oldwrapper"] {
+		t.Fatalf("first load didn't merge entries: %v %v", ignoredGames, ignoredProcesses)
+	}
+	loadConfig(second)
+	if ignoredGames[normalizeGameName("Old Game")] || ignoredProcesses["oldwrapper"] {
+		t.Errorf("entries removed from config survived reload: %v %v", ignoredGames, ignoredProcesses)
+	}
+	if !ignoredGames[normalizeGameName("New Game")] {
+		t.Errorf("new entry missing after reload: %v", ignoredGames)
+	}
+	if !ignoredProcesses["reaper"] || !launcherProcesses["steam"] || categoryVerbs["game"] != "Playing" {
+		t.Error("built-in entries missing after reload")
+	}
+}
+
+func TestLoadConfigResetsScalars(t *testing.T) {
+	dir := t.TempDir()
+	first := filepath.Join(dir, "first.json")
+	second := filepath.Join(dir, "second.json")
+	broken := filepath.Join(dir, "broken.json")
+	writeTestFile(t, first, `{"scan_interval_seconds": 60, "default_client_id": "42", "details_template": "{game}", "ignored_games": ["Old Game"]}`)
+	writeTestFile(t, second, `{}`)
+	writeTestFile(t, broken, `{"scan_interval_seconds": 30,`)
+	defer func() {
+		resetConfigCollections()
+		resetConfigScalars()
+	}()
+
+	loadConfig(first)
+	if scanInterval != time.Minute || defaultClientID != "42" || detailsTemplate != "{game}" {
+		t.Fatalf("first load didn't apply settings: %v %q %q", scanInterval, defaultClientID, detailsTemplate)
+	}
+	// a file that fails to parse keeps everything from the last good load
+	loadConfig(broken)
+	if scanInterval != time.Minute || defaultClientID != "42" || !ignoredGames[normalizeGameName("Old Game")] {
+		t.Errorf("broken config changed settings: %v %q %v", scanInterval, defaultClientID, ignoredGames)
+	}
+	loadConfig(second)
+	if scanInterval != 15*time.Second || defaultClientID != "" || detailsTemplate != "{verb} {game}" {
+		t.Errorf("settings removed from config survived reload: %v %q %q", scanInterval, defaultClientID, detailsTemplate)
+	}
+}
+
+func TestEffectiveConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	writeTestFile(t, path, `{"ignored_games": ["Some Game"], "steamgriddb_key": "secret", "scan_interval_overrides": {"Some Game": 60}}`)
+	defer func() {
+		resetConfigCollections()
+		steamGridDBKey = ""
+	}()
+	loadConfig(path)
+
+	var buf bytes.Buffer
+	if err := writeEffectiveConfig(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(buf.String(), "secret") {
+		t.Errorf("steamgriddb_key not redacted:\n%s", buf.String())
+	}
+	var cfg Config
+	if err := json.Unmarshal(buf.Bytes(), &cfg); err != nil {
+		t.Fatalf("effective config isn't valid config JSON: %v", err)
+	}
+	if cfg.SteamGridDBKey != redacted {
+		t.Errorf("steamgriddb_key = %q, want %q", cfg.SteamGridDBKey, redacted)
+	}
+	if !slices.Contains(cfg.IgnoredGames, normalizeGameName("Some Game")) {
+		t.Errorf("ignored_games = %v, missing configured game", cfg.IgnoredGames)
+	}
+	if !slices.Contains(cfg.IgnoredProcesses, "reaper") {
+		t.Errorf("ignored_processes = %v, missing built-in", cfg.IgnoredProcesses)
+	}
+	if got := cfg.ScanIntervalOverrides[normalizeGameName("Some Game")]; got != 60 {
+		t.Errorf("scan interval override = %d, want 60", got)
+	}
+	if len(cfg.CloudTitlePatterns) != len(builtinCloudPatterns()) {
+		t.Errorf("cloud_title_patterns = %v, want the built-ins", cfg.CloudTitlePatterns)
+	}
+}
+
+func TestLoadConfigUnmatchedPolicy(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	defer func() {
+		defaultClientID = ""
+		unmatchedPolicy = unmatchedSkip
+	}()
+	tests := []struct {
+		config string
+		want   string
+	}{
+		{`{}`, unmatchedSkip},
+		// unset and unknown are both skip, default app or not
+		{`{"default_client_id": "1111111111111111111"}`, unmatchedSkip},
+		{`{"default_client_id": "1111111111111111111", "unmatched_policy": "loud"}`, unmatchedSkip},
+		{`{"unmatched_policy": "loud"}`, unmatchedSkip},
+		{`{"default_client_id": "1111111111111111111", "unmatched_policy": "default"}`, unmatchedDefault},
+		// generic uses the built-in shared app
+		{`{"unmatched_policy": "generic"}`, unmatchedGeneric},
+	}
+	for _, tt := range tests {
+		defaultClientID = ""
+		writeTestFile(t, path, tt.config)
+		loadConfig(path)
+		if unmatchedPolicy != tt.want {
+			t.Errorf("config %s: unmatched_policy = %q, want %q", tt.config, unmatchedPolicy, tt.want)
+		}
+	}
+
+	// default needs a default app
+	defaultClientID = ""
+	writeTestFile(t, path, `{"unmatched_policy": "default"}`)
+	loadConfig(path)
+	if unmatchedPolicy != unmatchedSkip {
+		t.Errorf("default without default_client_id = %q, want skip", unmatchedPolicy)
+	}
+}
+
+func TestSetActivityUnmatchedPolicy(t *testing.T) {
+	defaultClientID = "1111111111111111111"
+	defer func() {
+		defaultClientID = ""
+		unmatchedPolicy = unmatchedSkip
+	}()
+	game := DetectedGame{Name: "Obscure Game"}
+
+	unmatchedPolicy = unmatchedDefault
+	_, match := resolveClientID(game.Name)
+	game.Generic = presentsGeneric(match)
+	if activity, raw := sentActivity(t, game); activity.Details != "Playing a game" {
+		t.Errorf("unmatched_policy default activity = %s, want neutral details", raw)
+	}
+	genericDetailsTemplate = "Playing something on {os}"
+	defer func() { genericDetailsTemplate = "Playing a game" }()
+	if activity, raw := sentActivity(t, game); activity.Details != "Playing something on Linux" {
+		t.Errorf("generic_details_template activity = %s, want it rendered", raw)
+	}
+	genericDetailsTemplate = ""
+	if activity, raw := sentActivity(t, game); activity.Details != "Playing Obscure Game" {
+		t.Errorf("empty generic_details_template activity = %s, want details_template", raw)
+	}
+	genericDetailsTemplate = "Playing a game"
+
+	unmatchedPolicy = unmatchedGeneric
+	id, match := resolveClientID(game.Name)
+	game.Generic = presentsGeneric(match)
+	if activity, raw := sentActivity(t, game); id != genericClientID || match != matchGeneric || activity.Details != "Playing Obscure Game" {
+		t.Errorf("unmatched_policy generic activity = %s (%s %s), want the game's name through the shared app", raw, id, match)
+	}
+}
+
+func TestLoadConfigNameListFiles(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.json")
+	writeTestFile(t, path, `{"ignored_games": ["Inline Game"], "ignore_file": "ignored.txt", "allow_file": "missing.txt"}`)
+	writeTestFile(t, filepath.Join(dir, "ignored.txt"), "# tools, not games\n\nSome Tool\n  Other Game  \n#Commented Out\n")
+	defer resetConfigCollections()
+
+	loadConfig(path)
+	for _, name := range []string{"Inline Game", "Some Tool", "Other Game"} {
+		if !ignoredGames[normalizeGameName(name)] {
+			t.Errorf("%q not ignored: %v", name, ignoredGames)
+		}
+	}
+	if ignoredGames[normalizeGameName("Commented Out")] || ignoredGames[""] {
+		t.Errorf("comment or blank line loaded as a name: %v", ignoredGames)
+	}
+	if len(ignoredGames) != 3 {
+		t.Errorf("ignoredGames = %v, want 3 entries", ignoredGames)
+	}
+	if len(allowedGames) != 0 {
+		t.Errorf("missing allow_file added entries: %v", allowedGames)
+	}
+}
+
+func TestIsServerExecutable(t *testing.T) {
+	serverExecutables[normalizeGameName("Valheim")] = map[string]bool{"valheim_server.x86_64": true, "valheimserver.exe": true}
+	defer delete(serverExecutables, normalizeGameName("Valheim"))
+
+	tests := []struct {
+		game, path string
+		want       bool
+	}{
+		{"Valheim", "/steamapps/common/Valheim/valheim_server.x86_64", true},
+		{"Valheim", "/steamapps/common/Valheim/valheim.x86_64", false},
+		{"Valheim", `Z:\steamapps\common\Valheim\ValheimServer.exe"`, true},
+		{"Valheim", "", false},
+		{"Balatro", "/steamapps/common/Balatro/valheim_server.x86_64", false},
+	}
+	for _, tt := range tests {
+		if got := isServerExecutable(tt.game, tt.path); got != tt.want {
+			t.Errorf("isServerExecutable(%q, %q) = %v, want %v", tt.game, tt.path, got, tt.want)
+		}
+	}
+
+	if got := verbFor(DetectedGame{Name: "Valheim", Server: true}); got != "Hosting" {
+		t.Errorf("verbFor(server) = %q, want Hosting", got)
+	}
+}
+
+func TestLoadGameDataCacheDisabled(t *testing.T) {
+	fetches := 0
+	serveGameList(t, func(w http.ResponseWriter, r *http.Request) {
+		fetches++
+		w.Write(testGameList(minDetectableApps))
+	})
+	disableCache = true
+	defer func() { disableCache = false }()
+
+	cacheFile := filepath.Join(t.TempDir(), "games.json")
+	for range 2 {
+		if err := loadGameData(cacheFile); err != nil {
+			t.Fatalf("loadGameData: %v", err)
+		}
+	}
+	if fetches != 2 {
+		t.Errorf("fetched %d times, want every load", fetches)
+	}
+	if _, err := os.Stat(cacheFile); !os.IsNotExist(err) {
+		t.Error("loadGameData wrote a cache with caching disabled")
+	}
+	if appCount() != minDetectableApps {
+		t.Errorf("loaded %d apps, want %d", appCount(), minDetectableApps)
+	}
+}
+
+func TestSteamDevice(t *testing.T) {
+	tests := []struct {
+		env  map[string]string
+		want string
+	}{
+		{map[string]string{"SteamDeck": "1", "SteamGamepadUI": "1"}, "Steam Deck"},
+		{map[string]string{"SteamDeck": "0", "SteamGamepadUI": "1"}, "Steam Big Picture"},
+		{map[string]string{"SteamAppId": "2379780"}, ""},
+		{nil, ""},
+	}
+	for _, tt := range tests {
+		if got := steamDevice(tt.env); got != tt.want {
+			t.Errorf("steamDevice(%v) = %q, want %q", tt.env, got, tt.want)
+		}
+	}
+
+	deck := DetectedGame{Name: "Balatro", Device: "Steam Deck"}
+	if got := renderTemplate(templatesFor(deck).State, deck, "SteamOS"); got != "On Steam Deck" {
+		t.Errorf("state on a Deck = %q, want %q", got, "On Steam Deck")
+	}
+	desktop := DetectedGame{Name: "Balatro"}
+	if got := renderTemplate(templatesFor(desktop).State, desktop, "Arch Linux"); got != "On Arch Linux" {
+		t.Errorf("state on the desktop = %q, want %q", got, "On Arch Linux")
+	}
+	stateTemplate = "Ante {os}"
+	defer func() { stateTemplate = defaultStateTemplate }()
+	if got := templatesFor(deck).State; got != "Ante {os}" {
+		t.Errorf("state on a Deck with a custom state_template = %q, want the custom template", got)
+	}
+}
+
+func TestChildPids(t *testing.T) {
+	cmd := exec.Command("sleep", "5")
+	if err := cmd.Start(); err != nil {
+		t.Skipf("can't start a child process: %v", err)
+	}
+	defer cmd.Process.Kill()
+
+	children := childPids(strconv.Itoa(os.Getpid()))
+	if !slices.Contains(children, strconv.Itoa(cmd.Process.Pid)) {
+		t.Errorf("childPids = %v, want it to include %d", children, cmd.Process.Pid)
+	}
+}
+
+func TestNonceStrategiesUnique(t *testing.T) {
+	for name, generate := range nonceStrategies {
+		seen := map[string]bool{}
+		for range 10000 {
+			nonce := generate()
+			if seen[nonce] {
+				t.Fatalf("%s strategy repeated nonce %q", name, nonce)
+			}
+			seen[nonce] = true
+		}
+	}
+
+	uuid := uuidNonce()
+	if len(uuid) != 36 || uuid[14] != '4' || !strings.ContainsRune("89ab", rune(uuid[19])) {
+		t.Errorf("uuidNonce = %q, want a version 4 UUID", uuid)
+	}
+}
+
+func TestLargeImageFor(t *testing.T) {
+	populateMap([]DetectableApp{{ID: "1209665818464358430", Name: "Balatro", Icon: "abc123"}})
+	defer populateMap(nil)
+	defer resetConfigCollections()
+
+	balatro := DetectedGame{Name: "Balatro", ClientID: "1209665818464358430"}
+	icon := "https://cdn.discordapp.com/app-icons/1209665818464358430/abc123.png?size=512"
+	if image, source := largeImageFor(balatro); image != icon || source != imageIcon {
+		t.Errorf("largeImageFor = %q from %q, want the app icon", image, source)
+	}
+	// the icon follows the client ID presented with, not the name
+	mapped := DetectedGame{Name: "BalatroFolder", ClientID: "1209665818464358430"}
+	if image, source := largeImageFor(mapped); image != icon || source != imageIcon {
+		t.Errorf("largeImageFor(manually mapped) = %q from %q, want the mapped app's icon", image, source)
+	}
+	if image, source := largeImageFor(DetectedGame{Name: "Balatro", ClientID: "1111111111111111111"}); image != "default" || source != imageDefault {
+		t.Errorf("largeImageFor(Balatro on another app) = %q from %q, want no icon", image, source)
+	}
+	if image, source := largeImageFor(DetectedGame{Name: "Unknown Game"}); image != "default" || source != imageDefault {
+		t.Errorf("largeImageFor(unmatched) = %q from %q, want the default asset", image, source)
+	}
+
+	assetOverrides[normalizeGameName("Balatro")] = ActivityAssets{LargeImage: "balatro_logo"}
+	if image, source := largeImageFor(balatro); image != "balatro_logo" || source != imageOverride {
+		t.Errorf("largeImageFor with an override = %q from %q, want the override", image, source)
+	}
+
+	imageSources = []string{imageIcon}
+	if image, _ := largeImageFor(DetectedGame{Name: "Unknown Game"}); image != "" {
+		t.Errorf("largeImageFor with only icon and no match = %q, want no image", image)
+	}
+}
+
+func TestDistroImageFor(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "os-release")
+	writeTestFile(t, path, "NAME=\"CachyOS Linux\"\nID=cachyos\nID_LIKE=\"arch\"\n")
+	ids := osReleaseIDs(path)
+	if !slices.Equal(ids, []string{"cachyos", "arch"}) {
+		t.Fatalf("osReleaseIDs = %v, want [cachyos arch]", ids)
+	}
+	if got := distroImageFor(ids); got != "arch" {
+		t.Errorf("distroImageFor(%v) = %q, want the ID_LIKE parent's arch", ids, got)
+	}
+	if got := distroImageFor([]string{"pop", "ubuntu"}); got != "pop_os" {
+		t.Errorf("distroImageFor(pop) = %q, want pop_os", got)
+	}
+	if got := distroImageFor([]string{"slackware"}); got != "linux" {
+		t.Errorf("distroImageFor(unknown) = %q, want linux", got)
+	}
+	if got := distroImageFor(nil); got != "linux" {
+		t.Errorf("distroImageFor(nil) = %q, want linux", got)
+	}
+
+	distroImages["cachyos"] = "cachy"
+	defer func() { distroImages = builtinDistroImages() }()
+	if got := distroImageFor(ids); got != "cachy" {
+		t.Errorf("distroImageFor with a distro_images entry = %q, want cachy", got)
+	}
+}
+
+func TestActivityInstanceJSON(t *testing.T) {
+	data, _ := json.Marshal(Activity{Details: "Playing Balatro"})
+	if strings.Contains(string(data), "instance") {
+		t.Errorf("activity without instance = %s, want the field omitted", data)
+	}
+	data, _ = json.Marshal(Activity{Details: "Playing Balatro", Instance: true})
+	if !strings.Contains(string(data), `"instance":true`) {
+		t.Errorf("instanced activity = %s, want \"instance\":true", data)
+	}
+}
+
+func TestParseConfigFormats(t *testing.T) {
+	jsonCfg, err := parseConfig("config.json", []byte(`{"scan_interval_seconds": 7, "ignored_games": ["A"], "manual_mappings": {"Some Game": "123"}}`))
+	if err != nil {
+		t.Fatalf("parseConfig json: %v", err)
+	}
+	tomlCfg, err := parseConfig("config.TOML", []byte("scan_interval_seconds = 7\nignored_games = [\"A\"]\n\n[manual_mappings]\n\"Some Game\" = \"123\"\n"))
+	if err != nil {
+		t.Fatalf("parseConfig toml: %v", err)
+	}
+	if !reflect.DeepEqual(jsonCfg, tomlCfg) {
+		t.Errorf("toml config = %+v, want %+v", tomlCfg, jsonCfg)
+	}
+
+	// a wrong type reads the same in both formats, apart from the format name
+	_, tomlErr := parseConfig("config.toml", []byte(`scan_interval_seconds = "seven"`))
+	_, jsonErr := parseConfig("config.json", []byte(`{"scan_interval_seconds": "seven"}`))
+	if tomlErr == nil || jsonErr == nil {
+		t.Fatalf("wrong value type should fail: toml %v, json %v", tomlErr, jsonErr)
+	}
+	if got, want := strings.TrimPrefix(tomlErr.Error(), "TOML"), strings.TrimPrefix(jsonErr.Error(), "JSON"); got != want {
+		t.Errorf("toml error %q doesn't match json error %q", tomlErr, jsonErr)
+	}
+	if _, err := parseConfig("config.toml", []byte("a = [1")); err == nil || !strings.HasPrefix(err.Error(), "TOML: line 1") {
+		t.Errorf("toml syntax error = %v, want the format and line", err)
+	}
+	if _, err := parseConfig("config.yaml", []byte("scan_interval_seconds: 7\n")); err == nil {
+		t.Error("YAML config should be rejected")
+	}
+}
+
+func TestFindConfigFile(t *testing.T) {
+	dir := t.TempDir()
+	if got := findConfigFile(dir); got != "" {
+		t.Errorf("empty dir: findConfigFile = %q", got)
+	}
+	writeTestFile(t, filepath.Join(dir, "config.toml"), "")
+	if got := findConfigFile(dir); got != filepath.Join(dir, "config.toml") {
+		t.Errorf("toml only: findConfigFile = %q", got)
+	}
+	writeTestFile(t, filepath.Join(dir, "config.json"), "{}")
+	if got := findConfigFile(dir); got != filepath.Join(dir, "config.json") {
+		t.Errorf("both: findConfigFile = %q, want config.json", got)
+	}
+}
+
+// the SET_ACTIVITY frame setActivity sends for game, decoded, and its raw args
+func sentActivity(t *testing.T, game DetectedGame) (*Activity, string) {
+	t.Helper()
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+	errc := make(chan error, 1)
+	go func() { errc <- setActivity(newIpcConn(client), game, "Linux") }()
+
+	_, payload, err := readIpcResponse(server)
+	if err != nil {
+		t.Fatalf("read SET_ACTIVITY: %v", err)
+	}
+	if err := <-errc; err != nil {
+		t.Fatalf("setActivity: %v", err)
+	}
+	var frame struct {
+		Args struct {
+			Activity *Activity `json:"activity"`
+		} `json:"args"`
+	}
+	var raw struct {
+		Args json.RawMessage `json:"args"`
+	}
+	if err := json.Unmarshal(payload, &frame); err != nil {
+		t.Fatalf("decode SET_ACTIVITY %s: %v", payload, err)
+	}
+	json.Unmarshal(payload, &raw)
+	return frame.Args.Activity, string(raw.Args)
+}
+
+func TestSetActivityElapsedTime(t *testing.T) {
+	game := DetectedGame{Name: "Balatro", Pid: os.Getpid()}
+	if activity, raw := sentActivity(t, game); activity.Timestamps != nil {
+		t.Errorf("timestamps sent with show_elapsed_time off: %s", raw)
+	}
+
+	showElapsedTime = true
+	defer func() { showElapsedTime = false }()
+	activity, raw := sentActivity(t, game)
+	if activity.Timestamps == nil || activity.Timestamps.Start == 0 || activity.Timestamps.End != 0 {
+		t.Fatalf("activity = %s, want a start timestamp only", raw)
+	}
+	if start := time.UnixMilli(activity.Timestamps.Start); time.Since(start) < 0 || time.Since(start) > time.Hour {
+		t.Errorf("start = %v, want this process's start time", start)
+	}
+}
+
+func TestSetActivityName(t *testing.T) {
+	game := DetectedGame{Name: "Balatro"}
+	activity, raw := sentActivity(t, game)
+	if strings.Contains(raw, `"name"`) || activity.Details != "Playing Balatro" {
+		t.Errorf("activity without activity_name = %s, want no name and the usual details", raw)
+	}
+
+	activityName = true
+	defer func() { activityName = false }()
+	if activity, raw := sentActivity(t, game); activity.Name != "Balatro" || !strings.HasPrefix(raw, `{"pid":0,"activity":{"name":"Balatro",`) {
+		t.Errorf("activity with activity_name = %s, want the game's name", raw)
+	}
+	if activity, raw := sentActivity(t, DetectedGame{Name: "Unknown Game", Generic: true}); activity.Name != "" {
+		t.Errorf("generic activity = %s, want the default app's name left alone", raw)
+	}
+
+	activityExtras = map[string]ActivityExtras{normalizeGameName("Balatro"): {Name: "Balatro: Jokers"}}
+	defer func() { activityExtras = map[string]ActivityExtras{} }()
+	activityName = false
+	if activity, raw := sentActivity(t, game); activity.Name != "Balatro: Jokers" {
+		t.Errorf("activity with a per-game name = %s", raw)
+	}
+}
+
+func TestSetActivityTextOverflow(t *testing.T) {
+	long := strings.Repeat("ä", maxActivityText+10)
+	gameTemplates[normalizeGameName("Balatro")] = TemplateConfig{Details: long, State: "short"}
+	defer func() { gameTemplates = map[string]TemplateConfig{} }()
+
+	activity, raw := sentActivity(t, DetectedGame{Name: "Balatro"})
+	if n := utf8.RuneCountInString(activity.Details); n != maxActivityText || !strings.HasSuffix(activity.Details, "…") {
+		t.Errorf("details is %d characters, want %d ending in an ellipsis: %s", n, maxActivityText, raw)
+	}
+	if activity.State != "short" {
+		t.Errorf("state = %q, want it untouched", activity.State)
+	}
+
+	textOverflow = "drop"
+	defer func() { textOverflow = "truncate" }()
+	if activity, raw := sentActivity(t, DetectedGame{Name: "Balatro"}); activity.Details != "" || strings.Contains(raw, "details") {
+		t.Errorf("activity = %s, want details dropped", raw)
+	}
+	if got := fitActivityText("state", strings.Repeat("x", maxActivityText)); len(got) != maxActivityText {
+		t.Errorf("text at the limit was changed to %d characters", len(got))
+	}
+}
+
+func TestSetActivityDistroSmallImage(t *testing.T) {
+	game := DetectedGame{Name: "Balatro", Platform: "Steam"}
+	if activity, raw := sentActivity(t, game); activity.Assets != nil && activity.Assets.SmallImage != "" {
+		t.Errorf("small image sent with distro_small_image off: %s", raw)
+	}
+
+	distroSmallImage, distroIDs = true, []string{"fedora"}
+	defer func() { distroSmallImage, distroIDs = false, nil }()
+	activity, raw := sentActivity(t, game)
+	if activity.Assets == nil || activity.Assets.SmallImage != "fedora" || activity.Assets.SmallText != "Linux" {
+		t.Errorf("activity = %s, want the fedora small image with the OS as its text", raw)
+	}
+
+	platformImages["Steam"] = "steam"
+	defer func() { platformImages = map[string]string{} }()
+	if activity, raw := sentActivity(t, game); activity.Assets == nil || activity.Assets.SmallImage != "steam" {
+		t.Errorf("activity = %s, want the platform image over the distro", raw)
+	}
+}
+
+func TestLoadConfigActivityExtras(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	writeTestFile(t, path, `{"activity_extras": {
+		"Empty": {"party": {}, "secrets": {}},
+		"Public": {"party": {"id": "lobby", "privacy": 1}},
+		"Bad Privacy": {"party": {"id": "lobby", "privacy": 7}}
+	}}`)
+	defer resetConfigCollections()
+	loadConfig(path)
+
+	if extras := activityExtras[normalizeGameName("Empty")]; extras.Party != nil || extras.Secrets != nil {
+		t.Errorf("empty party/secrets kept: %+v", extras)
+	}
+	if party := activityExtras[normalizeGameName("Public")].Party; party == nil || party.Privacy != partyPublic {
+		t.Errorf("public party = %+v", party)
+	}
+	if party := activityExtras[normalizeGameName("Bad Privacy")].Party; party == nil || party.Privacy != partyPrivate {
+		t.Errorf("invalid privacy not reset: %+v", party)
+	}
+	data, _ := json.Marshal(ActivityParty{ID: "lobby"})
+	if strings.Contains(string(data), "privacy") {
+		t.Errorf("private party = %s, want privacy omitted", data)
+	}
+}
+
+func TestSetActivityClearSendsNull(t *testing.T) {
+	activity, raw := sentActivity(t, DetectedGame{})
+	if activity != nil || !strings.Contains(raw, `"activity":null`) {
+		t.Errorf("clear args = %s, want a null activity", raw)
+	}
+}
+
+func TestActivityOmitsEmptyFields(t *testing.T) {
+	data, _ := json.Marshal(Activity{Details: "Playing Balatro"})
+	if got := string(data); got != `{"details":"Playing Balatro"}` {
+		t.Errorf("activity = %s, want only details", got)
+	}
+	data, _ = json.Marshal(Activity{Assets: &ActivityAssets{LargeText: "Balatro"}})
+	if got := string(data); got != `{"assets":{"large_text":"Balatro"}}` {
+		t.Errorf("activity = %s, want only the set asset field", got)
+	}
+
+	activity, raw := sentActivity(t, DetectedGame{Name: "Balatro", Pid: os.Getpid()})
+	if activity == nil || activity.Assets == nil || activity.Assets.LargeText != "Balatro" {
+		t.Errorf("activity = %s, want assets with the game's large text", raw)
+	}
+	if strings.Contains(raw, `"small_image"`) || strings.Contains(raw, `"party"`) || strings.Contains(raw, `"timestamps"`) {
+		t.Errorf("activity = %s, want unset sub-objects omitted", raw)
+	}
+}
+
+func TestRetryGameList(t *testing.T) {
+	defer func(interval time.Duration) { gameListRetryInterval = interval }(gameListRetryInterval)
+	gameListRetryInterval = time.Millisecond
+	fetches := 0
+	serveGameList(t, func(w http.ResponseWriter, r *http.Request) {
+		if fetches++; fetches < 3 {
+			http.Error(w, "offline", http.StatusServiceUnavailable)
+			return
+		}
+		w.Write(testGameList(minDetectableApps))
+	})
+
+	ready := make(chan []DetectableApp, 1)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	go retryGameList(ctx, currentGameListSource(filepath.Join(t.TempDir(), "games.json")), ready)
+	select {
+	case apps := <-ready:
+		if len(apps) != minDetectableApps {
+			t.Errorf("got %d apps, want %d", len(apps), minDetectableApps)
+		}
+	case <-ctx.Done():
+		t.Fatal("game list never loaded")
+	}
+	if fetches != 3 {
+		t.Errorf("fetched %d times, want 3 (two failures, then success)", fetches)
+	}
+}
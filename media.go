@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// mediaApp is a media player detected by process name.
+type mediaApp struct {
+	Name     string // shown as {game} and used for client ID lookup
+	Category string // music or video, picks the activity type
+}
+
+var (
+	// exe basename -> media app. merged with media_processes from config
+	mediaProcesses = builtinMediaProcesses()
+	// categories presented when no game is running (media_presence). empty
+	// turns media detection off.
+	mediaCategories = map[string]bool{}
+	// details line for media apps; {media} is the MPRIS title
+	mediaDetailsTemplate = "{media}"
+	// logged once so a missing playerctl doesn't spam every tick
+	mediaTitleFailed = false
+)
+
+func builtinMediaProcesses() map[string]mediaApp {
+	return map[string]mediaApp{
+		"spotify":    {"Spotify", "music"},
+		"rhythmbox":  {"Rhythmbox", "music"},
+		"strawberry": {"Strawberry", "music"},
+		"elisa":      {"Elisa", "music"},
+		"clementine": {"Clementine", "music"},
+		"mpv":        {"mpv", "video"},
+		"vlc":        {"VLC", "video"},
+		"celluloid":  {"Celluloid", "video"},
+		"totem":      {"Totem", "video"},
+	}
+}
+
+// the media app a process runs, by exe basename, if its category is enabled
+func mediaAppFor(exePath string) (mediaApp, bool) {
+	app, ok := mediaProcesses[strings.ToLower(filepath.Base(exePath))]
+	if !ok || !mediaCategories[app.Category] {
+		return mediaApp{}, false
+	}
+	return app, true
+}
+
+// detect a running media app from an enabled media_presence category.
+// only used when no game is found, so games always win.
+func detectMediaApp() DetectedGame {
+	if len(mediaCategories) == 0 {
+		return DetectedGame{}
+	}
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		return DetectedGame{}
+	}
+	uid := os.Getuid()
+	for _, entry := range entries {
+		pidStr := entry.Name()
+		if !entry.IsDir() || pidStr[0] < '0' || pidStr[0] > '9' {
+			continue
+		}
+		if !scanAllUsers && !isOwnedBy(entry, uid) {
+			continue
+		}
+		exePath, err := os.Readlink(filepath.Join("/proc", pidStr, "exe"))
+		if err != nil {
+			continue
+		}
+		app, ok := mediaAppFor(exePath)
+		if !ok || isIgnoredGame(app.Name) {
+			continue
+		}
+		pid, _ := strconv.Atoi(pidStr)
+		return DetectedGame{
+			Name:     app.Name,
+			Pid:      pid,
+			Method:   "media",
+			Category: app.Category,
+			Media:    mediaTitle(filepath.Base(exePath)),
+		}
+	}
+	return DetectedGame{}
+}
+
+// what a player is playing, from MPRIS via playerctl ("Artist - Title", or
+// just the title). "" if playerctl is missing or the player isn't playing.
+func mediaTitle(player string) string {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, "playerctl", "--player="+strings.ToLower(player), "metadata", "--format", "{{artist}}\t{{title}}").Output()
+	if err != nil {
+		if _, missing := err.(*exec.Error); missing && !mediaTitleFailed {
+			slog.Warn("Can't read media titles. Is playerctl installed?", "err", err)
+			mediaTitleFailed = true
+		}
+		return ""
+	}
+	mediaTitleFailed = false
+	return formatMediaTitle(string(out))
+}
+
+// "artist\ttitle" from playerctl as "Artist - Title"
+func formatMediaTitle(out string) string {
+	artist, title, _ := strings.Cut(strings.TrimRight(out, "\r\n"), "\t")
+	artist, title = strings.TrimSpace(artist), strings.TrimSpace(title)
+	switch {
+	case title == "":
+		return ""
+	case artist == "":
+		return title
+	}
+	return artist + " - " + title
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"os"
+	"testing"
+)
+
+func TestFormatMediaTitle(t *testing.T) {
+	tests := []struct {
+		out  string
+		want string
+	}{
+		{"Daft Punk\tOne More Time\n", "Daft Punk - One More Time"},
+		{"\tSome Movie.mkv\n", "Some Movie.mkv"},
+		{"Artist\t\n", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := formatMediaTitle(tt.out); got != tt.want {
+			t.Errorf("formatMediaTitle(%q) = %q, want %q", tt.out, got, tt.want)
+		}
+	}
+}
+
+func TestMediaAppFor(t *testing.T) {
+	defer resetConfigCollections()
+	if _, ok := mediaAppFor("/usr/bin/spotify"); ok {
+		t.Error("media detected with media_presence off")
+	}
+	mediaCategories["music"] = true
+	if app, ok := mediaAppFor("/opt/spotify/Spotify"); !ok || app.Name != "Spotify" || app.Category != "music" {
+		t.Errorf("mediaAppFor(spotify) = %+v, %v", app, ok)
+	}
+	if _, ok := mediaAppFor("/usr/bin/mpv"); ok {
+		t.Error("video player detected with only music enabled")
+	}
+}
+
+func TestMediaActivity(t *testing.T) {
+	game := DetectedGame{Name: "Spotify", Pid: os.Getpid(), Method: "media", Category: "music", Media: "Daft Punk - One More Time"}
+	activity, raw := sentActivity(t, game)
+	if activity.Type != activityListening {
+		t.Errorf("activity = %s, want the listening type", raw)
+	}
+	if activity.Details != "Daft Punk - One More Time" || activity.State != "On Linux" {
+		t.Errorf("activity = %s, want the media title as details", raw)
+	}
+
+	// without a title, the usual details line is used
+	game.Media = ""
+	if activity, raw := sentActivity(t, game); activity.Details != "Listening to Spotify" {
+		t.Errorf("activity = %s, want the details template", raw)
+	}
+}
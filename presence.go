@@ -0,0 +1,159 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+)
+
+// PresenceHint is a sidecar presence file written for a game by something
+// else (a mod manager, a game script). set fields are sent as-is in place
+// of the templates and image overrides.
+type PresenceHint struct {
+	Details    string           `json:"details"`
+	State      string           `json:"state"`
+	LargeImage string           `json:"large_image"`
+	LargeText  string           `json:"large_text"`
+	SmallImage string           `json:"small_image"`
+	SmallText  string           `json:"small_text"`
+	Buttons    []ActivityButton `json:"buttons"`
+}
+
+// Discord's limits on activity buttons
+const (
+	maxActivityButtons = 2
+	maxButtonLabel     = 32
+	maxButtonURL       = 512
+)
+
+var (
+	// directory of sidecar presence files, <game>.json. "" turns them off
+	presenceDir = ""
+	// stamp of a sidecar that failed to parse, so it's only warned about
+	// again once it changes
+	badPresenceHint = ""
+)
+
+// candidate sidecar files for a game: named as detected (the Steam folder
+// name), then by its normalized name
+func presenceHintPaths(name string) []string {
+	if presenceDir == "" {
+		return nil
+	}
+	var paths []string
+	for _, base := range []string{name, normalizeGameName(name)} {
+		if base == "" || base == "." || base == ".." || strings.ContainsRune(base, '/') {
+			continue
+		}
+		path := filepath.Join(presenceDir, base+".json")
+		if len(paths) == 0 || paths[0] != path {
+			paths = append(paths, path)
+		}
+	}
+	return paths
+}
+
+// the first sidecar file that exists for a game and a stamp that changes
+// whenever it's rewritten. "" for both without one.
+func presenceHintFile(name string) (path string, stamp string) {
+	for _, path := range presenceHintPaths(name) {
+		if info, err := os.Stat(path); err == nil && info.Mode().IsRegular() {
+			return path, fmt.Sprintf("%s %d %d", path, info.ModTime().UnixNano(), info.Size())
+		}
+	}
+	return "", ""
+}
+
+// the sidecar presence for a game, if it has one that parses
+func readPresenceHint(name string) (PresenceHint, bool) {
+	path, stamp := presenceHintFile(name)
+	if path == "" {
+		return PresenceHint{}, false
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return PresenceHint{}, false
+	}
+	var hint PresenceHint
+	if err := json.Unmarshal(data, &hint); err != nil {
+		if badPresenceHint != stamp {
+			badPresenceHint = stamp
+			slog.Warn("Ignoring unreadable presence file", "game", loggedGame(name), "path", loggedPath(path), "err", err)
+		}
+		return PresenceHint{}, false
+	}
+	return hint, true
+}
+
+// overlay a sidecar's set fields onto the activity being built
+func applyPresenceHint(activity *Activity, assets *ActivityAssets, game string, hint PresenceHint) {
+	if hint.Details != "" {
+		activity.Details = hint.Details
+	}
+	if hint.State != "" {
+		activity.State = hint.State
+	}
+	if hint.LargeImage != "" {
+		assets.LargeImage = activityImage("large_image", game, hint.LargeImage)
+	}
+	if hint.LargeText != "" {
+		assets.LargeText = hint.LargeText
+	}
+	if hint.SmallImage != "" {
+		assets.SmallImage = activityImage("small_image", game, hint.SmallImage)
+	}
+	if hint.SmallText != "" {
+		assets.SmallText = hint.SmallText
+	}
+	activity.Buttons = activityButtons(hint.Buttons)
+}
+
+// buttons Discord will accept: at most two, each with a label (cut to 32
+// characters) and an http(s) URL. others are dropped.
+func activityButtons(buttons []ActivityButton) []ActivityButton {
+	var valid []ActivityButton
+	for _, button := range buttons {
+		if len(valid) == maxActivityButtons {
+			slog.Debug("Dropping activity buttons over Discord's limit", "buttons", len(buttons), "max", maxActivityButtons)
+			break
+		}
+		label := strings.TrimSpace(button.Label)
+		u, err := url.Parse(button.URL)
+		if label == "" || err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" || len(button.URL) > maxButtonURL {
+			slog.Debug("Dropping invalid activity button", "label", label, "url", button.URL)
+			continue
+		}
+		if utf8.RuneCountInString(label) > maxButtonLabel {
+			label = string([]rune(label)[:maxButtonLabel])
+		}
+		valid = append(valid, ActivityButton{Label: label, URL: button.URL})
+	}
+	return valid
+}
+
+// presenceHintWatch notices a presented game's sidecar being written,
+// created, or removed between scans
+type presenceHintWatch struct {
+	game  string
+	stamp string
+}
+
+// true if game's sidecar changed since the last call for the same game.
+// the first call for a game only records it.
+func (w *presenceHintWatch) changed(game string) bool {
+	_, stamp := presenceHintFile(game)
+	if w.game != game {
+		w.game, w.stamp = game, stamp
+		return false
+	}
+	if w.stamp == stamp {
+		return false
+	}
+	w.stamp = stamp
+	return true
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPresenceHintPaths(t *testing.T) {
+	presenceDir = "/home/tester/.config/discord-rpc-bridge/presence"
+	defer func() { presenceDir = "" }()
+
+	got := presenceHintPaths("Hollow Knight")
+	if len(got) != 2 || got[0] != filepath.Join(presenceDir, "Hollow Knight.json") || got[1] != filepath.Join(presenceDir, normalizeGameName("Hollow Knight")+".json") {
+		t.Errorf("presenceHintPaths = %v, want the detected then the normalized name", got)
+	}
+	if got := presenceHintPaths("balatro"); len(got) != 1 {
+		t.Errorf("presenceHintPaths(balatro) = %v, want one path when both names match", got)
+	}
+	if got := presenceHintPaths("../config"); len(got) != 1 || strings.Contains(got[0], "..") {
+		t.Errorf("presenceHintPaths(../config) = %v, want only the normalized name", got)
+	}
+
+	presenceDir = ""
+	if got := presenceHintPaths("Hollow Knight"); got != nil {
+		t.Errorf("presenceHintPaths without a dir = %v", got)
+	}
+}
+
+func TestSetActivityPresenceHint(t *testing.T) {
+	presenceDir = t.TempDir()
+	defer func() { presenceDir = "" }()
+	activityExtras = map[string]ActivityExtras{normalizeGameName("Balatro"): {Secrets: &ActivitySecrets{Join: "join-secret"}}}
+	defer func() { activityExtras = map[string]ActivityExtras{} }()
+	game := DetectedGame{Name: "Balatro"}
+
+	activity, raw := sentActivity(t, game)
+	if activity.Details != "Playing Balatro" || activity.Secrets == nil || activity.Buttons != nil {
+		t.Fatalf("activity without a presence file = %s", raw)
+	}
+
+	writeTestFile(t, filepath.Join(presenceDir, "Balatro.json"), `{
+		"details": "Ante 8 {game}",
+		"large_image": "Joker",
+		"buttons": [
+			{"label": "Seed", "url": "https://example.com/seed"},
+			{"label": "", "url": "https://example.com/nolabel"},
+			{"label": "Mods", "url": "ftp://example.com/mods"},
+			{"label": "A label well over thirty-two characters", "url": "https://example.com/long"},
+			{"label": "Third", "url": "https://example.com/third"}
+		]
+	}`)
+	activity, raw = sentActivity(t, game)
+	if activity.Details != "Ante 8 {game}" || activity.State == "" || activity.Assets.LargeImage != "joker" {
+		t.Errorf("activity = %s, want the file's details verbatim, the template state, and its image", raw)
+	}
+	if len(activity.Buttons) != 2 || activity.Buttons[0].Label != "Seed" || activity.Buttons[1].Label != "A label well over thirty-two cha" {
+		t.Errorf("buttons = %+v, want two valid ones with the long label cut", activity.Buttons)
+	}
+	if activity.Secrets != nil {
+		t.Errorf("activity = %s, want secrets left out with buttons", raw)
+	}
+
+	writeTestFile(t, filepath.Join(presenceDir, "Balatro.json"), `{"details": `)
+	if activity, raw := sentActivity(t, game); activity.Details != "Playing Balatro" {
+		t.Errorf("activity with a broken presence file = %s, want the templates", raw)
+	}
+}
+
+func TestPresenceHintWatch(t *testing.T) {
+	presenceDir = t.TempDir()
+	defer func() { presenceDir = "" }()
+	path := filepath.Join(presenceDir, "Balatro.json")
+
+	var w presenceHintWatch
+	if w.changed("Balatro") {
+		t.Error("first look at a game reported a change")
+	}
+	writeTestFile(t, path, `{"details": "Ante 1"}`)
+	if !w.changed("Balatro") {
+		t.Error("creating the file wasn't noticed")
+	}
+	if w.changed("Balatro") {
+		t.Error("an unchanged file reported a change")
+	}
+	writeTestFile(t, path, `{"details": "Ante 12"}`)
+	if !w.changed("Balatro") {
+		t.Error("rewriting the file wasn't noticed")
+	}
+	later := time.Now().Add(time.Minute)
+	os.Chtimes(path, later, later)
+	if !w.changed("Balatro") {
+		t.Error("touching the file wasn't noticed")
+	}
+	if w.changed("Hades") {
+		t.Error("switching games reported a change")
+	}
+	// back on Balatro after Hades: recorded fresh, not a change
+	os.Remove(path)
+	if w.changed("Balatro") {
+		t.Error("returning to a game reported a change")
+	}
+	writeTestFile(t, path, `{"details": "Ante 2"}`)
+	if !w.changed("Balatro") {
+		t.Error("creating the file again wasn't noticed")
+	}
+	os.Remove(path)
+	if !w.changed("Balatro") {
+		t.Error("removing the file wasn't noticed")
+	}
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"sync"
+)
+
+// RecordedFrame is one frame the bridge sent, as written by -record-frames
+type RecordedFrame struct {
+	Opcode  int             `json:"opcode"`
+	Payload json.RawMessage `json:"payload"`
+}
+
+// frameRecorder writes every frame sent on the bridge's own connections to
+// w, one compact JSON RecordedFrame per line, so the bridge's output can be
+// compared against golden files across refactors. only set for the hidden
+// -record-frames flag.
+type frameRecorder struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// recorder for connections dialed from here on. nil records nothing
+var recordFrames *frameRecorder
+
+func newFrameRecorder(w io.Writer) *frameRecorder {
+	return &frameRecorder{w: w}
+}
+
+// append one sent frame. a payload that isn't JSON is kept as a JSON
+// string so every line still parses.
+func (r *frameRecorder) record(opcode int, payload []byte) {
+	var compact bytes.Buffer
+	if json.Compact(&compact, payload) != nil {
+		compact.Reset()
+		raw, _ := json.Marshal(string(payload))
+		compact.Write(raw)
+	}
+	line, _ := json.Marshal(RecordedFrame{Opcode: opcode, Payload: compact.Bytes()})
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.w.Write(append(line, '\n'))
+}
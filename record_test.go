@@ -0,0 +1,199 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+var updateGolden = flag.Bool("update", false, "rewrite golden files in testdata")
+
+// parse a -record-frames file back into frames
+func readRecordedFrames(t *testing.T, data []byte) []RecordedFrame {
+	t.Helper()
+	var frames []RecordedFrame
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		var frame RecordedFrame
+		if err := json.Unmarshal(scanner.Bytes(), &frame); err != nil {
+			t.Fatalf("recorded frame %q: %v", scanner.Text(), err)
+		}
+		frames = append(frames, frame)
+	}
+	return frames
+}
+
+// a command the fake Discord from presenceDiscord received
+type receivedCommand struct {
+	Cmd   string `json:"cmd"`
+	Nonce string `json:"nonce"`
+	Args  struct {
+		Activity json.RawMessage `json:"activity"`
+	} `json:"args"`
+}
+
+// a fake Discord for one presence session: READY after the handshake and a
+// reply to every command until the client closes. the commands it gets are
+// appended to got, which is safe to read once done has sent.
+func presenceDiscord(t *testing.T, got *[]receivedCommand) (path string, done <-chan error) {
+	t.Helper()
+	return fakeDiscord(t, func(conn *IpcConn) error {
+		if _, err := expectFrame(conn, opHandshake, nil); err != nil {
+			return fmt.Errorf("handshake: %w", err)
+		}
+		sendIPCPacket(conn, opFrame, []byte(`{"cmd":"DISPATCH","evt":"READY","data":{"v":1}}`))
+		for {
+			opcode, payload, err := readIpcResponse(conn)
+			if err != nil {
+				return err
+			}
+			if opcode == opClose {
+				return nil
+			}
+			var cmd receivedCommand
+			if opcode != opFrame || json.Unmarshal(payload, &cmd) != nil {
+				return fmt.Errorf("frame %d %s, want a command or a close", opcode, payload)
+			}
+			*got = append(*got, cmd)
+			sendIPCPacket(conn, opFrame, fmt.Appendf(nil, `{"cmd":%q,"nonce":%q,"data":{}}`, cmd.Cmd, cmd.Nonce))
+		}
+	})
+}
+
+// play recorded frames to a fake Discord at path as the bridge sent them,
+// reading Discord's answer to each handshake and command. returns the
+// answers in order.
+func replayFrames(t *testing.T, path string, frames []RecordedFrame) []RecordedFrame {
+	t.Helper()
+	raw, err := net.Dial("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer raw.Close()
+	conn := newIpcConn(raw)
+	var replies []RecordedFrame
+	for _, frame := range frames {
+		payload := []byte(frame.Payload)
+		var text string
+		if json.Unmarshal(frame.Payload, &text) == nil {
+			payload = []byte(text)
+		}
+		if err := sendIPCPacket(conn, frame.Opcode, payload); err != nil {
+			t.Fatalf("replay opcode %d: %v", frame.Opcode, err)
+		}
+		if frame.Opcode == opClose {
+			break
+		}
+		opcode, reply, err := readIpcResponse(conn)
+		if err != nil {
+			t.Fatalf("reply to opcode %d: %v", frame.Opcode, err)
+		}
+		replies = append(replies, RecordedFrame{Opcode: int(opcode), Payload: reply})
+	}
+	return replies
+}
+
+func TestFrameRecorder(t *testing.T) {
+	var out bytes.Buffer
+	r := newFrameRecorder(&out)
+	r.record(opHandshake, []byte("{\n  \"v\": 1,\n  \"client_id\": \"42\"\n}"))
+	r.record(opClose, []byte("not json"))
+	want := `{"opcode":0,"payload":{"v":1,"client_id":"42"}}` + "\n" + `{"opcode":2,"payload":"not json"}` + "\n"
+	if out.String() != want {
+		t.Errorf("recorded = %q, want %q", out.String(), want)
+	}
+
+	// a handshake and a close frame that isn't JSON still replay
+	var got []receivedCommand
+	path, done := presenceDiscord(t, &got)
+	replies := replayFrames(t, path, readRecordedFrames(t, out.Bytes()))
+	if err := <-done; err != nil {
+		t.Fatalf("fake Discord: %v", err)
+	}
+	if len(replies) != 1 || !bytes.Contains(replies[0].Payload, []byte(`"READY"`)) || len(got) != 0 {
+		t.Errorf("replies = %+v, commands = %+v, want only READY", replies, got)
+	}
+}
+
+// a -test-presence session against a fake Discord, recorded and compared
+// with testdata/test-presence.golden. run with -update to rewrite it after
+// an intended change to what's sent.
+func TestRecordFramesGolden(t *testing.T) {
+	defer func(hold time.Duration) { testPresenceHold = hold }(testPresenceHold)
+	testPresenceHold = time.Millisecond
+	defer func(path string) { socketPathOverride = path }(socketPathOverride)
+	populateMap([]DetectableApp{{ID: "1209665818464358430", Name: "Balatro"}})
+	defer populateMap(nil)
+	nonceCounter.Store(0)
+
+	var out bytes.Buffer
+	recordFrames = newFrameRecorder(&out)
+	defer func() { recordFrames = nil }()
+
+	var sent []receivedCommand
+	path, done := presenceDiscord(t, &sent)
+	socketPathOverride = path
+	if err := runTestPresence("Balatro", "Linux"); err != nil {
+		t.Fatalf("runTestPresence: %v", err)
+	}
+	if err := <-done; err != nil {
+		t.Fatalf("fake Discord: %v", err)
+	}
+
+	// the only per-run value sent is this process's pid
+	recorded := bytes.ReplaceAll(out.Bytes(), []byte(`"pid":`+strconv.Itoa(os.Getpid())), []byte(`"pid":0`))
+	golden := filepath.Join("testdata", "test-presence.golden")
+	if *updateGolden {
+		if err := os.WriteFile(golden, recorded, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatalf("%v (run with -update to create it)", err)
+	}
+	if !bytes.Equal(recorded, want) {
+		t.Errorf("recorded frames differ from %s:\ngot:\n%s\nwant:\n%s", golden, recorded, want)
+	}
+
+	// the golden session replayed against a fresh fake Discord gets an
+	// answer to every frame and leaves it with the same commands
+	var replayed []receivedCommand
+	path, done = presenceDiscord(t, &replayed)
+	frames := readRecordedFrames(t, want)
+	replies := replayFrames(t, path, frames)
+	if err := <-done; err != nil {
+		t.Fatalf("fake Discord on replay: %v", err)
+	}
+	if len(replayed) != 2 || len(sent) != len(replayed) {
+		t.Fatalf("replayed commands = %+v, want the recorded %+v", replayed, sent)
+	}
+	if len(replies) != len(frames)-1 || !bytes.Contains(replies[0].Payload, []byte(`"READY"`)) {
+		t.Fatalf("replies = %+v, want READY and one per command", replies)
+	}
+	for i, reply := range replies[1:] {
+		var answer struct {
+			Cmd   string `json:"cmd"`
+			Nonce string `json:"nonce"`
+		}
+		if json.Unmarshal(reply.Payload, &answer) != nil || answer.Cmd != replayed[i].Cmd || answer.Nonce != replayed[i].Nonce {
+			t.Errorf("reply %d = %s, want one to %s nonce %s", i, reply.Payload, replayed[i].Cmd, replayed[i].Nonce)
+		}
+	}
+	for i := range replayed {
+		if replayed[i].Cmd != sent[i].Cmd || replayed[i].Nonce != sent[i].Nonce || !bytes.Equal(replayed[i].Args.Activity, sent[i].Args.Activity) {
+			t.Errorf("replayed command %d = %+v, want %+v", i, replayed[i], sent[i])
+		}
+	}
+	if !bytes.Contains(replayed[0].Args.Activity, []byte(`"details":"Playing Balatro"`)) || string(replayed[1].Args.Activity) != "null" {
+		t.Errorf("replayed activities %s then %s, want Balatro set then cleared", replayed[0].Args.Activity, replayed[1].Args.Activity)
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// presenceState is the last presented game, saved so a restarted bridge can
+// re-present it without waiting for a scan.
+type presenceState struct {
+	Game       string `json:"game"`
+	Pid        int    `json:"pid"`
+	StartTicks uint64 `json:"start_ticks"` // process start time, to detect PID reuse
+	Platform   string `json:"platform,omitempty"`
+	AppID      string `json:"app_id,omitempty"`
+	ListedID   string `json:"listed_id,omitempty"`
+	ROM        string `json:"rom,omitempty"`
+	System     string `json:"system,omitempty"`
+	Display    string `json:"display_name,omitempty"`
+	Server     bool   `json:"server,omitempty"`
+	Device     string `json:"device,omitempty"`
+	Category   string `json:"category,omitempty"`
+}
+
+// snapshot a detected game along with its process start time
+func newPresenceState(game DetectedGame) (presenceState, error) {
+	ticks, err := pidStartTicks(game.Pid)
+	if err != nil {
+		return presenceState{}, err
+	}
+	return presenceState{
+		Game:       game.Name,
+		Pid:        game.Pid,
+		StartTicks: ticks,
+		Platform:   game.Platform,
+		AppID:      game.AppID,
+		ListedID:   game.ListedID,
+		ROM:        game.ROM,
+		System:     game.System,
+		Display:    game.DisplayName,
+		Server:     game.Server,
+		Device:     game.Device,
+		Category:   game.Category,
+	}, nil
+}
+
+// the game to present from a saved state
+func (s presenceState) detectedGame() DetectedGame {
+	return DetectedGame{
+		Name:        s.Game,
+		Pid:         s.Pid,
+		Platform:    s.Platform,
+		AppID:       s.AppID,
+		ListedID:    s.ListedID,
+		ROM:         s.ROM,
+		System:      s.System,
+		DisplayName: s.Display,
+		Server:      s.Server,
+		Device:      s.Device,
+		Category:    s.Category,
+		Method:      "state",
+	}
+}
+
+// true if the saved PID is still running and is the same process (not a
+// reused PID), by comparing start times
+func (s presenceState) alive() bool {
+	if s.Game == "" || s.Pid <= 0 {
+		return false
+	}
+	ticks, err := pidStartTicks(s.Pid)
+	return err == nil && ticks == s.StartTicks
+}
+
+// true if the saved game would still be presented by a scan: config
+// reloaded since it was saved may have ignored it, left it off the allowlist,
+// or started ignoring servers
+func (s presenceState) allowed() bool {
+	return !isIgnoredGame(s.Game) && !(s.Server && ignoreServers)
+}
+
+// start time of a running process, in clock ticks since boot
+func pidStartTicks(pid int) (uint64, error) {
+	stat, err := os.ReadFile(filepath.Join("/proc", strconv.Itoa(pid), "stat"))
+	if err != nil {
+		return 0, err
+	}
+	return parseStartTicks(stat)
+}
+
+func loadState(path string) (presenceState, error) {
+	var state presenceState
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return state, err
+	}
+	err = json.Unmarshal(data, &state)
+	return state, err
+}
+
+// write the state via a temp file and rename, so a crash mid-write can't
+// leave a truncated file behind
+func saveState(path string, state presenceState) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// remove the saved state. a missing file is not an error.
+func clearState(path string) error {
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPresenceStateRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+
+	state, err := newPresenceState(DetectedGame{Name: "Balatro", Pid: os.Getpid(), Platform: "Steam", AppID: "2379780"})
+	if err != nil {
+		t.Fatalf("newPresenceState: %v", err)
+	}
+	if err := saveState(path, state); err != nil {
+		t.Fatalf("saveState: %v", err)
+	}
+	loaded, err := loadState(path)
+	if err != nil {
+		t.Fatalf("loadState: %v", err)
+	}
+	if loaded != state {
+		t.Errorf("loadState = %+v, want %+v", loaded, state)
+	}
+	if !loaded.alive() {
+		t.Error("state for the running test process should be alive")
+	}
+	if got := loaded.detectedGame(); got.Name != "Balatro" || got.AppID != "2379780" {
+		t.Errorf("detectedGame = %+v", got)
+	}
+
+	// same PID with a different start time is a reused PID
+	loaded.StartTicks++
+	if loaded.alive() {
+		t.Error("state with a mismatched start time should not be alive")
+	}
+
+	if !loaded.allowed() {
+		t.Error("state for a game that isn't ignored should be allowed")
+	}
+	ignoredGames[normalizeGameName("Balatro")] = true
+	if loaded.allowed() {
+		t.Error("state for an ignored game should not be allowed")
+	}
+	delete(ignoredGames, normalizeGameName("Balatro"))
+	allowedGames[normalizeGameName("Hades")] = true
+	if loaded.allowed() {
+		t.Error("state for a game off the allowlist should not be allowed")
+	}
+	delete(allowedGames, normalizeGameName("Hades"))
+	loaded.Server, ignoreServers = true, true
+	if loaded.allowed() {
+		t.Error("state for a server with ignore_servers should not be allowed")
+	}
+	loaded.Server, ignoreServers = false, false
+
+	if err := clearState(path); err != nil {
+		t.Fatalf("clearState: %v", err)
+	}
+	if _, err := loadState(path); !os.IsNotExist(err) {
+		t.Errorf("loadState after clear: err = %v, want not exist", err)
+	}
+	if err := clearState(path); err != nil {
+		t.Errorf("clearState on a missing file: %v", err)
+	}
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// StatusReport is the JSON served by the status endpoint.
+type StatusReport struct {
+	Version   string            `json:"version"`
+	Connected bool              `json:"connected"`
+	Game      string            `json:"game,omitempty"`
+	Pid       int               `json:"pid,omitempty"`
+	Platform  string            `json:"platform,omitempty"`
+	Method    string            `json:"method,omitempty"` // how the game was detected
+	ClientID  string            `json:"client_id,omitempty"`
+	Match     *MatchExplanation `json:"match,omitempty"` // how the client ID was resolved
+	Since     time.Time         `json:"since"`           // last state change
+	Wedges    int               `json:"wedges"`          // watchdog wedge events since startup
+	// client IDs not connected with after repeated handshake rejections
+	Blacklisted []BlacklistedClient `json:"blacklisted,omitempty"`
+}
+
+// BlacklistedClient is a client ID Discord kept rejecting.
+type BlacklistedClient struct {
+	ClientID string    `json:"client_id"`
+	Failures int       `json:"failures"` // consecutive rejected handshakes
+	Until    time.Time `json:"until"`    // when it's tried again
+}
+
+// MatchExplanation describes how a detected name was resolved to a client ID.
+type MatchExplanation struct {
+	RawName        string    `json:"raw_name"`        // name as detected (ex: Steam folder name)
+	NormalizedName string    `json:"normalized_name"` // what's looked up in the game list
+	Kind           matchKind `json:"kind"`
+	Override       bool      `json:"override"` // a manual_mappings entry applied
+	ClientID       string    `json:"client_id"`
+	AppName        string    `json:"app_name,omitempty"` // Discord app name, if it's in the game list
+}
+
+// explain how name resolved to clientID
+func explainMatch(name string, clientID string, kind matchKind) *MatchExplanation {
+	explanation := &MatchExplanation{
+		RawName:        name,
+		NormalizedName: normalizeGameName(name),
+		Kind:           kind,
+		Override:       kind == matchManual,
+		ClientID:       clientID,
+	}
+	if app, ok := appByID(clientID); ok {
+		explanation.AppName = app.Name
+	}
+	return explanation
+}
+
+// statusTracker holds the latest presence state for the status endpoint.
+// the scan loop updates it; HTTP handlers read snapshots.
+type statusTracker struct {
+	mu        sync.Mutex
+	report    StatusReport
+	blacklist []BlacklistedClient // kept apart from report, which is replaced on every change
+	wd        *watchdog
+}
+
+func newStatusTracker(wd *watchdog) *statusTracker {
+	return &statusTracker{
+		report: StatusReport{Version: version, Since: time.Now()},
+		wd:     wd,
+	}
+}
+
+// record the game being presented and how it was matched
+func (t *statusTracker) connected(game DetectedGame, clientID string, match matchKind) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.report = StatusReport{
+		Version:   version,
+		Connected: true,
+		Game:      game.Name,
+		Pid:       game.Pid,
+		Platform:  game.Platform,
+		Method:    game.Method,
+		ClientID:  clientID,
+		Match:     explainMatch(game.Name, clientID, match),
+		Since:     time.Now(),
+	}
+}
+
+// record that nothing is presented
+func (t *statusTracker) disconnected() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.report = StatusReport{Version: version, Since: time.Now()}
+}
+
+// record the blacklisted client IDs
+func (t *statusTracker) blacklisted(entries []BlacklistedClient) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.blacklist = entries
+}
+
+func (t *statusTracker) snapshot() StatusReport {
+	t.mu.Lock()
+	report := t.report
+	now := time.Now()
+	for _, entry := range t.blacklist {
+		if now.Before(entry.Until) {
+			report.Blacklisted = append(report.Blacklisted, entry)
+		}
+	}
+	t.mu.Unlock()
+	if t.wd != nil {
+		report.Wedges = t.wd.wedgeCount()
+	}
+	return report
+}
+
+func (t *statusTracker) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(t.snapshot())
+}
+
+// serve the status report at /status on addr in the background
+func serveStatus(addr string, t *statusTracker) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/status", t)
+	srv := &http.Server{Handler: mux, ReadHeaderTimeout: 5 * time.Second}
+	go func() {
+		if err := srv.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Warn("Status endpoint stopped", "err", err)
+		}
+	}()
+	return nil
+}
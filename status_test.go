@@ -0,0 +1,84 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStatusTracker(t *testing.T) {
+	wd := newWatchdog()
+	tracker := newStatusTracker(wd)
+	populateMap([]DetectableApp{{ID: "1209665818464358430", Name: "Balatro"}})
+	defer populateMap(nil)
+
+	tracker.connected(DetectedGame{Name: "Balatro", Pid: 42, Platform: "Steam", Method: "exe"}, "1209665818464358430", matchExact)
+
+	rec := httptest.NewRecorder()
+	tracker.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/status", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status code = %d, want 200", rec.Code)
+	}
+	var report StatusReport
+	if err := json.Unmarshal(rec.Body.Bytes(), &report); err != nil {
+		t.Fatalf("decode status: %v", err)
+	}
+	if !report.Connected || report.Game != "Balatro" || report.Method != "exe" || report.ClientID != "1209665818464358430" {
+		t.Errorf("status = %+v, want connected Balatro via exe", report)
+	}
+	want := MatchExplanation{
+		RawName:        "Balatro",
+		NormalizedName: "balatro",
+		Kind:           matchExact,
+		ClientID:       "1209665818464358430",
+		AppName:        "Balatro",
+	}
+	if report.Match == nil || *report.Match != want {
+		t.Errorf("match = %+v, want %+v", report.Match, want)
+	}
+
+	tracker.disconnected()
+	if report := tracker.snapshot(); report.Connected || report.Game != "" || report.Match != nil {
+		t.Errorf("status after disconnect = %+v, want nothing presented", report)
+	}
+
+	rec = httptest.NewRecorder()
+	tracker.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/status", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("POST status code = %d, want 405", rec.Code)
+	}
+}
+
+func TestStatusBlacklisted(t *testing.T) {
+	tracker := newStatusTracker(nil)
+	now := time.Now()
+	tracker.blacklisted([]BlacklistedClient{
+		{ClientID: "111", Failures: 3, Until: now.Add(time.Hour)},
+		{ClientID: "222", Failures: 3, Until: now.Add(-time.Second)},
+	})
+	tracker.connected(DetectedGame{Name: "Balatro"}, "333", matchExact)
+
+	report := tracker.snapshot()
+	if len(report.Blacklisted) != 1 || report.Blacklisted[0].ClientID != "111" {
+		t.Errorf("blacklisted = %+v, want only the unexpired 111", report.Blacklisted)
+	}
+	tracker.blacklisted(nil)
+	data, _ := json.Marshal(tracker.snapshot())
+	if strings.Contains(string(data), "blacklisted") {
+		t.Errorf("status = %s, want no blacklisted field when empty", data)
+	}
+}
+
+func TestExplainMatchOverride(t *testing.T) {
+	manualMappings["YakuzaKiwami3"] = "1234"
+	defer delete(manualMappings, "YakuzaKiwami3")
+
+	id, kind := resolveClientID("YakuzaKiwami3")
+	got := explainMatch("YakuzaKiwami3", id, kind)
+	if !got.Override || got.Kind != matchManual || got.ClientID != "1234" || got.AppName != "" {
+		t.Errorf("explainMatch = %+v, want a manual override to 1234 with no app name", got)
+	}
+}
@@ -0,0 +1,436 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// SteamApp is an installed game read from a library's appmanifest.
+type SteamApp struct {
+	AppID      string
+	Name       string // store name
+	InstallDir string // steamapps/common folder name, what detection sees
+	Library    string
+	LastPlayed time.Time // zero if never played
+	SizeOnDisk int64     // bytes
+}
+
+// Steam client roots for native and Flatpak installs. symlinked roots
+// (~/.steam/steam -> ~/.local/share/Steam) are only listed once.
+func steamRoots() []string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return nil
+	}
+	candidates := []string{
+		filepath.Join(home, ".steam", "steam"),
+		filepath.Join(home, ".steam", "root"),
+		filepath.Join(home, ".local", "share", "Steam"),
+		filepath.Join(home, ".var", "app", "com.valvesoftware.Steam", ".local", "share", "Steam"),
+	}
+	seen := map[string]bool{}
+	var roots []string
+	for _, dir := range candidates {
+		resolved, err := filepath.EvalSymlinks(dir)
+		if err != nil || seen[resolved] {
+			continue
+		}
+		seen[resolved] = true
+		roots = append(roots, resolved)
+	}
+	return roots
+}
+
+// library folders listed in a Steam root's libraryfolders.vdf. the root
+// itself is always included, since it's a library even without the file.
+func steamLibraries(root string) []string {
+	libraries := []string{root}
+	data, err := os.ReadFile(filepath.Join(root, "steamapps", "libraryfolders.vdf"))
+	if err != nil {
+		return libraries
+	}
+	vdf, err := parseVDF(string(data))
+	if err != nil {
+		slog.Warn("Failed to parse Steam library folders", "root", root, "err", err)
+		return libraries
+	}
+	folders := vdf.obj("libraryfolders")
+	keys := make([]string, 0, len(folders))
+	for key := range folders {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		// entries are numbered blocks; older files used bare "N" "path" pairs
+		path := folders.obj(key).str("path")
+		if path == "" {
+			path = folders.str(key)
+		}
+		if path != "" && filepath.IsAbs(path) && filepath.Clean(path) != filepath.Clean(root) {
+			libraries = append(libraries, path)
+		}
+	}
+	return libraries
+}
+
+// read every appmanifest_*.acf in a library's steamapps folder
+func steamLibraryApps(library string) []SteamApp {
+	manifests, _ := filepath.Glob(filepath.Join(library, "steamapps", "appmanifest_*.acf"))
+	var apps []SteamApp
+	for _, path := range manifests {
+		app, err := readAppManifest(path)
+		if err != nil {
+			slog.Debug("Skipping unreadable appmanifest", "path", path, "err", err)
+			continue
+		}
+		app.Library = library
+		apps = append(apps, app)
+	}
+	return apps
+}
+
+// parse an appmanifest_<appid>.acf file
+func readAppManifest(path string) (SteamApp, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return SteamApp{}, err
+	}
+	vdf, err := parseVDF(string(data))
+	if err != nil {
+		return SteamApp{}, err
+	}
+	state := vdf.obj("AppState")
+	if state == nil {
+		return SteamApp{}, fmt.Errorf("no AppState block")
+	}
+	app := SteamApp{
+		AppID:      state.str("appid"),
+		Name:       state.str("name"),
+		InstallDir: state.str("installdir"),
+	}
+	if played, err := strconv.ParseInt(state.str("LastPlayed"), 10, 64); err == nil && played > 0 {
+		app.LastPlayed = time.Unix(played, 0)
+	}
+	app.SizeOnDisk, _ = strconv.ParseInt(state.str("SizeOnDisk"), 10, 64)
+	if app.InstallDir == "" {
+		return SteamApp{}, fmt.Errorf("no installdir")
+	}
+	return app, nil
+}
+
+// every installed Steam app across all roots and libraries, deduplicated by
+// appid and sorted by name
+func installedSteamApps() []SteamApp {
+	seen := map[string]bool{}
+	var apps []SteamApp
+	for _, root := range steamRoots() {
+		for _, library := range steamLibraries(root) {
+			for _, app := range steamLibraryApps(library) {
+				if seen[app.AppID] {
+					continue
+				}
+				seen[app.AppID] = true
+				apps = append(apps, app)
+			}
+		}
+	}
+	sort.Slice(apps, func(i, j int) bool { return apps[i].Name < apps[j].Name })
+	return apps
+}
+
+// Steam's registry.vdf for native and Flatpak installs. Steam keeps the
+// running game's appid in it while the client is up.
+func steamRegistryPaths() []string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return nil
+	}
+	return []string{
+		filepath.Join(home, ".steam", "registry.vdf"),
+		filepath.Join(home, ".var", "app", "com.valvesoftware.Steam", ".steam", "registry.vdf"),
+	}
+}
+
+// RunningAppID from a registry.vdf, or "" when no game is running
+func readRunningAppID(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	vdf, err := parseVDF(string(data))
+	if err != nil {
+		return "", err
+	}
+	appID := vdf.obj("Registry").obj("HKCU").obj("Software").obj("Valve").obj("Steam").str("RunningAppID")
+	if appID == "0" {
+		return "", nil
+	}
+	return appID, nil
+}
+
+// the appmanifest for appID in a Steam library
+func steamManifestPath(library string, appID string) string {
+	return filepath.Join(library, "steamapps", "appmanifest_"+appID+".acf")
+}
+
+// the installed app with appID, searching every root's libraries
+func findSteamApp(roots []string, appID string) (SteamApp, bool) {
+	for _, root := range roots {
+		for _, library := range steamLibraries(root) {
+			app, err := readAppManifest(steamManifestPath(library, appID))
+			if err == nil {
+				app.Library = library
+				return app, true
+			}
+		}
+	}
+	return SteamApp{}, false
+}
+
+// game with LastPlayed and InstallSize filled from its Steam appmanifest,
+// for {last_played} and {install_size}. unchanged for non-Steam games.
+func withSteamManifest(game DetectedGame) DetectedGame {
+	if game.AppID == "" || !game.LastPlayed.IsZero() || game.InstallSize > 0 {
+		return game
+	}
+	if app, ok := findSteamApp(steamRoots(), game.AppID); ok {
+		game.LastPlayed, game.InstallSize = app.LastPlayed, app.SizeOnDisk
+	}
+	return game
+}
+
+// detect the game Steam reports as running in registry.vdf. the game is
+// named by its install folder, like process detection, and tied to a
+// process launched with its SteamAppId. a RunningAppID with no such process
+// (ex: left behind by a Steam crash) counts as nothing running.
+func detectSteamRunningGame() DetectedGame {
+	for _, path := range steamRegistryPaths() {
+		appID, err := readRunningAppID(path)
+		if err != nil || appID == "" {
+			continue
+		}
+		app, ok := findSteamApp(steamRoots(), appID)
+		if !ok || isIgnoredGame(app.InstallDir) {
+			continue
+		}
+		pid := cachedPidForSteamAppID(appID)
+		if pid == 0 {
+			slog.Debug("Steam reports a running game with no process", "appid", loggedID(appID), "game", loggedGame(app.InstallDir))
+			continue
+		}
+		server := steamProcessIsServer(app.InstallDir, strconv.Itoa(pid))
+		if server && ignoreServers {
+			continue
+		}
+		return DetectedGame{
+			Name:        app.InstallDir,
+			Pid:         pid,
+			Platform:    "Steam",
+			AppID:       appID,
+			Server:      server,
+			Device:      steamDevice(readEnviron(strconv.Itoa(pid))),
+			Method:      "registry",
+			LastPlayed:  app.LastPlayed,
+			InstallSize: app.SizeOnDisk,
+		}
+	}
+	return DetectedGame{}
+}
+
+// the process last found for a Steam appid, reused while it's still the
+// same process so registry detection doesn't walk /proc every tick
+type steamAppProcessCache struct {
+	appID      string
+	pid        int
+	startTicks uint64
+}
+
+var steamAppProcess steamAppProcessCache
+
+// pidForSteamAppID, cached while the found process keeps running
+func cachedPidForSteamAppID(appID string) int {
+	cached := steamAppProcess
+	if cached.appID == appID && cached.pid > 0 {
+		if ticks, err := pidStartTicks(cached.pid); err == nil && ticks == cached.startTicks {
+			return cached.pid
+		}
+	}
+	steamAppProcess = steamAppProcessCache{}
+	pid := pidForSteamAppID(appID)
+	if pid > 0 {
+		if ticks, err := pidStartTicks(pid); err == nil {
+			steamAppProcess = steamAppProcessCache{appID: appID, pid: pid, startTicks: ticks}
+		}
+	}
+	return pid
+}
+
+// true if a Steam game's process is one of its server_executables, by exe
+// or, for Proton and other wrappers, by argv[0]
+func steamProcessIsServer(gameName string, pidStr string) bool {
+	if exePath, err := os.Readlink(filepath.Join("/proc", pidStr, "exe")); err == nil && isServerExecutable(gameName, exePath) {
+		return true
+	}
+	data, err := os.ReadFile(filepath.Join("/proc", pidStr, "cmdline"))
+	if err != nil {
+		return false
+	}
+	argv0, _, _ := strings.Cut(string(data), "\x00")
+	return isServerExecutable(gameName, argv0)
+}
+
+// first process (by PID) launched by Steam for appID, skipping wrappers and
+// launchers and processes younger than min_process_age_seconds. 0 if none.
+func pidForSteamAppID(appID string) int {
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		return 0
+	}
+	uid := os.Getuid()
+	for _, entry := range entries {
+		pidStr := entry.Name()
+		if !entry.IsDir() || pidStr[0] < '0' || pidStr[0] > '9' {
+			continue
+		}
+		if !scanAllUsers && !isOwnedBy(entry, uid) {
+			continue
+		}
+		if exePath, err := os.Readlink(filepath.Join("/proc", pidStr, "exe")); err == nil && isIgnoredProcess(filepath.Base(exePath)) {
+			continue
+		}
+		if readSteamAppID(pidStr) != appID {
+			continue
+		}
+		if minProcessAge > 0 {
+			if age, err := processAge(pidStr); err == nil && age < minProcessAge {
+				continue
+			}
+		}
+		pid, _ := strconv.Atoi(pidStr)
+		return pid
+	}
+	return 0
+}
+
+// the Steam appid in a /proc/<pid>/cgroup listing, from the scope systemd
+// user sessions put each launched game in (ex: app-steam-app620-1234.scope).
+// "" outside a game scope. only the "app" form names an appid; other
+// app-steam-<something> units aren't games.
+func steamAppIDFromCgroup(data string) string {
+	for _, line := range strings.Split(data, "\n") {
+		parts := strings.SplitN(line, ":", 3)
+		if len(parts) != 3 {
+			continue
+		}
+		for _, unit := range strings.Split(parts[2], "/") {
+			unit, ok := strings.CutSuffix(unit, ".scope")
+			if !ok {
+				continue
+			}
+			if unit, ok = strings.CutPrefix(unit, "app-steam-app"); !ok {
+				continue
+			}
+			digits := len(unit) - len(strings.TrimLeft(unit, "0123456789"))
+			if digits == 0 || unit[:digits] == "0" {
+				continue
+			}
+			if rest := unit[digits:]; rest == "" || rest[0] == '-' || rest[0] == '@' {
+				return unit[:digits]
+			}
+		}
+	}
+	return ""
+}
+
+// the installed Steam game whose scope a process runs in
+func steamAppForCgroup(pidStr string) (SteamApp, bool) {
+	data, err := os.ReadFile(filepath.Join("/proc", pidStr, "cgroup"))
+	if err != nil {
+		return SteamApp{}, false
+	}
+	appID := steamAppIDFromCgroup(string(data))
+	if appID == "" {
+		return SteamApp{}, false
+	}
+	return cachedFindSteamApp(appID)
+}
+
+// how long an appid with no installed manifest is remembered as missing
+const steamAppMissRetry = time.Minute
+
+// a findSteamApp result for one appid
+type steamAppLookup struct {
+	app     SteamApp
+	found   bool
+	modTime time.Time // of the found manifest
+	checked time.Time // when a missing app was last searched for
+}
+
+// findSteamApp results by appid. every process in a game's scope is looked
+// up each scan, so the library search runs once per appid; a found app is
+// kept while its manifest is unchanged.
+var steamAppLookups = map[string]steamAppLookup{}
+
+// findSteamApp over steamRoots, cached in steamAppLookups
+func cachedFindSteamApp(appID string) (SteamApp, bool) {
+	if cached, ok := steamAppLookups[appID]; ok {
+		if !cached.found && time.Since(cached.checked) < steamAppMissRetry {
+			return SteamApp{}, false
+		}
+		if cached.found {
+			if info, err := os.Stat(steamManifestPath(cached.app.Library, appID)); err == nil && info.ModTime().Equal(cached.modTime) {
+				return cached.app, true
+			}
+		}
+	}
+	app, ok := findSteamApp(steamRoots(), appID)
+	lookup := steamAppLookup{app: app, found: ok, checked: time.Now()}
+	if ok {
+		if info, err := os.Stat(steamManifestPath(app.Library, appID)); err == nil {
+			lookup.modTime = info.ModTime()
+		}
+	}
+	steamAppLookups[appID] = lookup
+	return app, ok
+}
+
+// match status of an installed app as the scanner would see it
+func auditStatus(app SteamApp) (status string, clientID string) {
+	if isIgnoredGame(app.InstallDir) {
+		return "ignored", ""
+	}
+	id, match := resolveClientID(app.InstallDir)
+	switch {
+	case match == matchManual:
+		return "manual", id
+	case match.fallback():
+		return "unmatched", ""
+	}
+	return "matched", id
+}
+
+// write a table of installed games and how each would resolve, then a summary
+func writeAudit(w io.Writer, apps []SteamApp) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tFOLDER\tSTATUS\tCLIENT ID")
+	counts := map[string]int{}
+	for _, app := range apps {
+		status, id := auditStatus(app)
+		counts[status]++
+		if id == "" {
+			id = "-"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", app.Name, app.InstallDir, status, id)
+	}
+	tw.Flush()
+	fmt.Fprintf(w, "\n%d installed: %d matched, %d manual, %d unmatched, %d ignored\n",
+		len(apps), counts["matched"], counts["manual"], counts["unmatched"], counts["ignored"])
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSteamLibraryApps(t *testing.T) {
+	root := t.TempDir()
+	second := t.TempDir()
+	writeTestFile(t, filepath.Join(root, "steamapps", "libraryfolders.vdf"), fmt.Sprintf(`"libraryfolders"
+{
+	"0" { "path" "%s" }
+	"1" { "path" "%s" }
+}`, root, second))
+	writeTestFile(t, filepath.Join(root, "steamapps", "appmanifest_2379780.acf"), `"AppState"
+{
+	"appid"		"2379780"
+	"name"		"Balatro"
+	"installdir"		"Balatro"
+}`)
+	writeTestFile(t, filepath.Join(second, "steamapps", "appmanifest_1628350.acf"), `"AppState"
+{
+	"appid"		"1628350"
+	"name"		"Steam Linux Runtime 3.0 (sniper)"
+	"installdir"		"SteamLinuxRuntime_sniper"
+}`)
+	writeTestFile(t, filepath.Join(second, "steamapps", "appmanifest_1.acf"), `"AppState" { "appid" "1" }`)
+
+	libraries := steamLibraries(root)
+	if len(libraries) != 2 || libraries[1] != second {
+		t.Fatalf("steamLibraries = %v, want [root, second]", libraries)
+	}
+
+	var apps []SteamApp
+	for _, library := range libraries {
+		apps = append(apps, steamLibraryApps(library)...)
+	}
+	if len(apps) != 2 {
+		t.Fatalf("found %d apps, want 2 (manifest without installdir skipped): %+v", len(apps), apps)
+	}
+
+	nameToID["balatro"] = "1209665818464358430"
+	defer delete(nameToID, "balatro")
+	var out bytes.Buffer
+	writeAudit(&out, apps)
+	report := out.String()
+	for _, want := range []string{"Balatro", "matched", "1209665818464358430", "SteamLinuxRuntime_sniper", "ignored", "2 installed: 1 matched"} {
+		if !strings.Contains(report, want) {
+			t.Errorf("audit report missing %q:\n%s", want, report)
+		}
+	}
+}
+
+func TestReadRunningAppID(t *testing.T) {
+	dir := t.TempDir()
+	registry := func(appID string) string {
+		return fmt.Sprintf(`"Registry"
+{
+	"HKCU"
+	{
+		"Software"
+		{
+			"Valve"
+			{
+				"Steam"
+				{
+					"language"		"english"
+					"RunningAppID"		"%s"
+				}
+			}
+		}
+	}
+}`, appID)
+	}
+
+	running := filepath.Join(dir, "running.vdf")
+	writeTestFile(t, running, registry("2379780"))
+	if got, err := readRunningAppID(running); err != nil || got != "2379780" {
+		t.Errorf("readRunningAppID = %q, %v, want 2379780", got, err)
+	}
+	idle := filepath.Join(dir, "idle.vdf")
+	writeTestFile(t, idle, registry("0"))
+	if got, err := readRunningAppID(idle); err != nil || got != "" {
+		t.Errorf("readRunningAppID while idle = %q, %v, want empty", got, err)
+	}
+	if _, err := readRunningAppID(filepath.Join(dir, "missing.vdf")); err == nil {
+		t.Error("readRunningAppID on a missing file returned no error")
+	}
+}
+
+func TestWithSteamManifest(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	writeTestFile(t, filepath.Join(home, ".local", "share", "Steam", "steamapps", "appmanifest_2379780.acf"),
+		`"AppState" { "appid" "2379780" "name" "Balatro" "installdir" "Balatro" "LastPlayed" "1718000000" "SizeOnDisk" "450887680" }`)
+
+	game := withSteamManifest(DetectedGame{Name: "Balatro", AppID: "2379780"})
+	if !game.LastPlayed.Equal(time.Unix(1718000000, 0)) || game.InstallSize != 450887680 {
+		t.Errorf("withSteamManifest = %+v, want the manifest's LastPlayed and SizeOnDisk", game)
+	}
+	if game := withSteamManifest(DetectedGame{Name: "Hades"}); !game.LastPlayed.IsZero() || game.InstallSize != 0 {
+		t.Errorf("withSteamManifest without an appid = %+v, want it unchanged", game)
+	}
+}
+
+func TestFindSteamApp(t *testing.T) {
+	root := t.TempDir()
+	second := t.TempDir()
+	writeTestFile(t, filepath.Join(root, "steamapps", "libraryfolders.vdf"), fmt.Sprintf(`"libraryfolders" { "1" { "path" "%s" } }`, second))
+	writeTestFile(t, filepath.Join(second, "steamapps", "appmanifest_2379780.acf"), `"AppState" { "appid" "2379780" "name" "Balatro" "installdir" "Balatro" }`)
+
+	app, ok := findSteamApp([]string{root}, "2379780")
+	if !ok || app.InstallDir != "Balatro" || app.Library != second {
+		t.Errorf("findSteamApp = %+v, %v, want Balatro in the second library", app, ok)
+	}
+	if _, ok := findSteamApp([]string{root}, "1"); ok {
+		t.Error("findSteamApp found an app that isn't installed")
+	}
+}
+
+func TestCachedFindSteamApp(t *testing.T) {
+	defer func() { steamAppLookups = map[string]steamAppLookup{} }()
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	manifest := filepath.Join(home, ".local", "share", "Steam", "steamapps", "appmanifest_620.acf")
+	writeTestFile(t, manifest, `"AppState" { "appid" "620" "name" "Portal 2" "installdir" "Portal 2" }`)
+
+	if app, ok := cachedFindSteamApp("620"); !ok || app.InstallDir != "Portal 2" {
+		t.Fatalf("cachedFindSteamApp = %+v, %v, want Portal 2", app, ok)
+	}
+	// a cached app is kept while its manifest is unchanged
+	lookup := steamAppLookups["620"]
+	lookup.app.InstallDir = "cached"
+	steamAppLookups["620"] = lookup
+	if app, _ := cachedFindSteamApp("620"); app.InstallDir != "cached" {
+		t.Errorf("unchanged manifest was searched for again: %+v", app)
+	}
+	os.Remove(manifest)
+	if app, ok := cachedFindSteamApp("620"); ok {
+		t.Errorf("uninstalled app still found: %+v", app)
+	}
+	// a missing app isn't searched for again until steamAppMissRetry passes
+	writeTestFile(t, manifest, `"AppState" { "appid" "620" "name" "Portal 2" "installdir" "Portal 2" }`)
+	if _, ok := cachedFindSteamApp("620"); ok {
+		t.Error("missing app was searched for again right away")
+	}
+	lookup = steamAppLookups["620"]
+	lookup.checked = time.Now().Add(-steamAppMissRetry)
+	steamAppLookups["620"] = lookup
+	if _, ok := cachedFindSteamApp("620"); !ok {
+		t.Error("reinstalled app not found after steamAppMissRetry")
+	}
+}
+
+func TestSteamAppIDFromCgroup(t *testing.T) {
+	tests := []struct {
+		cgroup string
+		want   string
+	}{
+		{"0::/user.slice/user-1000.slice/user@1000.service/app.slice/app-steam-app2379780-73512.scope\n", "2379780"},
+		{"0::/user.slice/user-1000.slice/user@1000.service/app.slice/app-steam-app620-1.scope/game\n", "620"},
+		// only the app<appid> form names a game
+		{"0::/user.slice/user-1000.slice/user@1000.service/app.slice/app-steam-620.scope\n", ""},
+		{"12:pids:/user.slice\n0::/user.slice/user-1000.slice/user@1000.service/app.slice/app-steam-app620@1.scope\n", "620"},
+		// Steam itself, not a game
+		{"0::/user.slice/user-1000.slice/user@1000.service/app.slice/app-steam@autostart.service\n", ""},
+		{"0::/user.slice/user-1000.slice/user@1000.service/app.slice/app-steam-app0-1.scope\n", ""},
+		{"0::/user.slice/user-1000.slice/user@1000.service/app.slice/app-steamtinkerlaunch-12.scope\n", ""},
+		{"0::/user.slice/user-1000.slice/session-2.scope\n", ""},
+	}
+	for _, tt := range tests {
+		if got := steamAppIDFromCgroup(tt.cgroup); got != tt.want {
+			t.Errorf("steamAppIDFromCgroup(%q) = %q, want %q", tt.cgroup, got, tt.want)
+		}
+	}
+}
+
+func TestCachedPidForSteamAppID(t *testing.T) {
+	defer func() { steamAppProcess = steamAppProcessCache{} }()
+	pid := os.Getpid()
+	ticks, err := pidStartTicks(pid)
+	if err != nil {
+		t.Skipf("no /proc: %v", err)
+	}
+	// the cached process is still running, so it's returned without a /proc walk
+	steamAppProcess = steamAppProcessCache{appID: "620", pid: pid, startTicks: ticks}
+	if got := cachedPidForSteamAppID("620"); got != pid {
+		t.Errorf("cached pid = %d, want %d", got, pid)
+	}
+	// a reused PID (different start time) is looked up again
+	steamAppProcess.startTicks = ticks + 1
+	if got := cachedPidForSteamAppID("620"); got == pid {
+		t.Errorf("stale cache entry was reused")
+	}
+}
+
+func TestSteamProcessIsServer(t *testing.T) {
+	exePath, err := os.Executable()
+	if err != nil {
+		t.Skip(err)
+	}
+	game := normalizeGameName("Valheim")
+	serverExecutables[game] = map[string]bool{strings.ToLower(filepath.Base(exePath)): true}
+	defer delete(serverExecutables, game)
+
+	pidStr := strconv.Itoa(os.Getpid())
+	if !steamProcessIsServer("Valheim", pidStr) {
+		t.Error("process running a server executable not detected as a server")
+	}
+	if steamProcessIsServer("Other Game", pidStr) {
+		t.Error("game without server_executables detected as a server")
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+var (
+	steamGridDBKey    = "" // API key; SteamGridDB lookups are disabled when empty
+	steamGridDBApiUrl = "https://www.steamgriddb.com/api/v2"
+	steamGridDBClient = &http.Client{Timeout: 10 * time.Second}
+	// appid -> resolved image URL. appids SteamGridDB has no artwork for are
+	// cached as "" so they cost one request per run, not one per tick.
+	steamGridDBCache = map[string]string{}
+	// appid -> when a lookup that failed (network error, bad status) may be
+	// retried. failures aren't cached, so art shows up once the API recovers.
+	steamGridDBRetryAt    = map[string]time.Time{}
+	steamGridDBRetryDelay = 5 * time.Minute
+)
+
+type steamGridDBResponse struct {
+	Success bool `json:"success"`
+	Data    []struct {
+		URL string `json:"url"`
+	} `json:"data"`
+	Errors []string `json:"errors"`
+}
+
+// resolve a cover image URL for a Steam appid, using the cached result if any.
+// Discord accepts external https image URLs as large_image over IPC and
+// proxies them itself, so the URL is used as-is.
+func steamGridDBImage(appID string) string {
+	if imageURL, ok := steamGridDBCache[appID]; ok {
+		return imageURL
+	}
+	if time.Now().Before(steamGridDBRetryAt[appID]) {
+		return ""
+	}
+	imageURL, err := fetchSteamGridDBImage(appID)
+	if err != nil {
+		slog.Warn("SteamGridDB lookup failed. Retrying later.", "appid", loggedID(appID), "retry_in", steamGridDBRetryDelay, "err", err)
+		steamGridDBRetryAt[appID] = time.Now().Add(steamGridDBRetryDelay)
+		return ""
+	}
+	if imageURL == "" {
+		slog.Info("SteamGridDB has no artwork for game", "appid", loggedID(appID))
+	}
+	delete(steamGridDBRetryAt, appID)
+	steamGridDBCache[appID] = imageURL
+	return imageURL
+}
+
+// fetch the top-rated square grid for a Steam appid. square so it isn't
+// cropped by Discord's large image frame.
+func fetchSteamGridDBImage(appID string) (string, error) {
+	endpoint := fmt.Sprintf("%s/grids/steam/%s?dimensions=%s",
+		steamGridDBApiUrl, url.PathEscape(appID), url.QueryEscape("512x512,1024x1024"))
+	req, err := http.NewRequest(http.MethodGet, endpoint, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Authorization", "Bearer "+steamGridDBKey)
+
+	resp, err := steamGridDBClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	// 404 = SteamGridDB doesn't know this appid
+	if resp.StatusCode == http.StatusNotFound {
+		return "", nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	var body steamGridDBResponse
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", fmt.Errorf("decode response: %w", err)
+	}
+	if !body.Success {
+		return "", fmt.Errorf("request unsuccessful: %v", body.Errors)
+	}
+	if len(body.Data) == 0 {
+		return "", nil
+	}
+	return body.Data[0].URL, nil
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSteamGridDBImage(t *testing.T) {
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if got := r.Header.Get("Authorization"); got != "Bearer test-key" {
+			t.Errorf("Authorization header = %q, want Bearer test-key", got)
+		}
+		switch r.URL.Path {
+		case "/grids/steam/2379780":
+			w.Write([]byte(`{"success":true,"data":[{"url":"https://cdn2.steamgriddb.com/grid/balatro.png"},{"url":"https://cdn2.steamgriddb.com/grid/other.png"}]}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"success":false,"errors":["Game not found"]}`))
+		}
+	}))
+	defer srv.Close()
+
+	oldURL, oldKey, oldCache := steamGridDBApiUrl, steamGridDBKey, steamGridDBCache
+	steamGridDBApiUrl, steamGridDBKey, steamGridDBCache = srv.URL, "test-key", map[string]string{}
+	defer func() { steamGridDBApiUrl, steamGridDBKey, steamGridDBCache = oldURL, oldKey, oldCache }()
+
+	if got := steamGridDBImage("2379780"); got != "https://cdn2.steamgriddb.com/grid/balatro.png" {
+		t.Errorf("steamGridDBImage(2379780) = %q, want first grid URL", got)
+	}
+	if got := steamGridDBImage("1"); got != "" {
+		t.Errorf("steamGridDBImage(1) = %q, want empty for unknown appid", got)
+	}
+
+	// both results are cached, including the miss
+	steamGridDBImage("2379780")
+	steamGridDBImage("1")
+	if requests != 2 {
+		t.Errorf("made %d requests, want 2 (results should be cached)", requests)
+	}
+}
+
+func TestSteamGridDBImageRetriesFailures(t *testing.T) {
+	requests := 0
+	failing := true
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if failing {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.Write([]byte(`{"success":true,"data":[{"url":"https://cdn2.steamgriddb.com/grid/celeste.png"}]}`))
+	}))
+	defer srv.Close()
+
+	oldURL, oldKey, oldCache, oldRetryAt, oldDelay := steamGridDBApiUrl, steamGridDBKey, steamGridDBCache, steamGridDBRetryAt, steamGridDBRetryDelay
+	steamGridDBApiUrl, steamGridDBKey, steamGridDBCache, steamGridDBRetryAt = srv.URL, "test-key", map[string]string{}, map[string]time.Time{}
+	steamGridDBRetryDelay = time.Hour
+	defer func() {
+		steamGridDBApiUrl, steamGridDBKey, steamGridDBCache, steamGridDBRetryAt, steamGridDBRetryDelay = oldURL, oldKey, oldCache, oldRetryAt, oldDelay
+	}()
+
+	if got := steamGridDBImage("504230"); got != "" {
+		t.Errorf("failed lookup = %q, want empty", got)
+	}
+	// within the backoff, no new request
+	steamGridDBImage("504230")
+	if requests != 1 {
+		t.Errorf("made %d requests during backoff, want 1", requests)
+	}
+	if _, cached := steamGridDBCache["504230"]; cached {
+		t.Error("failed lookup was cached")
+	}
+
+	// after the backoff, the lookup is retried and the result cached
+	failing = false
+	steamGridDBRetryAt["504230"] = time.Now().Add(-time.Second)
+	if got := steamGridDBImage("504230"); got != "https://cdn2.steamgriddb.com/grid/celeste.png" {
+		t.Errorf("retried lookup = %q, want the grid URL", got)
+	}
+	if requests != 2 {
+		t.Errorf("made %d requests, want 2", requests)
+	}
+}
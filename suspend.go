@@ -0,0 +1,34 @@
+package main
+
+import "time"
+
+// shortest unaccounted gap between two checks treated as a suspend
+const minSleepGap = 10 * time.Second
+
+// sleepDetector notices the machine having been suspended between two
+// checks. the wall clock keeps counting through a suspend, but Go's
+// monotonic clock (CLOCK_MONOTONIC) doesn't, so the difference between the
+// two is the time spent asleep. tickers don't fire late after a resume, so
+// a gap between ticks alone wouldn't show it.
+type sleepDetector struct {
+	last time.Time // time of the last check, with its monotonic reading
+}
+
+// record a check at now. returns how long the machine slept since the last
+// one, and whether that counts as a suspend.
+func (d *sleepDetector) slept(now time.Time) (time.Duration, bool) {
+	last := d.last
+	d.last = now
+	if last.IsZero() {
+		return 0, false
+	}
+	gap := sleepGap(last.Round(0), now.Round(0), now.Sub(last))
+	return gap, gap >= minSleepGap
+}
+
+// wall clock time that passed between two readings beyond the monotonic
+// elapsed time. also catches the clock being stepped forward, which is
+// handled the same way.
+func sleepGap(lastWall time.Time, nowWall time.Time, monotonic time.Duration) time.Duration {
+	return nowWall.Sub(lastWall) - monotonic
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSleepGap(t *testing.T) {
+	last := time.Date(2026, 3, 1, 22, 0, 0, 0, time.UTC)
+	if gap := sleepGap(last, last.Add(2*time.Second), 2*time.Second); gap != 0 {
+		t.Errorf("awake gap = %v, want 0", gap)
+	}
+	// two seconds of ticks around eight hours asleep
+	if gap := sleepGap(last, last.Add(8*time.Hour+2*time.Second), 2*time.Second); gap != 8*time.Hour {
+		t.Errorf("suspended gap = %v, want 8h", gap)
+	}
+	// the clock stepped back: not a suspend
+	if gap := sleepGap(last, last.Add(-time.Minute), 2*time.Second); gap >= minSleepGap {
+		t.Errorf("clock stepped back gap = %v", gap)
+	}
+}
+
+func TestSleepDetector(t *testing.T) {
+	var d sleepDetector
+	if _, ok := d.slept(time.Now()); ok {
+		t.Error("first check reported a suspend")
+	}
+	time.Sleep(10 * time.Millisecond)
+	if gap, ok := d.slept(time.Now()); ok || gap > time.Second {
+		t.Errorf("check while awake = %v, %v, want no suspend", gap, ok)
+	}
+}
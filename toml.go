@@ -0,0 +1,57 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pelletier/go-toml/v2"
+)
+
+// parse a TOML document into nested maps, slices, strings, int64s, float64s,
+// and bools. dates and times are rejected, since nothing in the config takes
+// one.
+func parseTOML(data string) (map[string]any, error) {
+	var doc map[string]any
+	if err := toml.Unmarshal([]byte(data), &doc); err != nil {
+		var decodeErr *toml.DecodeError
+		if errors.As(err, &decodeErr) {
+			line, _ := decodeErr.Position()
+			return nil, fmt.Errorf("line %d: %s", line, strings.TrimPrefix(decodeErr.Error(), "toml: "))
+		}
+		return nil, err
+	}
+	if doc == nil {
+		doc = map[string]any{}
+	}
+	if key := tomlDateKey(doc, ""); key != "" {
+		return nil, fmt.Errorf("%s: dates and times aren't supported", key)
+	}
+	return doc, nil
+}
+
+// dotted key of the first date or time value under v, or ""
+func tomlDateKey(v any, key string) string {
+	switch v := v.(type) {
+	case map[string]any:
+		for k, value := range v {
+			path := k
+			if key != "" {
+				path = key + "." + k
+			}
+			if found := tomlDateKey(value, path); found != "" {
+				return found
+			}
+		}
+	case []any:
+		for i, value := range v {
+			if found := tomlDateKey(value, fmt.Sprintf("%s[%d]", key, i)); found != "" {
+				return found
+			}
+		}
+	case time.Time, toml.LocalDate, toml.LocalTime, toml.LocalDateTime:
+		return key
+	}
+	return ""
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseTOML(t *testing.T) {
+	data := `# bridge config
+scan_interval_seconds = 1_5
+ratio = 0.5
+enabled = true
+name = "Tab\tand \"quotes\" \u00e9"
+path = 'C:\Games\'
+ignored_games = [
+  "Steam", # the client
+  'Proton',
+]
+note = """
+first \
+  second"""
+
+[manual_mappings]
+"Some Game" = "123"
+plain.dotted = "x"
+
+[[cloud_title_patterns]]
+pattern = '^(.+) on Site'
+platform = "Site"
+
+[[cloud_title_patterns]]
+pattern = "x(.+)"
+extra = { a = 1, b = [2, 3] }
+`
+	got, err := parseTOML(data)
+	if err != nil {
+		t.Fatalf("parseTOML: %v", err)
+	}
+	want := map[string]any{
+		"scan_interval_seconds": int64(15),
+		"ratio":                 0.5,
+		"enabled":               true,
+		"name":                  "Tab\tand \"quotes\" é",
+		"path":                  `C:\Games\`,
+		"ignored_games":         []any{"Steam", "Proton"},
+		"note":                  "first second",
+		"manual_mappings": map[string]any{
+			"Some Game": "123",
+			"plain":     map[string]any{"dotted": "x"},
+		},
+		"cloud_title_patterns": []any{
+			map[string]any{"pattern": "^(.+) on Site", "platform": "Site"},
+			map[string]any{"pattern": "x(.+)", "extra": map[string]any{"a": int64(1), "b": []any{int64(2), int64(3)}}},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseTOML =\n%#v\nwant\n%#v", got, want)
+	}
+}
+
+func TestParseTOMLInvalid(t *testing.T) {
+	for _, data := range []string{
+		`key`,
+		`key = `,
+		`key = "unterminated`,
+		`key = 1 2`,
+		"a = 1\na = 2",
+		`a = [1, 2`,
+		`a = 012`,
+		`when = 2024-01-01`,
+		"a = 1\n[a]",
+		"[a]\nx = 1\n[a]\ny = 2",
+		`s = "bad \q escape"`,
+		"t = [1, {when = 07:30:00}]",
+		// keys under an inline array, which isn't an array of tables
+		"a = []\n[a.b]",
+		"a = []\n[[a.b]]",
+		"a = []\na.b = 1",
+	} {
+		if _, err := parseTOML(data); err == nil {
+			t.Errorf("parseTOML(%q) should fail", data)
+		}
+	}
+}
+
+func TestParseTOMLLineEndingBackslash(t *testing.T) {
+	done := make(chan error, 1)
+	go func() {
+		_, err := parseTOML("s = \"\"\"a \\\n  b\"\"\"\nt = \"\"\"a \\")
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Error("unterminated multiline string should fail")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("parseTOML hung on a line-ending backslash")
+	}
+}
+
+func TestParseTOMLArrayTableSubtables(t *testing.T) {
+	got, err := parseTOML("[[games]]\n[games.extra]\nx = 1\n[[games]]\n[games.extra]\nx = 2\n")
+	if err != nil {
+		t.Fatalf("parseTOML: %v", err)
+	}
+	games := got["games"].([]any)
+	if len(games) != 2 || games[1].(map[string]any)["extra"].(map[string]any)["x"] != int64(2) {
+		t.Errorf("games = %#v", games)
+	}
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// vdfObject is a parsed Valve KeyValues (VDF) block. values are either
+// strings or nested vdfObjects. keys are lowercased, since Steam isn't
+// consistent about casing across versions (ex: "installdir" vs "InstallDir").
+type vdfObject map[string]any
+
+// string value at key, or "" if missing or not a string
+func (o vdfObject) str(key string) string {
+	s, _ := o[strings.ToLower(key)].(string)
+	return s
+}
+
+// nested block at key, or nil if missing or not a block
+func (o vdfObject) obj(key string) vdfObject {
+	child, _ := o[strings.ToLower(key)].(vdfObject)
+	return child
+}
+
+// parse text VDF, as used by libraryfolders.vdf and appmanifest_*.acf.
+// supports quoted and bare tokens, escapes in quoted strings, and // comments.
+// on duplicate keys the last value wins.
+func parseVDF(data string) (vdfObject, error) {
+	p := vdfParser{data: data}
+	root, err := p.parseBlock(false)
+	if err != nil {
+		return nil, err
+	}
+	return root, nil
+}
+
+type vdfParser struct {
+	data string
+	pos  int
+}
+
+func (p *vdfParser) parseBlock(nested bool) (vdfObject, error) {
+	obj := vdfObject{}
+	for {
+		tok, quoted, err := p.next()
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case tok == "" && !quoted:
+			if nested {
+				return nil, fmt.Errorf("vdf: unexpected end of input inside block")
+			}
+			return obj, nil
+		case tok == "}" && !quoted:
+			if !nested {
+				return nil, fmt.Errorf("vdf: unexpected '}' at offset %d", p.pos)
+			}
+			return obj, nil
+		case tok == "{" && !quoted:
+			return nil, fmt.Errorf("vdf: block without a key at offset %d", p.pos)
+		}
+
+		key := strings.ToLower(tok)
+		val, valQuoted, err := p.next()
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case val == "{" && !valQuoted:
+			child, err := p.parseBlock(true)
+			if err != nil {
+				return nil, err
+			}
+			obj[key] = child
+		case (val == "" || val == "}") && !valQuoted:
+			return nil, fmt.Errorf("vdf: key %q has no value", tok)
+		default:
+			obj[key] = val
+		}
+	}
+}
+
+// next token. returns "" (unquoted) at end of input.
+func (p *vdfParser) next() (tok string, quoted bool, err error) {
+	for p.pos < len(p.data) {
+		c := p.data[p.pos]
+		switch {
+		case c == ' ' || c == '\t' || c == '\r' || c == '\n':
+			p.pos++
+		case strings.HasPrefix(p.data[p.pos:], "//"):
+			if nl := strings.IndexByte(p.data[p.pos:], '\n'); nl >= 0 {
+				p.pos += nl + 1
+			} else {
+				p.pos = len(p.data)
+			}
+		case c == '{' || c == '}':
+			p.pos++
+			return string(c), false, nil
+		case c == '"':
+			return p.quoted()
+		default:
+			start := p.pos
+			for p.pos < len(p.data) && !strings.ContainsRune(" \t\r\n{}\"", rune(p.data[p.pos])) {
+				p.pos++
+			}
+			return p.data[start:p.pos], false, nil
+		}
+	}
+	return "", false, nil
+}
+
+func (p *vdfParser) quoted() (string, bool, error) {
+	start := p.pos
+	p.pos++ // opening quote
+	var b strings.Builder
+	for p.pos < len(p.data) {
+		c := p.data[p.pos]
+		p.pos++
+		switch c {
+		case '"':
+			return b.String(), true, nil
+		case '\\':
+			if p.pos >= len(p.data) {
+				break
+			}
+			esc := p.data[p.pos]
+			p.pos++
+			switch esc {
+			case 'n':
+				b.WriteByte('\n')
+			case 't':
+				b.WriteByte('\t')
+			default:
+				// \\ and \" and anything unknown: keep the escaped byte
+				b.WriteByte(esc)
+			}
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return "", false, fmt.Errorf("vdf: unterminated string at offset %d", start)
+}
@@ -0,0 +1,54 @@
+package main
+
+import "testing"
+
+func TestParseVDF(t *testing.T) {
+	data := `// generated by Steam
+"libraryfolders"
+{
+	"0"
+	{
+		"path"		"/home/user/.local/share/Steam"
+		"label"		""
+		"apps"
+		{
+			"620"		"12345"
+		}
+	}
+	"1"
+	{
+		"Path"		"/mnt/games/Steam \"Library\""
+	}
+}
+`
+	vdf, err := parseVDF(data)
+	if err != nil {
+		t.Fatalf("parseVDF: %v", err)
+	}
+	folders := vdf.obj("libraryfolders")
+	if got := folders.obj("0").str("path"); got != "/home/user/.local/share/Steam" {
+		t.Errorf("folders[0].path = %q", got)
+	}
+	if got := folders.obj("0").obj("apps").str("620"); got != "12345" {
+		t.Errorf("folders[0].apps.620 = %q, want 12345", got)
+	}
+	if got := folders.obj("1").str("PATH"); got != `/mnt/games/Steam "Library"` {
+		t.Errorf("folders[1].path = %q", got)
+	}
+	if got := folders.obj("0").str("label"); got != "" {
+		t.Errorf("empty quoted value = %q, want empty", got)
+	}
+}
+
+func TestParseVDFInvalid(t *testing.T) {
+	for _, data := range []string{
+		`"AppState" {`,
+		`"AppState" { "name" "unterminated }`,
+		`"key"`,
+		`}`,
+	} {
+		if _, err := parseVDF(data); err == nil {
+			t.Errorf("parseVDF(%q) should fail", data)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// watchdog detects a wedged scan loop. the loop calls beat after every scan;
+// if no beat arrives within the grace window, the watchdog closes the current
+// IPC connection so a read or write stuck on it returns, and the loop
+// reconnects on its next pass.
+type watchdog struct {
+	mu     sync.Mutex
+	last   time.Time
+	conn   *IpcConn // connection owned by the scan loop, closed when the loop wedges
+	wedged bool
+	wedges int // total wedge events since startup
+}
+
+func newWatchdog() *watchdog {
+	return &watchdog{last: time.Now()}
+}
+
+// record scan loop progress and the connection it currently holds
+func (w *watchdog) beat(conn *IpcConn) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.last = time.Now()
+	w.conn = conn
+	if w.wedged {
+		slog.Info("Scan loop recovered.")
+		w.wedged = false
+	}
+}
+
+// fire once per wedge if the last beat is older than grace.
+// returns true if it fired.
+func (w *watchdog) check(grace time.Duration) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	stalled := time.Since(w.last)
+	if w.wedged || stalled < grace {
+		return false
+	}
+	w.wedged = true
+	w.wedges++
+	slog.Error("Scan loop wedged. Forcing the Discord connection closed.", "stalled", stalled.Round(time.Second), "wedges", w.wedges)
+	if w.conn != nil {
+		w.conn.Close()
+	}
+	return true
+}
+
+// number of wedge events since startup
+func (w *watchdog) wedgeCount() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.wedges
+}
+
+// check for a wedged loop every few seconds until ctx is done.
+// grace is re-evaluated each check so it follows scan interval changes.
+func (w *watchdog) run(ctx context.Context, grace func() time.Duration) {
+	ticker := time.NewTicker(5 * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			w.check(grace())
+		}
+	}
+}
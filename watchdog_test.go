@@ -0,0 +1,48 @@
+package main
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestWatchdogClosesWedgedConn(t *testing.T) {
+	client, server := net.Pipe()
+	defer server.Close()
+
+	w := newWatchdog()
+	w.beat(newIpcConn(client))
+
+	if w.check(time.Hour) {
+		t.Fatal("check fired before the grace window elapsed")
+	}
+
+	// simulate a loop that hasn't beaten in a while
+	w.mu.Lock()
+	w.last = time.Now().Add(-time.Minute)
+	w.mu.Unlock()
+
+	if !w.check(30 * time.Second) {
+		t.Fatal("check did not fire for a stalled loop")
+	}
+	if _, err := client.Write([]byte("x")); err == nil {
+		t.Error("wedged connection should have been closed")
+	}
+
+	// one wedge is reported once, not on every check
+	if w.check(30 * time.Second) {
+		t.Error("check fired twice for the same wedge")
+	}
+	if got := w.wedgeCount(); got != 1 {
+		t.Errorf("wedgeCount = %d, want 1", got)
+	}
+
+	// a beat clears the wedge so the next stall counts again
+	w.beat(nil)
+	w.mu.Lock()
+	w.last = time.Now().Add(-time.Minute)
+	w.mu.Unlock()
+	if !w.check(30*time.Second) || w.wedgeCount() != 2 {
+		t.Errorf("second stall not counted, wedgeCount = %d", w.wedgeCount())
+	}
+}